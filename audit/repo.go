@@ -0,0 +1,162 @@
+package audit
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo"
+	"reflect"
+	"time"
+)
+
+// RecordType is the type of the audit records.
+const RecordType eventbus.DataType = "audit"
+
+// Op is the kind of write of a Record.
+type Op string
+
+const (
+	// OpSave is a saved entity.
+	OpSave Op = "save"
+	// OpRemove is a removed entity.
+	OpRemove Op = "remove"
+)
+
+// Record is the audit record of a write.
+type Record struct {
+	ID        eventbus.DataId   `json:"id" bson:"_id"`
+	Op        Op                `json:"op" bson:"op"`
+	Namespace eventbus.DataType `json:"namespace" bson:"namespace"`
+	EntityID  eventbus.DataId   `json:"entityId" bson:"entityId"`
+	Timestamp time.Time         `json:"timestamp" bson:"timestamp"`
+	// Snapshot is a copy of the saved entity, made with its JSON encoding, it
+	// is not set for removes.
+	Snapshot eventbus.Data `json:"snapshot,omitempty" bson:"snapshot,omitempty"`
+}
+
+// Id implements the Id method of the eventbus.Data interface.
+func (r *Record) Id() eventbus.DataId {
+	return r.ID
+}
+
+// DataType implements the DataType method of the eventbus.Data interface.
+func (r *Record) DataType() eventbus.DataType {
+	return RecordType
+}
+
+// Repo is a middleware that appends an audit record to a separate store for
+// every successful write. By default a failure to write the record is returned
+// as the error of the write, even though the write itself succeeded.
+type Repo struct {
+	repo.ReadWriteRepo
+	store   repo.WriteRepo
+	onError func(error)
+	now     func() time.Time
+}
+
+// NewRepo creates a new Repo writing the audit records to store.
+func NewRepo(repo repo.ReadWriteRepo, store repo.WriteRepo) *Repo {
+	return &Repo{
+		ReadWriteRepo: repo,
+		store:         store,
+		now:           time.Now,
+	}
+}
+
+// SetErrorHandler makes failures to write audit records non fatal, they are
+// passed to f instead of being returned.
+func (r *Repo) SetErrorHandler(f func(error)) {
+	r.onError = f
+}
+
+// Parent implements the Parent method of the eventhorizon.ReadRepo interface.
+func (r *Repo) Parent() repo.ReadRepo {
+	return r.ReadWriteRepo
+}
+
+// Save implements the Save method of the eventhorizon.WriteRepo interface.
+func (r *Repo) Save(data eventbus.Data) error {
+	if err := r.ReadWriteRepo.Save(data); err != nil {
+		return err
+	}
+
+	return r.record(OpSave, data, data)
+}
+
+// Remove implements the Remove method of the eventhorizon.WriteRepo interface.
+func (r *Repo) Remove(data eventbus.Data) error {
+	if err := r.ReadWriteRepo.Remove(data); err != nil {
+		return err
+	}
+
+	return r.record(OpRemove, data, nil)
+}
+
+func (r *Repo) record(op Op, data eventbus.Data, snapshot eventbus.Data) error {
+	id, err := newID()
+	if err == nil && snapshot != nil {
+		snapshot, err = copyData(snapshot)
+	}
+	if err == nil {
+		err = r.store.Save(&Record{
+			ID:        id,
+			Op:        op,
+			Namespace: data.DataType(),
+			EntityID:  data.Id(),
+			Timestamp: r.now(),
+			Snapshot:  snapshot,
+		})
+	}
+	if err != nil && r.onError != nil {
+		r.onError(err)
+		return nil
+	}
+
+	return err
+}
+
+// copyData returns a deep copy of the entity, made by marshalling it, so that
+// later changes of the entity do not change its record.
+func copyData(data eventbus.Data) (eventbus.Data, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	t := reflect.TypeOf(data)
+	if t.Kind() == reflect.Ptr {
+		v := reflect.New(t.Elem())
+		if err := json.Unmarshal(b, v.Interface()); err != nil {
+			return nil, err
+		}
+		return v.Interface().(eventbus.Data), nil
+	}
+
+	v := reflect.New(t)
+	if err := json.Unmarshal(b, v.Interface()); err != nil {
+		return nil, err
+	}
+	return v.Elem().Interface().(eventbus.Data), nil
+}
+
+func newID() (eventbus.DataId, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return eventbus.DataId(hex.EncodeToString(b)), nil
+}
+
+// Repository returns a parent ReadRepo if there is one.
+func Repository(repo repo.ReadRepo) *Repo {
+	if repo == nil {
+		return nil
+	}
+
+	if r, ok := repo.(*Repo); ok {
+		return r
+	}
+
+	return Repository(repo.Parent())
+}
@@ -0,0 +1,126 @@
+package audit
+
+import (
+	"errors"
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo"
+	"github.com/jeek120/repo/mocks"
+	"sort"
+	"testing"
+	"time"
+)
+
+func records(t *testing.T, store *mocks.Repo) []*Record {
+	entities, err := store.FindAll(string(RecordType))
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	result := []*Record{}
+	for _, e := range entities {
+		result = append(result, e.(*Record))
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Timestamp.Before(result[j].Timestamp) })
+	return result
+}
+
+func TestRepo(t *testing.T) {
+	inner, store := mocks.NewRepo(), mocks.NewRepo()
+	r := NewRepo(inner, store)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	r.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+
+	m := &mocks.Model{ID: "1", Content: "content"}
+	if err := r.Save(m); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := r.Remove(m); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	// Failed writes are not recorded.
+	if err := r.Remove(m); err == nil {
+		t.Error("there should be an error")
+	}
+	inner.SetError(repo.RepoError{Err: errors.New("error")})
+	if err := r.Save(m); err == nil {
+		t.Error("there should be an error")
+	}
+
+	recs := records(t, store)
+	if len(recs) != 2 {
+		t.Fatal("there should be one record per successful write:", len(recs))
+	}
+	if rec := recs[0]; rec.Op != OpSave || rec.Namespace != mocks.ModelType || rec.EntityID != "1" || rec.ID == "" {
+		t.Errorf("the save should be recorded: %+v", rec)
+	}
+	if snapshot, ok := recs[0].Snapshot.(*mocks.Model); !ok || snapshot == m || *snapshot != *m {
+		t.Errorf("the save should be recorded with a copy of the entity: %+v", recs[0].Snapshot)
+	}
+	if rec := recs[1]; rec.Op != OpRemove || rec.EntityID != "1" || rec.Snapshot != nil || !rec.Timestamp.Equal(now) {
+		t.Errorf("the remove should be recorded without a snapshot: %+v", rec)
+	}
+	if recs[0].ID == recs[1].ID {
+		t.Error("the records should have unique IDs")
+	}
+}
+
+func TestRepoRecordError(t *testing.T) {
+	inner, store := mocks.NewRepo(), mocks.NewRepo()
+	r := NewRepo(inner, store)
+	storeErr := repo.RepoError{Err: errors.New("store error")}
+	store.SetError(storeErr)
+
+	// By default a failed record fails the write.
+	if err := r.Save(&mocks.Model{ID: "1"}); err != storeErr {
+		t.Error("the record error should be returned:", err)
+	}
+
+	// With an error handler the failure is passed to it.
+	var handled []error
+	r.SetErrorHandler(func(err error) {
+		handled = append(handled, err)
+	})
+	if err := r.Save(&mocks.Model{ID: "1"}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(handled) != 1 || handled[0] != storeErr {
+		t.Error("the record error should be handled:", handled)
+	}
+	if n := inner.Calls("Save"); n != 2 {
+		t.Error("the writes should be done:", n)
+	}
+}
+
+func TestRepoSnapshotCopy(t *testing.T) {
+	inner, store := mocks.NewRepo(), mocks.NewRepo()
+	r := NewRepo(inner, store)
+
+	m := &mocks.Model{ID: "1", Content: "before"}
+	if err := r.Save(m); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	// The entity is changed in place, like an in-memory store allows.
+	m.Content = "after"
+	recs := records(t, store)
+	if len(recs) != 1 || recs[0].Snapshot.(*mocks.Model).Content != "before" {
+		t.Error("the snapshot should not change with the entity:", recs[0].Snapshot)
+	}
+}
+
+// valueModel is an entity implemented by a value type.
+type valueModel struct {
+	ID string `json:"id"`
+}
+
+func (m valueModel) Id() eventbus.DataId         { return eventbus.DataId(m.ID) }
+func (m valueModel) DataType() eventbus.DataType { return "Value" }
+
+func TestCopyData(t *testing.T) {
+	if data, err := copyData(valueModel{ID: "1"}); err != nil || data != (valueModel{ID: "1"}) {
+		t.Error("the value should be copied:", data, err)
+	}
+}
@@ -0,0 +1,253 @@
+package breaker
+
+import (
+	"errors"
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is when the circuit is open and operations fail fast.
+var ErrCircuitOpen = errors.New("circuit open")
+
+type state int
+
+const (
+	closed state = iota
+	open
+	halfOpen
+)
+
+// Repo is a middleware implementing a circuit breaker. After a number of
+// consecutive infrastructure failures the circuit opens and all operations
+// fail fast with ErrCircuitOpen for a cooldown period. After the cooldown one
+// probe operation is let through; if it succeeds the circuit closes again,
+// otherwise it re-opens. Results of operations allowed before the last change
+// of state are ignored, so that a slow operation can not settle the probe.
+type Repo struct {
+	repo.ReadWriteRepo
+	threshold int
+	cooldown  time.Duration
+	isFailure func(error) bool
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    state
+	failures int
+	openedAt time.Time
+	probing  bool
+	gen      uint64
+}
+
+// NewRepo creates a new Repo that opens after threshold consecutive failures
+// and stays open for cooldown.
+func NewRepo(rr repo.ReadWriteRepo, threshold int, cooldown time.Duration) *Repo {
+	return &Repo{
+		ReadWriteRepo: rr,
+		threshold:     threshold,
+		cooldown:      cooldown,
+		isFailure:     repo.IsInfrastructureError,
+		now:           time.Now,
+	}
+}
+
+// SetFailureFunc sets the function deciding which errors count as failures. By
+// default they are the errors of repo.IsInfrastructureError.
+func (r *Repo) SetFailureFunc(f func(error) bool) {
+	r.isFailure = f
+}
+
+// Parent implements the Parent method of the eventhorizon.ReadRepo interface.
+func (r *Repo) Parent() repo.ReadRepo {
+	return r.ReadWriteRepo
+}
+
+// Find implements the Find method of the eventhorizon.ReadRepo interface.
+func (r *Repo) Find(data eventbus.Data) (eventbus.Data, error) {
+	gen, err := r.allow()
+	if err != nil {
+		return nil, err
+	}
+
+	entity, err := r.ReadWriteRepo.Find(data)
+	r.done(gen, err)
+
+	return entity, err
+}
+
+// FindById implements the FindById method of the eventhorizon.ReadRepo interface.
+func (r *Repo) FindById(ns string, id eventbus.DataId) (eventbus.Data, error) {
+	gen, err := r.allow()
+	if err != nil {
+		return nil, err
+	}
+
+	entity, err := r.ReadWriteRepo.FindById(ns, id)
+	r.done(gen, err)
+
+	return entity, err
+}
+
+// FindByIds implements the FindByIds method of the eventhorizon.ReadRepo interface.
+func (r *Repo) FindByIds(ns string, ids []eventbus.DataId) ([]eventbus.Data, error) {
+	gen, err := r.allow()
+	if err != nil {
+		return nil, err
+	}
+
+	entities, err := r.ReadWriteRepo.FindByIds(ns, ids)
+	r.done(gen, err)
+
+	return entities, err
+}
+
+// FindAll implements the FindAll method of the eventhorizon.ReadRepo interface.
+func (r *Repo) FindAll(ns string) ([]eventbus.Data, error) {
+	gen, err := r.allow()
+	if err != nil {
+		return nil, err
+	}
+
+	entities, err := r.ReadWriteRepo.FindAll(ns)
+	r.done(gen, err)
+
+	return entities, err
+}
+
+// FindAllIter implements the FindAllIter method of the eventhorizon.ReadRepo interface.
+func (r *Repo) FindAllIter(ns string) (repo.Iter, error) {
+	gen, err := r.allow()
+	if err != nil {
+		return nil, err
+	}
+
+	i, err := r.ReadWriteRepo.FindAllIter(ns)
+	r.done(gen, err)
+
+	return i, err
+}
+
+// Count implements the Count method of the eventhorizon.ReadRepo interface.
+func (r *Repo) Count(ns string) (int64, error) {
+	gen, err := r.allow()
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := r.ReadWriteRepo.Count(ns)
+	r.done(gen, err)
+
+	return n, err
+}
+
+// Save implements the Save method of the eventhorizon.WriteRepo interface.
+func (r *Repo) Save(data eventbus.Data) error {
+	gen, err := r.allow()
+	if err != nil {
+		return err
+	}
+
+	err = r.ReadWriteRepo.Save(data)
+	r.done(gen, err)
+
+	return err
+}
+
+// Remove implements the Remove method of the eventhorizon.WriteRepo interface.
+func (r *Repo) Remove(data eventbus.Data) error {
+	gen, err := r.allow()
+	if err != nil {
+		return err
+	}
+
+	err = r.ReadWriteRepo.Remove(data)
+	r.done(gen, err)
+
+	return err
+}
+
+// allow returns ErrCircuitOpen if the operation must fail fast, otherwise the
+// generation of the state the operation is allowed in.
+func (r *Repo) allow() (uint64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch r.state {
+	case open:
+		if r.now().Sub(r.openedAt) < r.cooldown {
+			return 0, repo.RepoError{
+				Err: ErrCircuitOpen,
+			}
+		}
+		r.setState(halfOpen)
+		fallthrough
+	case halfOpen:
+		// Only one probe at a time.
+		if r.probing {
+			return 0, repo.RepoError{
+				Err: ErrCircuitOpen,
+			}
+		}
+		r.probing = true
+	}
+
+	return r.gen, nil
+}
+
+// done records the result of an operation allowed in generation gen.
+func (r *Repo) done(gen uint64, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// The state changed since the operation was allowed.
+	if gen != r.gen {
+		return
+	}
+
+	failed := err != nil && r.isFailure(err)
+	if r.state == halfOpen {
+		r.probing = false
+		if failed {
+			r.setState(open)
+		} else {
+			r.setState(closed)
+		}
+		return
+	}
+
+	if !failed {
+		r.failures = 0
+		return
+	}
+
+	r.failures++
+	if r.failures >= r.threshold {
+		r.setState(open)
+	}
+}
+
+// setState changes the state and starts a new generation.
+func (r *Repo) setState(s state) {
+	r.state = s
+	r.gen++
+	switch s {
+	case open:
+		r.openedAt = r.now()
+	case closed:
+		r.failures = 0
+	}
+}
+
+// Repository returns a parent ReadRepo if there is one.
+func Repository(repo repo.ReadRepo) *Repo {
+	if repo == nil {
+		return nil
+	}
+
+	if r, ok := repo.(*Repo); ok {
+		return r
+	}
+
+	return Repository(repo.Parent())
+}
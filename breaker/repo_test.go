@@ -0,0 +1,147 @@
+package breaker
+
+import (
+	"errors"
+	"github.com/jeek120/repo"
+	"github.com/jeek120/repo/mocks"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRepoTransitions(t *testing.T) {
+	inner := mocks.NewRepo()
+	r := NewRepo(inner, 2, time.Minute)
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	m := &mocks.Model{ID: "1"}
+	// A write failing with a driver network error, as the MongoDB repo
+	// returns it when the database is down.
+	netErr := repo.RepoError{
+		Err:     repo.ErrCouldNotSaveEntity,
+		BaseErr: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")},
+	}
+
+	// Closed: errors that are not infrastructure errors do not count.
+	inner.SetError(repo.RepoError{Err: repo.ErrEntityNotFound})
+	for i := 0; i < 3; i++ {
+		if _, err := r.FindById("Model", "1"); isOpen(err) {
+			t.Fatal("circuit opened on a not found error")
+		}
+	}
+
+	// Closed: the failures reach the inner repo until the threshold.
+	inner.SetError(netErr)
+	for i := 0; i < 2; i++ {
+		if err := r.Save(m); err == nil || isOpen(err) {
+			t.Fatal("there should be an inner error:", err)
+		}
+	}
+	if r.state != open {
+		t.Fatal("the circuit should be open")
+	}
+
+	// Open: fail fast without reaching the inner repo.
+	inner.ResetCalls()
+	if err := r.Save(m); !isOpen(err) {
+		t.Error("there should be a circuit open error:", err)
+	}
+	if _, err := r.FindAll("Model"); !isOpen(err) {
+		t.Error("there should be a circuit open error:", err)
+	}
+	if inner.Calls("Save") != 0 || inner.Calls("FindAll") != 0 {
+		t.Error("the inner repo should not be called")
+	}
+
+	// Half-open: after the cooldown one probe is let through, failing it
+	// re-opens the circuit.
+	now = now.Add(time.Minute)
+	if err := r.Save(m); err == nil || isOpen(err) {
+		t.Error("the probe should reach the inner repo:", err)
+	}
+	if r.state != open {
+		t.Error("the circuit should be open again")
+	}
+	if err := r.Save(m); !isOpen(err) {
+		t.Error("there should be a circuit open error:", err)
+	}
+
+	// Half-open: a successful probe closes the circuit.
+	now = now.Add(time.Minute)
+	inner.SetError(nil)
+	if err := r.Save(m); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if r.state != closed {
+		t.Error("the circuit should be closed")
+	}
+	if _, err := r.FindById("Model", "1"); err != nil {
+		t.Error("there should be no error:", err)
+	}
+}
+
+func TestRepoOneProbe(t *testing.T) {
+	inner := mocks.NewRepo()
+	r := NewRepo(inner, 1, time.Minute)
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	inner.SetError(repo.RepoError{Err: repo.ErrConnectionLost})
+	r.Count("Model")
+
+	// Simulate a probe in flight.
+	now = now.Add(time.Minute)
+	if _, err := r.allow(); err != nil {
+		t.Fatal("the probe should be allowed:", err)
+	}
+	if _, err := r.Count("Model"); !isOpen(err) {
+		t.Error("only one probe should be let through:", err)
+	}
+}
+
+func TestRepoStaleResult(t *testing.T) {
+	inner := mocks.NewRepo()
+	r := NewRepo(inner, 1, time.Minute)
+	now := time.Now()
+	r.now = func() time.Time { return now }
+	connErr := repo.RepoError{Err: repo.ErrConnectionLost}
+
+	// A slow operation is allowed while closed, the circuit then opens.
+	slow, err := r.allow()
+	if err != nil {
+		t.Fatal("the operation should be allowed:", err)
+	}
+	inner.SetError(connErr)
+	r.Count("Model")
+
+	// The result of the slow operation does not settle the probe.
+	now = now.Add(time.Minute)
+	probe, err := r.allow()
+	if err != nil {
+		t.Fatal("the probe should be allowed:", err)
+	}
+	r.done(slow, nil)
+	if r.state != halfOpen || !r.probing {
+		t.Error("the probe should still be in flight")
+	}
+
+	r.done(probe, connErr)
+	if r.state != open {
+		t.Error("the failed probe should re-open the circuit")
+	}
+
+	// A failure allowed before the circuit closed does not count.
+	now = now.Add(time.Minute)
+	probe, _ = r.allow()
+	r.done(probe, nil)
+	r.done(slow, connErr)
+	if r.state != closed {
+		t.Error("the circuit should stay closed")
+	}
+}
+
+func isOpen(err error) bool {
+	rrErr, ok := err.(repo.RepoError)
+	return ok && rrErr.Err == ErrCircuitOpen
+}
@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"github.com/jeek120/eventbus"
+)
+
+// tombstone is cached for IDs that are known to be missing in the inner repo,
+// when negative caching is enabled.
+type tombstone struct{}
+
+// SetNegativeCaching enables caching of IDs that FindByIds could not find in
+// the inner repo, so that they are not queried again until saved.
+func (r *Repo) SetNegativeCaching(enabled bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.negative = enabled
+}
+
+// FindByIds implements the FindByIds method of the eventhorizon.ReadRepo interface.
+// Cached entities are served from the cache, and the misses are fetched from the
+// inner repo with a single FindByIds call.
+func (r *Repo) FindByIds(ns string, ids []eventbus.DataId) ([]eventbus.Data, error) {
+	c := r.lru(namespace(ns))
+	if c == nil {
+		return r.ReadWriteRepo.FindByIds(ns, ids)
+	}
+
+	found := make(map[eventbus.DataId]eventbus.Data, len(ids))
+	var misses []eventbus.DataId
+	for _, id := range ids {
+		v, ok := c.Get(id)
+		if !ok {
+			misses = append(misses, id)
+			continue
+		}
+		if entity, ok := v.(eventbus.Data); ok {
+			found[id] = entity
+		}
+	}
+
+	r.hits(namespace(ns), len(ids)-len(misses))
+	r.misses(namespace(ns), len(misses))
+
+	if len(misses) > 0 {
+		entities, err := r.ReadWriteRepo.FindByIds(ns, misses)
+		if err != nil {
+			return nil, err
+		}
+		for _, entity := range entities {
+			found[entity.Id()] = entity
+			c.Add(entity.Id(), entity)
+		}
+
+		r.mu.RLock()
+		negative := r.negative
+		r.mu.RUnlock()
+		if negative {
+			for _, id := range misses {
+				if _, ok := found[id]; !ok {
+					c.Add(id, tombstone{})
+				}
+			}
+		}
+	}
+
+	result := make([]eventbus.Data, 0, len(found))
+	for _, id := range ids {
+		if entity, ok := found[id]; ok {
+			result = append(result, entity)
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,63 @@
+package cache
+
+import (
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo/mocks"
+	"reflect"
+	"testing"
+)
+
+// idsRepo records the IDs passed to FindByIds.
+type idsRepo struct {
+	*mocks.Repo
+	ids [][]eventbus.DataId
+}
+
+func (r *idsRepo) FindByIds(ns string, ids []eventbus.DataId) ([]eventbus.Data, error) {
+	r.ids = append(r.ids, ids)
+	return r.Repo.FindByIds(ns, ids)
+}
+
+func TestRepoFindByIds(t *testing.T) {
+	inner := &idsRepo{Repo: mocks.NewRepo()}
+	r := NewRepo(inner)
+	if err := r.Register(mocks.ModelType, 10); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	r.SetNegativeCaching(true)
+	ns := string(mocks.ModelType)
+
+	for _, id := range []eventbus.DataId{"1", "2", "3"} {
+		if err := inner.Save(&mocks.Model{ID: id}); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+	if _, err := r.FindById(ns, "2"); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	entities, err := r.FindByIds(ns, []eventbus.DataId{"1", "2", "3", "4"})
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(entities) != 3 || entities[0].Id() != "1" || entities[1].Id() != "2" || entities[2].Id() != "3" {
+		t.Error("the found entities should be returned in order:", entities)
+	}
+	if !reflect.DeepEqual(inner.ids, [][]eventbus.DataId{{"1", "3", "4"}}) {
+		t.Error("the inner repo should be queried for the misses only:", inner.ids)
+	}
+
+	// The results and the missing ID are cached.
+	if _, err := r.FindByIds(ns, []eventbus.DataId{"1", "2", "3", "4"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(inner.ids) != 1 {
+		t.Error("the inner repo should not be queried again:", inner.ids)
+	}
+	if _, err := r.FindById(ns, "4"); !isNotFound(err) {
+		t.Error("the missing ID should be cached as not found:", err)
+	}
+	if n := inner.Calls("FindById"); n != 1 {
+		t.Error("the inner repo should not be queried for the missing ID:", n)
+	}
+}
@@ -0,0 +1,61 @@
+package cache
+
+import (
+	"github.com/jeek120/eventbus"
+)
+
+// BulkSaver is implemented by repos that can save many entities at once, like
+// the MongoDB repo.
+type BulkSaver interface {
+	SaveAll(datas []eventbus.Data) error
+}
+
+// SetWriteThrough makes saves store the saved entities in the cache, instead
+// of only removing them from it.
+func (r *Repo) SetWriteThrough(enabled bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.writeThrough = enabled
+}
+
+// SaveAll saves many entities with the SaveAll of the inner repo, or one by one
+// if it does not implement BulkSaver. The saved entities are cached under
+// write-through, and removed from the cache otherwise.
+func (r *Repo) SaveAll(datas []eventbus.Data) error {
+	b, ok := r.ReadWriteRepo.(BulkSaver)
+	if !ok {
+		for _, data := range datas {
+			if err := r.Save(data); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	nss := map[namespace]bool{}
+	for _, data := range datas {
+		r.bust(data)
+		nss[namespace(data.DataType())] = true
+	}
+
+	// The lists and dependents are invalidated after the write so that a
+	// concurrent read can not store a value read before the write.
+	defer func() {
+		for ns := range nss {
+			r.invalidateList(ns)
+		}
+		for _, data := range datas {
+			r.evictDependents(data)
+		}
+	}()
+
+	if err := b.SaveAll(datas); err != nil {
+		return err
+	}
+	for _, data := range datas {
+		r.saved(data)
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo/mocks"
+	"testing"
+)
+
+// bulkRepo implements BulkSaver on the mock repo.
+type bulkRepo struct {
+	*mocks.Repo
+}
+
+func (r *bulkRepo) SaveAll(datas []eventbus.Data) error {
+	for _, data := range datas {
+		if err := r.Repo.Save(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestRepoSaveAllWriteThrough(t *testing.T) {
+	inner := &bulkRepo{mocks.NewRepo()}
+	r := NewRepo(inner)
+	if err := r.Register(mocks.ModelType, 10); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	r.SetWriteThrough(true)
+	ns := string(mocks.ModelType)
+
+	if err := r.SaveAll([]eventbus.Data{&mocks.Model{ID: "1"}, &mocks.Model{ID: "2"}}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if n := inner.Calls("Save"); n != 2 {
+		t.Error("the entities should be saved with SaveAll:", n)
+	}
+
+	entities, err := r.FindByIds(ns, []eventbus.DataId{"1", "2"})
+	if err != nil || len(entities) != 2 {
+		t.Fatal("the entities should be found:", entities, err)
+	}
+	if n := inner.Calls("FindByIds"); n != 0 {
+		t.Error("the saved entities should be read from the cache:", n)
+	}
+	if s := r.Stats(mocks.ModelType); s.Hits != 2 || s.Misses != 0 {
+		t.Errorf("the reads should be cache hits: %+v", s)
+	}
+}
+
+func TestRepoSaveAllInvalidate(t *testing.T) {
+	inner := &bulkRepo{mocks.NewRepo()}
+	r := NewRepo(inner)
+	if err := r.Register(mocks.ModelType, 10); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	ns := string(mocks.ModelType)
+
+	if err := r.Save(&mocks.Model{ID: "1", Content: "old"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if _, err := r.FindById(ns, "1"); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	if err := r.SaveAll([]eventbus.Data{&mocks.Model{ID: "1", Content: "new"}, &mocks.Model{ID: "2"}}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if n := r.Len(mocks.ModelType); n != 0 {
+		t.Error("the saved entities should be removed from the cache:", n)
+	}
+	entities, err := r.FindByIds(ns, []eventbus.DataId{"1", "2"})
+	if err != nil || len(entities) != 2 || entities[0].(*mocks.Model).Content != "new" {
+		t.Error("the saved entities should be read from the inner repo:", entities, err)
+	}
+}
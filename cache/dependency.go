@@ -0,0 +1,45 @@
+package cache
+
+import (
+	"github.com/jeek120/eventbus"
+)
+
+// dependency is a namespace with entities derived from the entities of another
+// namespace.
+type dependency struct {
+	dependent namespace
+	keyFn     func(source eventbus.Data) []eventbus.DataId
+}
+
+// RegisterDependency registers that the entities of the dependent namespace are
+// derived from the entities of the source namespace. A save or remove of a
+// source entity evicts the dependent entities with the IDs returned by keyFn,
+// and the cached list of the dependent namespace.
+func (r *Repo) RegisterDependency(dependent, source eventbus.DataType, keyFn func(source eventbus.Data) []eventbus.DataId) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.deps == nil {
+		r.deps = map[namespace][]dependency{}
+	}
+	r.deps[namespace(source)] = append(r.deps[namespace(source)], dependency{
+		dependent: namespace(dependent),
+		keyFn:     keyFn,
+	})
+}
+
+// evictDependents evicts the entities derived from a source entity.
+func (r *Repo) evictDependents(source eventbus.Data) {
+	r.mu.RLock()
+	deps := r.deps[namespace(source.DataType())]
+	r.mu.RUnlock()
+
+	for _, dep := range deps {
+		if c := r.lru(dep.dependent); c != nil {
+			for _, id := range dep.keyFn(source) {
+				c.Remove(id)
+			}
+		}
+		r.invalidateList(dep.dependent)
+	}
+}
@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo/mocks"
+	"testing"
+)
+
+const summaryType eventbus.DataType = "Summary"
+
+type summary struct {
+	ID eventbus.DataId
+}
+
+func (s *summary) Id() eventbus.DataId         { return s.ID }
+func (s *summary) DataType() eventbus.DataType { return summaryType }
+
+func TestRepoRegisterDependency(t *testing.T) {
+	inner := mocks.NewRepo()
+	r := NewRepo(inner)
+	for _, ns := range []eventbus.DataType{mocks.ModelType, summaryType} {
+		if err := r.Register(ns, 10); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+	r.RegisterDependency(summaryType, mocks.ModelType, func(source eventbus.Data) []eventbus.DataId {
+		return []eventbus.DataId{"summary-" + source.Id()}
+	})
+
+	for _, id := range []eventbus.DataId{"summary-1", "summary-2"} {
+		if err := inner.Save(&summary{ID: id}); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+		if _, err := r.FindById(string(summaryType), id); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+
+	// A save of a source evicts its dependent only.
+	if err := r.Save(&mocks.Model{ID: "1"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	inner.ResetCalls()
+	for _, id := range []eventbus.DataId{"summary-1", "summary-2"} {
+		if _, err := r.FindById(string(summaryType), id); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+	if n := inner.Calls("FindById"); n != 1 {
+		t.Error("only the dependent of the saved source should be evicted:", n)
+	}
+
+	// A remove of a source evicts its dependent.
+	if err := inner.Save(&mocks.Model{ID: "2"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := r.Remove(&mocks.Model{ID: "2"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	inner.ResetCalls()
+	if _, err := r.FindById(string(summaryType), "summary-2"); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if n := inner.Calls("FindById"); n != 1 {
+		t.Error("the dependent of the removed source should be evicted:", n)
+	}
+
+	// A save of a dependent does not evict other entities.
+	if err := r.Save(&summary{ID: "summary-3"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	inner.ResetCalls()
+	r.FindById(string(summaryType), "summary-1")
+	r.FindById(string(summaryType), "summary-2")
+	if n := inner.Calls("FindById"); n != 0 {
+		t.Error("the other dependents should stay cached:", n)
+	}
+}
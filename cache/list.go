@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"github.com/jeek120/eventbus"
+	"time"
+)
+
+// list is a cached FindAll result for a namespace.
+type list struct {
+	ttl      time.Duration
+	entities []eventbus.Data
+	expires  time.Time
+	// gen is bumped on every invalidation, so that a FindAll racing with a
+	// write does not store a stale result.
+	gen uint64
+}
+
+// SetListCacheTTL enables caching of the full FindAll result of a namespace
+// for the given TTL. The cached list is invalidated by any Save or Remove in
+// the namespace. A TTL of 0 disables list caching.
+func (r *Repo) SetListCacheTTL(ns eventbus.DataType, ttl time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if ttl <= 0 {
+		delete(r.lists, namespace(ns))
+		return
+	}
+
+	r.lists[namespace(ns)] = &list{ttl: ttl}
+}
+
+// cachedList returns the cached FindAll result of a namespace, and the
+// generation to pass to storeList on a miss.
+func (r *Repo) cachedList(ns namespace) ([]eventbus.Data, uint64, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	l, ok := r.lists[ns]
+	if !ok {
+		return nil, 0, false
+	}
+	if l.entities == nil || time.Now().After(l.expires) {
+		return nil, l.gen, false
+	}
+
+	entities := make([]eventbus.Data, len(l.entities))
+	copy(entities, l.entities)
+	return entities, l.gen, true
+}
+
+func (r *Repo) storeList(ns namespace, gen uint64, entities []eventbus.Data) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	l, ok := r.lists[ns]
+	if !ok || l.gen != gen {
+		return
+	}
+
+	l.entities = make([]eventbus.Data, len(entities))
+	copy(l.entities, entities)
+	l.expires = time.Now().Add(l.ttl)
+}
+
+func (r *Repo) invalidateList(ns namespace) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if l, ok := r.lists[ns]; ok {
+		l.entities = nil
+		l.gen++
+	}
+}
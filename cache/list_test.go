@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"github.com/jeek120/repo/mocks"
+	"testing"
+	"time"
+)
+
+func TestRepoListCache(t *testing.T) {
+	inner := mocks.NewRepo()
+	r := NewRepo(inner)
+	r.SetListCacheTTL(mocks.ModelType, time.Minute)
+	ns := string(mocks.ModelType)
+
+	if err := inner.Save(&mocks.Model{ID: "1"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if entities, err := r.FindAll(ns); err != nil || len(entities) != 1 {
+			t.Error("there should be one entity:", entities, err)
+		}
+	}
+	if n := inner.Calls("FindAll"); n != 1 {
+		t.Error("the second FindAll should be cached:", n)
+	}
+	if n, err := r.Count(ns); err != nil || n != 1 || inner.Calls("Count") != 0 {
+		t.Error("the cached list should be counted:", n, err)
+	}
+
+	// A save invalidates the list.
+	if err := r.Save(&mocks.Model{ID: "2"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if entities, err := r.FindAll(ns); err != nil || len(entities) != 2 {
+		t.Error("the saved entity should be listed:", entities, err)
+	}
+	if n := inner.Calls("FindAll"); n != 2 {
+		t.Error("the list should be read again after a save:", n)
+	}
+
+	// A remove invalidates the list.
+	if err := r.Remove(&mocks.Model{ID: "1"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if entities, err := r.FindAll(ns); err != nil || len(entities) != 1 {
+		t.Error("the removed entity should not be listed:", entities, err)
+	}
+	if n := inner.Calls("FindAll"); n != 3 {
+		t.Error("the list should be read again after a remove:", n)
+	}
+}
+
+func TestRepoListCacheTTL(t *testing.T) {
+	inner := mocks.NewRepo()
+	r := NewRepo(inner)
+	r.SetListCacheTTL(mocks.ModelType, time.Millisecond)
+	ns := string(mocks.ModelType)
+
+	if _, err := r.FindAll(ns); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, err := r.FindAll(ns); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if n := inner.Calls("FindAll"); n != 2 {
+		t.Error("the list should expire after the TTL:", n)
+	}
+
+	// Disabled list caching always reads the inner repo.
+	r.SetListCacheTTL(mocks.ModelType, 0)
+	r.FindAll(ns)
+	r.FindAll(ns)
+	if n := inner.Calls("FindAll"); n != 4 {
+		t.Error("the list should not be cached:", n)
+	}
+}
@@ -1,11 +1,21 @@
 package cache
 
 import (
+	"errors"
+	"fmt"
 	lru "github.com/hashicorp/golang-lru"
 	"github.com/jeek120/eventbus"
 	"github.com/jeek120/repo"
+	"sort"
+	"sync"
 )
 
+// ErrNamespaceAlreadyRegistered is when a namespace is registered twice.
+var ErrNamespaceAlreadyRegistered = errors.New("namespace already registered")
+
+// ErrNamespaceNotRegistered is when a namespace must be registered but is not.
+var ErrNamespaceNotRegistered = errors.New("namespace not registered")
+
 type namespace eventbus.DataType
 
 // Repo is a middleware that adds caching to a read repository. It will update
@@ -14,14 +24,24 @@ type namespace eventbus.DataType
 // Note that there is no limit to the cache size.
 type Repo struct {
 	repo.ReadWriteRepo
-	cache map[namespace]*lru.Cache
+	cache map[namespace]store
+	lists map[namespace]*list
+	mu    sync.RWMutex
+
+	negative     bool
+	autoSize     int
+	writeThrough bool
+	subs         subscribers
+	stats        stats
+	deps         map[namespace][]dependency
 }
 
 // NewRepo creates a new Repo.
 func NewRepo(repo repo.ReadWriteRepo) *Repo {
 	return &Repo{
 		ReadWriteRepo: repo,
-		cache:         make(map[namespace]*lru.Cache, 0),
+		cache:         make(map[namespace]store, 0),
+		lists:         make(map[namespace]*list),
 	}
 }
 
@@ -32,94 +52,419 @@ func (r *Repo) Parent() repo.ReadRepo {
 
 // Find implements the Find method of the eventhorizon.ReadModel interface.
 func (r *Repo) FindById(ns string, id eventbus.DataId) (eventbus.Data, error) {
-	entity, ok := r.cache[namespace(ns)].Get(id)
+	c := r.lru(namespace(ns))
+	if c == nil {
+		return r.ReadWriteRepo.FindById(ns, id)
+	}
+
+	entity, ok := c.Get(id)
 	if ok {
-		return entity.(eventbus.Data), nil
+		r.hits(namespace(ns), 1)
+		return cached(entity)
 	}
+	r.misses(namespace(ns), 1)
 
 	// Fetch and store the entity in the cache.
 	entity, err := r.ReadWriteRepo.FindById(ns, id)
 	if err != nil {
 		return nil, err
 	}
-	r.cache[namespace(ns)].Add(id, entity)
+	c.Add(id, entity)
 
 	return entity.(eventbus.Data), nil
 }
 
 // Find implements the Find method of the eventhorizon.ReadModel interface.
 func (r *Repo) Find(data eventbus.Data) (eventbus.Data, error) {
-	ns := namespace(data.DataType())
+	c := r.lru(namespace(data.DataType()))
+	if c == nil {
+		return r.ReadWriteRepo.Find(data)
+	}
 
-	entity, ok := r.cache[ns].Get(data.Id())
+	entity, ok := c.Get(data.Id())
 	if ok {
-		return entity.(eventbus.Data), nil
+		r.hits(namespace(data.DataType()), 1)
+		return cached(entity)
 	}
+	r.misses(namespace(data.DataType()), 1)
 
 	// Fetch and store the entity in the cache.
 	entity, err := r.ReadWriteRepo.Find(data)
 	if err != nil {
 		return nil, err
 	}
-	r.cache[ns].Add(data.Id(), entity)
+	c.Add(data.Id(), entity)
 
 	return entity.(eventbus.Data), nil
 }
 
 // FindAll implements the FindAll method of the eventhorizon.ReadRepo interface.
 func (r *Repo) FindAll(ns string) ([]eventbus.Data, error) {
+	entities, gen, ok := r.cachedList(namespace(ns))
+	if ok {
+		return entities, nil
+	}
+
 	entities, err := r.ReadWriteRepo.FindAll(ns)
 	if err != nil {
 		return nil, err
 	}
+	r.storeList(namespace(ns), gen, entities)
 
 	// Cache all items.
 	for _, entity := range entities {
 		data := entity.(eventbus.Data)
-		r.cache[namespace(data.DataType())].Add(data.Id(), data)
+		if c := r.lru(namespace(data.DataType())); c != nil {
+			if cached, ok := c.Peek(data.Id()); !ok || !isOlder(data, cached) {
+				c.Add(data.Id(), data)
+			}
+		}
 	}
 
 	return entities, nil
 }
 
+// Count implements the Count method of the eventhorizon.ReadRepo interface.
+// Counts are not cached, but a cached list of the namespace is counted.
+func (r *Repo) Count(ns string) (int64, error) {
+	if entities, _, ok := r.cachedList(namespace(ns)); ok {
+		return int64(len(entities)), nil
+	}
+
+	return r.ReadWriteRepo.Count(ns)
+}
+
+// ProjectedFinder is implemented by repos that can read entities with only
+// some of their fields, like the MongoDB repo.
+type ProjectedFinder interface {
+	FindByIdProjected(ns string, id eventbus.DataId, fields ...string) (eventbus.Data, error)
+}
+
+// FindByIdProjected reads a partial entity from the inner repo, if it
+// implements ProjectedFinder. Partial entities bypass the cache so that they
+// are never returned by a full read. If the inner repo can't read partial
+// entities the full entity is returned.
+func (r *Repo) FindByIdProjected(ns string, id eventbus.DataId, fields ...string) (eventbus.Data, error) {
+	p, ok := r.ReadWriteRepo.(ProjectedFinder)
+	if !ok {
+		return r.FindById(ns, id)
+	}
+
+	return p.FindByIdProjected(ns, id, fields...)
+}
+
+// FindAllIter implements the FindAllIter method of the eventhorizon.ReadRepo
+// interface. Streamed results are not cached, the call goes to the inner repo.
+func (r *Repo) FindAllIter(ns string) (repo.Iter, error) {
+	return r.ReadWriteRepo.FindAllIter(ns)
+}
+
 // Save implements the Save method of the eventhorizon.WriteRepo interface.
 func (r *Repo) Save(data eventbus.Data) error {
-	// Bust the cache on save.
-	r.cache[namespace(data.DataType())].Remove(data.Id())
+	return r.save(data, func() error {
+		return r.ReadWriteRepo.Save(data)
+	})
+}
+
+// Upserter is implemented by repos that report whether a save inserted the
+// entity, like the MongoDB repo.
+type Upserter interface {
+	Upsert(data eventbus.Data) (bool, error)
+}
+
+// Upsert saves the entity like Save and returns whether it was inserted, if
+// the inner repo implements Upserter. Otherwise the entity is saved with Save
+// and false is returned.
+func (r *Repo) Upsert(data eventbus.Data) (bool, error) {
+	u, ok := r.ReadWriteRepo.(Upserter)
+	if !ok {
+		return false, r.Save(data)
+	}
+
+	var created bool
+	err := r.save(data, func() (err error) {
+		created, err = u.Upsert(data)
+		return
+	})
+	return created, err
+}
 
-	return r.ReadWriteRepo.Save(data)
+// save runs the write of the entity and keeps the cache coherent with it.
+func (r *Repo) save(data eventbus.Data, write func() error) error {
+	r.bust(data)
+
+	// The list and dependents are invalidated after the write so that a
+	// concurrent read can not store a value read before the write.
+	defer r.evictDependents(data)
+	defer r.invalidateList(namespace(data.DataType()))
+
+	if err := write(); err != nil {
+		return err
+	}
+	r.saved(data)
+
+	return nil
+}
+
+// bust removes an entity about to be saved from the cache, unless a newer
+// version is cached.
+func (r *Repo) bust(data eventbus.Data) {
+	if c := r.lru(namespace(data.DataType())); c != nil {
+		if cached, ok := c.Peek(data.Id()); !ok || !isOlder(data, cached) {
+			c.Remove(data.Id())
+		}
+	}
+}
+
+// saved caches a saved entity under write-through and notifies subscribers.
+func (r *Repo) saved(data eventbus.Data) {
+	r.mu.RLock()
+	writeThrough := r.writeThrough
+	r.mu.RUnlock()
+
+	if c := r.lru(namespace(data.DataType())); c != nil && writeThrough {
+		if cached, ok := c.Peek(data.Id()); !ok || !isOlder(data, cached) {
+			c.Add(data.Id(), data)
+		}
+	}
+	r.publish(OpSave, data)
+}
+
+// Register registers a namespace with a cache of the given size. Operations on
+// namespaces that are not registered bypass the cache.
+func (r *Repo) Register(ns eventbus.DataType, size int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.cache[namespace(ns)]; ok {
+		return fmt.Errorf("%w: %s", ErrNamespaceAlreadyRegistered, ns)
+	}
+
+	c, err := lru.New(size)
+	if err != nil {
+		return fmt.Errorf("cache namespace(%s): %w", ns, err)
+	}
+	r.cache[namespace(ns)] = c
+
+	return nil
 }
 
-func (r *Repo) Register(ns eventbus.DataType, size int) {
-	if _, ok := r.cache[namespace(ns)]; !ok {
+// MustRegister is like Register but panics if the namespace can not be
+// registered.
+func (r *Repo) MustRegister(ns eventbus.DataType, size int) {
+	if err := r.Register(ns, size); err != nil {
+		panic(err)
+	}
+}
+
+// RegisterAll registers many namespaces with their cache sizes. No namespace
+// is registered if any of them is already registered.
+func (r *Repo) RegisterAll(specs map[eventbus.DataType]int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for ns := range specs {
+		if _, ok := r.cache[namespace(ns)]; ok {
+			return fmt.Errorf("%w: %s", ErrNamespaceAlreadyRegistered, ns)
+		}
+	}
+
+	caches := make(map[namespace]*lru.Cache, len(specs))
+	for ns, size := range specs {
 		c, err := lru.New(size)
 		if err != nil {
-			panic(err)
+			return fmt.Errorf("cache namespace(%s): %w", ns, err)
 		}
-		r.cache[namespace(ns)] = c
-	} else {
-		panic("cache namespace(" + ns + ") alrealy registed.")
+		caches[namespace(ns)] = c
+	}
+	for ns, c := range caches {
+		r.cache[ns] = c
 	}
+
+	return nil
+}
+
+// Resize changes the size of the cache of a namespace. Shrinking it evicts the
+// least recently used entities.
+func (r *Repo) Resize(ns eventbus.DataType, size int) error {
+	r.mu.RLock()
+	c, ok := r.cache[namespace(ns)]
+	r.mu.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNamespaceNotRegistered, ns)
+	}
+	if size <= 0 {
+		return fmt.Errorf("cache namespace(%s): must provide a positive size", ns)
+	}
+	c.Resize(size)
+
+	return nil
 }
 
 func (r *Repo) Merge(data eventbus.Data, merge func(old eventbus.Data)) bool {
 	// Bust the cache on save.
-	if _old, ok := r.cache[namespace(data.DataType())].Get(data.Id()); ok {
-		old := _old.(eventbus.Data)
-		merge(old)
-		return ok
-	} else {
-		r.cache[namespace(data.DataType())].Add(data.Id(), data)
-		return ok
+	c := r.lru(namespace(data.DataType()))
+	if c == nil {
+		return false
+	}
+
+	if _old, ok := c.Get(data.Id()); ok {
+		// A tombstone is replaced like a miss.
+		if old, ok := _old.(eventbus.Data); ok {
+			// Discard out of order updates.
+			if !isOlder(data, old) {
+				merge(old)
+			}
+			return ok
+		}
+	}
+
+	c.Add(data.Id(), data)
+	return false
+}
+
+// Populate caches an entity read from elsewhere, like a slower cache tier,
+// without writing it to the inner repo. A newer cached version is kept.
+func (r *Repo) Populate(data eventbus.Data) {
+	if c := r.lru(namespace(data.DataType())); c != nil {
+		if cached, ok := c.Peek(data.Id()); !ok || !isOlder(data, cached) {
+			c.Add(data.Id(), data)
+		}
+	}
+}
+
+// Evict removes an entity and the list of its namespace from the cache, without
+// removing it from the inner repo.
+func (r *Repo) Evict(data eventbus.Data) {
+	if c := r.lru(namespace(data.DataType())); c != nil {
+		c.Remove(data.Id())
+	}
+	r.invalidateList(namespace(data.DataType()))
+}
+
+// Namespaces returns the registered namespaces.
+func (r *Repo) Namespaces() []eventbus.DataType {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	nss := make([]eventbus.DataType, 0, len(r.cache))
+	for ns := range r.cache {
+		nss = append(nss, eventbus.DataType(ns))
 	}
+	sort.Slice(nss, func(i, j int) bool { return nss[i] < nss[j] })
+
+	return nss
+}
+
+// Len returns the number of cached entities in a namespace.
+func (r *Repo) Len(ns eventbus.DataType) int {
+	c := r.lru(namespace(ns))
+	if c == nil {
+		return 0
+	}
+
+	return c.Len()
 }
 
 // Remove implements the Remove method of the eventhorizon.WriteRepo interface.
 func (r *Repo) Remove(data eventbus.Data) error {
 	// Bust the cache on remove.
-	r.cache[namespace(data.DataType())].Remove(data.Id())
+	if c := r.lru(namespace(data.DataType())); c != nil {
+		c.Remove(data.Id())
+	}
+
+	// The list and dependents are invalidated after the write so that a
+	// concurrent read can not store a value read before the write.
+	defer r.evictDependents(data)
+	defer r.invalidateList(namespace(data.DataType()))
+
+	if err := r.ReadWriteRepo.Remove(data); err != nil {
+		return err
+	}
+	r.publish(OpRemove, data)
+
+	return nil
+}
+
+// RemoveIfExists removes the entity like Remove, but returns false instead of
+// ErrEntityNotFound if it does not exist. The cache is invalidated in
+// both cases.
+func (r *Repo) RemoveIfExists(data eventbus.Data) (bool, error) {
+	err := r.Remove(data)
+	if rrErr, ok := err.(repo.RepoError); ok && rrErr.Err == repo.ErrEntityNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Versioned is implemented by entities with a version. The cache never replaces
+// a cached entity with an older version of it.
+type Versioned interface {
+	Version() int
+}
+
+// isOlder returns whether data is an older version than the cached value.
+func isOlder(data eventbus.Data, cached interface{}) bool {
+	v, ok := data.(Versioned)
+	if !ok {
+		return false
+	}
+	cv, ok := cached.(Versioned)
+	if !ok {
+		return false
+	}
+	return v.Version() < cv.Version()
+}
+
+// cached returns a cached value, which may be a tombstone for a missing entity.
+func cached(v interface{}) (eventbus.Data, error) {
+	if _, ok := v.(tombstone); ok {
+		return nil, repo.RepoError{
+			Err: repo.ErrEntityNotFound,
+		}
+	}
+
+	return v.(eventbus.Data), nil
+}
+
+// SetAutoRegister makes the repo register namespaces with a cache of size on
+// their first use, instead of bypassing the cache. A size of 0 disables it.
+func (r *Repo) SetAutoRegister(size int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.autoSize = size
+}
+
+// lru returns the cache for a namespace, or nil if it is not registered and
+// auto registration is disabled.
+func (r *Repo) lru(ns namespace) store {
+	r.mu.RLock()
+	c, autoSize := r.cache[ns], r.autoSize
+	r.mu.RUnlock()
+
+	if c != nil || autoSize <= 0 {
+		return c
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Another call may have registered it in the meantime.
+	if c, ok := r.cache[ns]; ok {
+		return c
+	}
+	c, err := lru.New(r.autoSize)
+	if err != nil {
+		return nil
+	}
+	r.cache[ns] = c
 
-	return r.ReadWriteRepo.Remove(data)
+	return c
 }
 
 // Repository returns a parent ReadRepo if there is one.
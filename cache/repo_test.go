@@ -0,0 +1,483 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo"
+	"github.com/jeek120/repo/mocks"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func isNotFound(err error) bool {
+	rrErr, ok := err.(repo.RepoError)
+	return ok && rrErr.Err == repo.ErrEntityNotFound
+}
+
+func TestRepoNamespaces(t *testing.T) {
+	r := NewRepo(mocks.NewRepo())
+	if nss := r.Namespaces(); len(nss) != 0 {
+		t.Error("there should be no namespaces:", nss)
+	}
+
+	if err := r.Register("Order", 10); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := r.Register(mocks.ModelType, 10); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if nss := r.Namespaces(); !reflect.DeepEqual(nss, []eventbus.DataType{mocks.ModelType, "Order"}) {
+		t.Error("both namespaces should be listed:", nss)
+	}
+
+	if err := r.Save(&mocks.Model{ID: "1"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := r.Save(&mocks.Model{ID: "2"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	for _, id := range []eventbus.DataId{"1", "2"} {
+		if _, err := r.FindById(string(mocks.ModelType), id); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+	if n := r.Len(mocks.ModelType); n != 2 {
+		t.Error("there should be two cached entities:", n)
+	}
+	if n := r.Len("Order"); n != 0 {
+		t.Error("there should be no cached entities:", n)
+	}
+	if n := r.Len("Other"); n != 0 {
+		t.Error("there should be no cached entities:", n)
+	}
+}
+
+func TestRepoRegisterAll(t *testing.T) {
+	r := NewRepo(mocks.NewRepo())
+	if err := r.Register("Order", 10); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	if err := r.RegisterAll(map[eventbus.DataType]int{mocks.ModelType: 10, "User": 5}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if nss := r.Namespaces(); !reflect.DeepEqual(nss, []eventbus.DataType{mocks.ModelType, "Order", "User"}) {
+		t.Error("all namespaces should be registered:", nss)
+	}
+
+	// A duplicate fails without registering any of the namespaces.
+	err := r.RegisterAll(map[eventbus.DataType]int{"Account": 10, "Order": 10})
+	if !errors.Is(err, ErrNamespaceAlreadyRegistered) || !strings.Contains(err.Error(), "Order") {
+		t.Error("there should be an already registered error naming the namespace:", err)
+	}
+	if nss := r.Namespaces(); len(nss) != 3 {
+		t.Error("no namespace should be registered:", nss)
+	}
+}
+
+func TestRepoRegister(t *testing.T) {
+	r := NewRepo(mocks.NewRepo())
+	if err := r.Register(mocks.ModelType, 10); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := r.Register(mocks.ModelType, 10); !errors.Is(err, ErrNamespaceAlreadyRegistered) {
+		t.Error("there should be an already registered error:", err)
+	}
+	if err := r.Register("Order", 0); err == nil {
+		t.Error("there should be an error for an invalid size")
+	}
+	if nss := r.Namespaces(); len(nss) != 1 {
+		t.Error("only the first namespace should be registered:", nss)
+	}
+}
+
+func TestRepoMustRegister(t *testing.T) {
+	r := NewRepo(mocks.NewRepo())
+	r.MustRegister(mocks.ModelType, 10)
+
+	defer func() {
+		if err, ok := recover().(error); !ok || !errors.Is(err, ErrNamespaceAlreadyRegistered) {
+			t.Error("there should be a panic with an already registered error:", err)
+		}
+	}()
+	r.MustRegister(mocks.ModelType, 10)
+}
+
+// versionedModel is an entity with a version.
+type versionedModel struct {
+	ID eventbus.DataId
+	V  int
+}
+
+func (m *versionedModel) Id() eventbus.DataId         { return m.ID }
+func (m *versionedModel) DataType() eventbus.DataType { return mocks.ModelType }
+func (m *versionedModel) Version() int                { return m.V }
+
+func TestRepoVersions(t *testing.T) {
+	r := NewRepo(mocks.NewRepo())
+	if err := r.Register(mocks.ModelType, 10); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	r.SetWriteThrough(true)
+	ns := string(mocks.ModelType)
+
+	if err := r.Save(&versionedModel{ID: "1", V: 2}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := r.Save(&versionedModel{ID: "1", V: 1}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if entity, err := r.FindById(ns, "1"); err != nil || entity.(*versionedModel).V != 2 {
+		t.Error("the newer version should be kept in the cache:", entity, err)
+	}
+
+	// Out of order merges are discarded.
+	merged := false
+	if !r.Merge(&versionedModel{ID: "1", V: 1}, func(eventbus.Data) { merged = true }) || merged {
+		t.Error("the older version should not be merged")
+	}
+	if !r.Merge(&versionedModel{ID: "1", V: 2}, func(eventbus.Data) { merged = true }) || !merged {
+		t.Error("the same version should be merged")
+	}
+
+	if err := r.Save(&versionedModel{ID: "1", V: 3}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if entity, err := r.FindById(ns, "1"); err != nil || entity.(*versionedModel).V != 3 {
+		t.Error("the newer version should replace the cached one:", entity, err)
+	}
+}
+
+func TestRepoFindAllIter(t *testing.T) {
+	inner := mocks.NewRepo()
+	r := NewRepo(inner)
+	if err := r.Register(mocks.ModelType, 10); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	ns := string(mocks.ModelType)
+
+	for _, id := range []eventbus.DataId{"1", "2"} {
+		if err := inner.Save(&mocks.Model{ID: id}); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+
+	// Streaming is not cached, every call goes to the inner repo.
+	for n := 1; n <= 2; n++ {
+		i, err := r.FindAllIter(ns)
+		if err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+		count := 0
+		for i.Next(context.Background()) {
+			count++
+		}
+		if err := i.Close(context.Background()); err != nil || count != 2 {
+			t.Error("all entities should be iterated:", count, err)
+		}
+		if c := inner.Calls("FindAllIter"); c != n {
+			t.Error("the inner repo should be called:", c)
+		}
+	}
+	if n := r.Len(mocks.ModelType); n != 0 {
+		t.Error("the streamed entities should not be cached:", n)
+	}
+
+	inner.SetError(repo.RepoError{Err: errors.New("error")})
+	if _, err := r.FindAllIter(ns); err == nil {
+		t.Error("there should be an error")
+	}
+}
+
+// upsertRepo implements Upserter on the mock repo.
+type upsertRepo struct {
+	*mocks.Repo
+}
+
+func (r *upsertRepo) Upsert(data eventbus.Data) (bool, error) {
+	_, err := r.FindById(string(data.DataType()), data.Id())
+	created := isNotFound(err)
+	return created, r.Save(data)
+}
+
+func TestRepoUpsert(t *testing.T) {
+	inner := &upsertRepo{mocks.NewRepo()}
+	r := NewRepo(inner)
+	if err := r.Register(mocks.ModelType, 10); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	ns := string(mocks.ModelType)
+
+	if created, err := r.Upsert(&mocks.Model{ID: "1", Content: "a"}); err != nil || !created {
+		t.Error("the entity should be created:", created, err)
+	}
+	if _, err := r.FindById(ns, "1"); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if created, err := r.Upsert(&mocks.Model{ID: "1", Content: "b"}); err != nil || created {
+		t.Error("the entity should be updated:", created, err)
+	}
+	if entity, err := r.FindById(ns, "1"); err != nil || entity.(*mocks.Model).Content != "b" {
+		t.Error("the cached entity should be invalidated:", entity, err)
+	}
+
+	// Without an Upserter the entity is saved.
+	plain := NewRepo(mocks.NewRepo())
+	if created, err := plain.Upsert(&mocks.Model{ID: "1"}); err != nil || created {
+		t.Error("the entity should be saved without the flag:", created, err)
+	}
+	if _, err := plain.FindById(ns, "1"); err != nil {
+		t.Error("the entity should be saved:", err)
+	}
+}
+
+func TestRepoAutoRegister(t *testing.T) {
+	inner := mocks.NewRepo()
+	r := NewRepo(inner)
+	r.SetAutoRegister(10)
+	ns := string(mocks.ModelType)
+
+	if err := inner.Save(&mocks.Model{ID: "1"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	// Concurrent first uses register the namespace once.
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := r.FindById(ns, "1"); err != nil {
+				t.Error("there should be no error:", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if nss := r.Namespaces(); !reflect.DeepEqual(nss, []eventbus.DataType{mocks.ModelType}) {
+		t.Error("the namespace should be registered:", nss)
+	}
+	if n := r.Len(mocks.ModelType); n != 1 {
+		t.Error("the entity should be cached:", n)
+	}
+	inner.ResetCalls()
+	if _, err := r.FindById(ns, "1"); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if n := inner.Calls("FindById"); n != 0 {
+		t.Error("the entity should be read from the cache:", n)
+	}
+
+	// Disabled auto registration bypasses the cache.
+	r.SetAutoRegister(0)
+	if _, err := r.FindById("Other", "1"); !isNotFound(err) {
+		t.Error("there should be a not found error:", err)
+	}
+	if nss := r.Namespaces(); len(nss) != 1 {
+		t.Error("the namespace should not be registered:", nss)
+	}
+}
+
+// projectedRepo implements ProjectedFinder on the mock repo, returning the
+// entities without their content.
+type projectedRepo struct {
+	*mocks.Repo
+}
+
+func (r *projectedRepo) FindByIdProjected(ns string, id eventbus.DataId, fields ...string) (eventbus.Data, error) {
+	entity, err := r.FindById(ns, id)
+	if err != nil {
+		return nil, err
+	}
+	return &mocks.Model{ID: entity.Id()}, nil
+}
+
+func TestRepoFindByIdProjected(t *testing.T) {
+	inner := &projectedRepo{mocks.NewRepo()}
+	r := NewRepo(inner)
+	if err := r.Register(mocks.ModelType, 10); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	ns := string(mocks.ModelType)
+
+	if err := inner.Save(&mocks.Model{ID: "1", Content: "content"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	// A partial entity does not populate the cache.
+	if entity, err := r.FindByIdProjected(ns, "1", "_id"); err != nil || entity.(*mocks.Model).Content != "" {
+		t.Error("the partial entity should be returned:", entity, err)
+	}
+	if n := r.Len(mocks.ModelType); n != 0 {
+		t.Error("the partial entity should not be cached:", n)
+	}
+
+	// A cached full entity is not returned by a projected read, nor replaced.
+	if entity, err := r.FindById(ns, "1"); err != nil || entity.(*mocks.Model).Content != "content" {
+		t.Error("the full entity should be returned:", entity, err)
+	}
+	if entity, err := r.FindByIdProjected(ns, "1", "_id"); err != nil || entity.(*mocks.Model).Content != "" {
+		t.Error("the partial entity should be returned:", entity, err)
+	}
+	inner.ResetCalls()
+	if entity, err := r.FindById(ns, "1"); err != nil || entity.(*mocks.Model).Content != "content" {
+		t.Error("the full entity should still be cached:", entity, err)
+	}
+	if n := inner.Calls("FindById"); n != 0 {
+		t.Error("the full entity should be read from the cache:", n)
+	}
+}
+
+func TestRepoResize(t *testing.T) {
+	inner := mocks.NewRepo()
+	r := NewRepo(inner)
+	if err := r.Register(mocks.ModelType, 2); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	ns := string(mocks.ModelType)
+
+	ids := []eventbus.DataId{"1", "2", "3", "4"}
+	for _, id := range ids {
+		if err := inner.Save(&mocks.Model{ID: id}); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+	read := func(ids ...eventbus.DataId) {
+		for _, id := range ids {
+			if _, err := r.FindById(ns, id); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+		}
+	}
+
+	read(ids...)
+	if n := r.Len(mocks.ModelType); n != 2 {
+		t.Error("the cache should be full:", n)
+	}
+
+	// Growing keeps the cached entities and fits more.
+	if err := r.Resize(mocks.ModelType, 4); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	read(ids...)
+	if n := r.Len(mocks.ModelType); n != 4 {
+		t.Error("all entities should be cached:", n)
+	}
+
+	// Shrinking evicts the least recently used entities.
+	read("2", "1")
+	if err := r.Resize(mocks.ModelType, 2); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if n := r.Len(mocks.ModelType); n != 2 {
+		t.Error("the cache should be shrunk:", n)
+	}
+	inner.ResetCalls()
+	read("1", "2")
+	if n := inner.Calls("FindById"); n != 0 {
+		t.Error("the recently used entities should be kept:", n)
+	}
+
+	if err := r.Resize("Other", 2); !errors.Is(err, ErrNamespaceNotRegistered) {
+		t.Error("there should be a not registered error:", err)
+	}
+	if err := r.Resize(mocks.ModelType, 0); err == nil {
+		t.Error("there should be an error for an invalid size")
+	}
+}
+
+func TestRepoRemoveIfExists(t *testing.T) {
+	inner := mocks.NewRepo()
+	r := NewRepo(inner)
+	if err := r.Register(mocks.ModelType, 10); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	ns := string(mocks.ModelType)
+
+	m := &mocks.Model{ID: "1"}
+	if err := r.Save(m); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if _, err := r.FindById(ns, "1"); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if removed, err := r.RemoveIfExists(m); err != nil || !removed {
+		t.Error("the entity should be removed:", removed, err)
+	}
+
+	// A stale cached entity is invalidated even if it does not exist.
+	if err := inner.Save(m); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if _, err := r.FindById(ns, "1"); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := inner.Remove(m); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if removed, err := r.RemoveIfExists(m); err != nil || removed {
+		t.Error("there should be nothing removed:", removed, err)
+	}
+	if n := r.Len(mocks.ModelType); n != 0 {
+		t.Error("the cache should be invalidated:", n)
+	}
+
+	inner.SetError(repo.RepoError{Err: errors.New("error")})
+	if _, err := r.RemoveIfExists(m); err == nil {
+		t.Error("there should be an error")
+	}
+}
+
+func TestRepoCount(t *testing.T) {
+	inner := mocks.NewRepo()
+	r := NewRepo(inner)
+	if err := r.Register(mocks.ModelType, 10); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	ns := string(mocks.ModelType)
+
+	if err := r.Save(&mocks.Model{ID: "1"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	for i := 0; i < 2; i++ {
+		if n, err := r.Count(ns); err != nil || n != 1 {
+			t.Error("there should be one entity:", n, err)
+		}
+	}
+	if n := inner.Calls("Count"); n != 2 {
+		t.Error("the count should not be cached:", n)
+	}
+
+	inner.SetError(errors.New("error"))
+	if _, err := r.Count(ns); err == nil {
+		t.Error("the error of the inner repo should be returned")
+	}
+}
+
+func TestRepoPopulateEvict(t *testing.T) {
+	inner := mocks.NewRepo()
+	r := NewRepo(inner)
+	if err := r.Register(mocks.ModelType, 10); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	ns := string(mocks.ModelType)
+
+	r.Populate(&mocks.Model{ID: "1"})
+	if _, err := r.FindById(ns, "1"); err != nil {
+		t.Error("the populated entity should be cached:", err)
+	}
+	if inner.Calls("Save") != 0 || inner.Calls("FindById") != 0 {
+		t.Error("the inner repo should not be used")
+	}
+
+	r.Evict(&mocks.Model{ID: "1"})
+	if _, err := r.FindById(ns, "1"); !isNotFound(err) {
+		t.Error("the evicted entity should be read from the inner repo:", err)
+	}
+	if inner.Calls("Remove") != 0 || inner.Calls("FindById") != 1 {
+		t.Error("the entity should only be evicted from the cache")
+	}
+}
@@ -0,0 +1,153 @@
+package cache
+
+import (
+	"context"
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo"
+	"sync"
+)
+
+type contextKey int
+
+const sessionKey contextKey = iota
+
+// session is the state of a read-your-writes session, the entities written in
+// it. Removed entities are stored as tombstones.
+type session struct {
+	mu      sync.Mutex
+	written map[sessionEntry]interface{}
+}
+
+type sessionEntry struct {
+	ns namespace
+	id eventbus.DataId
+}
+
+// NewSessionContext returns a context starting a read-your-writes session, for
+// example for a user request. See WithContext.
+func NewSessionContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sessionKey, &session{
+		written: map[sessionEntry]interface{}{},
+	})
+}
+
+// Session is a view of the cache with read-your-writes consistency for the
+// session of a context: entities saved or removed through it are seen as such
+// by its reads, even if the inner repo reads from a lagging replica or the
+// entities were evicted from the cache. Saved entities are also written
+// through to the cache. FindAll is not affected by the session.
+type Session struct {
+	*Repo
+	s *session
+}
+
+// WithContext returns a Session for the session started by NewSessionContext
+// in ctx, or the repo itself if ctx has no session.
+func (r *Repo) WithContext(ctx context.Context) repo.ReadWriteRepo {
+	s, ok := ctx.Value(sessionKey).(*session)
+	if !ok {
+		return r
+	}
+
+	return &Session{
+		Repo: r,
+		s:    s,
+	}
+}
+
+// Find implements the Find method of the eventhorizon.ReadRepo interface.
+func (s *Session) Find(data eventbus.Data) (eventbus.Data, error) {
+	if v, ok := s.get(namespace(data.DataType()), data.Id()); ok {
+		return cached(v)
+	}
+
+	return s.Repo.Find(data)
+}
+
+// FindById implements the FindById method of the eventhorizon.ReadRepo interface.
+func (s *Session) FindById(ns string, id eventbus.DataId) (eventbus.Data, error) {
+	if v, ok := s.get(namespace(ns), id); ok {
+		return cached(v)
+	}
+
+	return s.Repo.FindById(ns, id)
+}
+
+// FindByIds implements the FindByIds method of the eventhorizon.ReadRepo interface.
+func (s *Session) FindByIds(ns string, ids []eventbus.DataId) ([]eventbus.Data, error) {
+	var misses []eventbus.DataId
+	written := map[eventbus.DataId]interface{}{}
+	for _, id := range ids {
+		if v, ok := s.get(namespace(ns), id); ok {
+			written[id] = v
+		} else {
+			misses = append(misses, id)
+		}
+	}
+
+	found := map[eventbus.DataId]eventbus.Data{}
+	if len(misses) > 0 {
+		entities, err := s.Repo.FindByIds(ns, misses)
+		if err != nil {
+			return nil, err
+		}
+		for _, entity := range entities {
+			found[entity.Id()] = entity
+		}
+	}
+
+	result := make([]eventbus.Data, 0, len(ids))
+	for _, id := range ids {
+		if v, ok := written[id]; ok {
+			if entity, ok := v.(eventbus.Data); ok {
+				result = append(result, entity)
+			}
+		} else if entity, ok := found[id]; ok {
+			result = append(result, entity)
+		}
+	}
+
+	return result, nil
+}
+
+// Save implements the Save method of the eventhorizon.WriteRepo interface.
+func (s *Session) Save(data eventbus.Data) error {
+	if err := s.Repo.Save(data); err != nil {
+		return err
+	}
+
+	if c := s.lru(namespace(data.DataType())); c != nil {
+		if cached, ok := c.Peek(data.Id()); !ok || !isOlder(data, cached) {
+			c.Add(data.Id(), data)
+		}
+	}
+	s.set(data, data)
+
+	return nil
+}
+
+// Remove implements the Remove method of the eventhorizon.WriteRepo interface.
+func (s *Session) Remove(data eventbus.Data) error {
+	if err := s.Repo.Remove(data); err != nil {
+		return err
+	}
+
+	s.set(data, tombstone{})
+
+	return nil
+}
+
+func (s *Session) get(ns namespace, id eventbus.DataId) (interface{}, bool) {
+	s.s.mu.Lock()
+	defer s.s.mu.Unlock()
+
+	v, ok := s.s.written[sessionEntry{ns, id}]
+	return v, ok
+}
+
+func (s *Session) set(data eventbus.Data, v interface{}) {
+	s.s.mu.Lock()
+	defer s.s.mu.Unlock()
+
+	s.s.written[sessionEntry{namespace(data.DataType()), data.Id()}] = v
+}
@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"context"
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo/mocks"
+	"testing"
+)
+
+// laggingRepo reads from a replica that never receives the writes.
+type laggingRepo struct {
+	*mocks.Repo
+}
+
+func (r *laggingRepo) Save(data eventbus.Data) error {
+	return nil
+}
+
+func (r *laggingRepo) Remove(data eventbus.Data) error {
+	return nil
+}
+
+func TestRepoSession(t *testing.T) {
+	inner := mocks.NewRepo()
+	r := NewRepo(&laggingRepo{inner})
+	if err := r.Register(mocks.ModelType, 10); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	ns := string(mocks.ModelType)
+
+	if r.WithContext(context.Background()) != r {
+		t.Error("the repo should be used without a session")
+	}
+
+	if err := inner.Save(&mocks.Model{ID: "1", Content: "old"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := inner.Save(&mocks.Model{ID: "2", Content: "old"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	// Without a session the stale replica is read after a save.
+	if err := r.Save(&mocks.Model{ID: "1", Content: "new"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if entity, err := r.FindById(ns, "1"); err != nil || entity.(*mocks.Model).Content != "old" {
+		t.Error("the stale entity should be read:", entity, err)
+	}
+
+	s := r.WithContext(NewSessionContext(context.Background()))
+	if err := s.Save(&mocks.Model{ID: "1", Content: "new"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if entity, err := s.FindById(ns, "1"); err != nil || entity.(*mocks.Model).Content != "new" {
+		t.Error("the saved entity should be read in the session:", entity, err)
+	}
+	if entity, err := r.FindById(ns, "1"); err != nil || entity.(*mocks.Model).Content != "new" {
+		t.Error("the saved entity should be written through to the cache:", entity, err)
+	}
+
+	// The session is kept when the entity is evicted from the cache.
+	r.Invalidate(mocks.ModelType)
+	if entity, err := s.Find(&mocks.Model{ID: "1"}); err != nil || entity.(*mocks.Model).Content != "new" {
+		t.Error("the saved entity should be read in the session:", entity, err)
+	}
+	other := r.WithContext(NewSessionContext(context.Background()))
+	if entity, err := other.FindById(ns, "1"); err != nil || entity.(*mocks.Model).Content != "old" {
+		t.Error("other sessions should read the stale entity:", entity, err)
+	}
+
+	if err := s.Remove(&mocks.Model{ID: "2"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if _, err := s.FindById(ns, "2"); !isNotFound(err) {
+		t.Error("the removed entity should not be found in the session:", err)
+	}
+	entities, err := s.FindByIds(ns, []eventbus.DataId{"1", "2"})
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(entities) != 1 || entities[0].(*mocks.Model).Content != "new" {
+		t.Error("the entities should be read in the session:", entities)
+	}
+}
@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"fmt"
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/jeek120/eventbus"
+	"hash/fnv"
+)
+
+// store is the cache of a namespace.
+type store interface {
+	Get(key interface{}) (interface{}, bool)
+	Peek(key interface{}) (interface{}, bool)
+	Add(key, value interface{}) bool
+	Remove(key interface{}) bool
+	Len() int
+	Purge()
+	Resize(size int) int
+}
+
+// RegisterSharded registers a namespace with a cache of the given size split
+// into shards by the hash of the ID, each with its own lock, to reduce lock
+// contention under many concurrent reads.
+func (r *Repo) RegisterSharded(ns eventbus.DataType, size, shards int) error {
+	if shards <= 0 || size < shards {
+		return fmt.Errorf("cache namespace(%s): must provide a size of at least one per shard", ns)
+	}
+
+	s := make(shardedLRU, shards)
+	for i := range s {
+		c, err := lru.New(size / shards)
+		if err != nil {
+			return fmt.Errorf("cache namespace(%s): %w", ns, err)
+		}
+		s[i] = c
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.cache[namespace(ns)]; ok {
+		return fmt.Errorf("%w: %s", ErrNamespaceAlreadyRegistered, ns)
+	}
+	r.cache[namespace(ns)] = s
+
+	return nil
+}
+
+// shardedLRU is a cache split into LRU caches by the hash of the ID.
+type shardedLRU []*lru.Cache
+
+func (s shardedLRU) shard(key interface{}) *lru.Cache {
+	h := fnv.New32a()
+	if id, ok := key.(eventbus.DataId); ok {
+		h.Write([]byte(id))
+	} else {
+		h.Write([]byte(fmt.Sprint(key)))
+	}
+	return s[h.Sum32()%uint32(len(s))]
+}
+
+func (s shardedLRU) Get(key interface{}) (interface{}, bool) {
+	return s.shard(key).Get(key)
+}
+
+func (s shardedLRU) Peek(key interface{}) (interface{}, bool) {
+	return s.shard(key).Peek(key)
+}
+
+func (s shardedLRU) Add(key, value interface{}) bool {
+	return s.shard(key).Add(key, value)
+}
+
+func (s shardedLRU) Remove(key interface{}) bool {
+	return s.shard(key).Remove(key)
+}
+
+func (s shardedLRU) Len() int {
+	n := 0
+	for _, c := range s {
+		n += c.Len()
+	}
+	return n
+}
+
+func (s shardedLRU) Purge() {
+	for _, c := range s {
+		c.Purge()
+	}
+}
+
+// Resize splits the size over the shards, with at least one entry per shard.
+func (s shardedLRU) Resize(size int) int {
+	per := size / len(s)
+	if per < 1 {
+		per = 1
+	}
+	evicted := 0
+	for _, c := range s {
+		evicted += c.Resize(per)
+	}
+	return evicted
+}
@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo/mocks"
+	"testing"
+)
+
+func TestRepoRegisterSharded(t *testing.T) {
+	inner := mocks.NewRepo()
+	r := NewRepo(inner)
+	ns := string(mocks.ModelType)
+
+	if err := r.RegisterSharded(mocks.ModelType, 2, 4); err == nil {
+		t.Error("there should be an error for less than one entry per shard")
+	}
+	if err := r.RegisterSharded(mocks.ModelType, 8, 4); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := r.RegisterSharded(mocks.ModelType, 8, 4); !errors.Is(err, ErrNamespaceAlreadyRegistered) {
+		t.Error("there should be an already registered error:", err)
+	}
+
+	for i := 0; i < 4; i++ {
+		if err := inner.Save(&mocks.Model{ID: eventbus.DataId(fmt.Sprint(i))}); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+	for n := 0; n < 2; n++ {
+		for i := 0; i < 4; i++ {
+			if _, err := r.FindById(ns, eventbus.DataId(fmt.Sprint(i))); err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+		}
+	}
+	if n := inner.Calls("FindById"); n != 4 {
+		t.Error("the entities should be cached in their shards:", n)
+	}
+}
+
+func benchmarkRepoFindById(b *testing.B, register func(*Repo) error) {
+	inner := mocks.NewRepo()
+	r := NewRepo(inner)
+	if err := register(r); err != nil {
+		b.Fatal("there should be no error:", err)
+	}
+	ns := string(mocks.ModelType)
+
+	ids := make([]eventbus.DataId, 1024)
+	for i := range ids {
+		ids[i] = eventbus.DataId(fmt.Sprint(i))
+		if err := inner.Save(&mocks.Model{ID: ids[i]}); err != nil {
+			b.Fatal("there should be no error:", err)
+		}
+		if _, err := r.FindById(ns, ids[i]); err != nil {
+			b.Fatal("there should be no error:", err)
+		}
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			if _, err := r.FindById(ns, ids[i%len(ids)]); err != nil {
+				b.Error("there should be no error:", err)
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkRepoFindById(b *testing.B) {
+	benchmarkRepoFindById(b, func(r *Repo) error {
+		return r.Register(mocks.ModelType, 4096)
+	})
+}
+
+func BenchmarkRepoFindByIdSharded(b *testing.B) {
+	benchmarkRepoFindById(b, func(r *Repo) error {
+		return r.RegisterSharded(mocks.ModelType, 4096, 16)
+	})
+}
@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"github.com/jeek120/eventbus"
+	"sync"
+)
+
+// CacheStats are the counters of the cache of a namespace.
+type CacheStats struct {
+	// Hits is the number of entities read from the cache.
+	Hits uint64
+	// Misses is the number of entities read from the inner repo.
+	Misses uint64
+	// Purges is the number of times the namespace was invalidated.
+	Purges uint64
+}
+
+type stats struct {
+	mu sync.Mutex
+	ns map[namespace]*CacheStats
+}
+
+// Stats returns the counters of a namespace.
+func (r *Repo) Stats(ns eventbus.DataType) CacheStats {
+	r.stats.mu.Lock()
+	defer r.stats.mu.Unlock()
+
+	if s, ok := r.stats.ns[namespace(ns)]; ok {
+		return *s
+	}
+	return CacheStats{}
+}
+
+// ResetStats zeroes the counters of all namespaces.
+func (r *Repo) ResetStats() {
+	r.stats.mu.Lock()
+	defer r.stats.mu.Unlock()
+
+	r.stats.ns = nil
+}
+
+// Invalidate removes all cached entities and the cached list of a namespace.
+func (r *Repo) Invalidate(ns eventbus.DataType) {
+	r.mu.RLock()
+	c := r.cache[namespace(ns)]
+	r.mu.RUnlock()
+
+	if c != nil {
+		c.Purge()
+	}
+	r.invalidateList(namespace(ns))
+	r.count(namespace(ns), func(s *CacheStats) { s.Purges++ })
+}
+
+// InvalidateAll invalidates all registered namespaces.
+func (r *Repo) InvalidateAll() {
+	for _, ns := range r.Namespaces() {
+		r.Invalidate(ns)
+	}
+}
+
+// count updates the counters of a namespace.
+func (r *Repo) count(ns namespace, f func(*CacheStats)) {
+	r.stats.mu.Lock()
+	defer r.stats.mu.Unlock()
+
+	if r.stats.ns == nil {
+		r.stats.ns = map[namespace]*CacheStats{}
+	}
+	s, ok := r.stats.ns[ns]
+	if !ok {
+		s = &CacheStats{}
+		r.stats.ns[ns] = s
+	}
+	f(s)
+}
+
+func (r *Repo) hits(ns namespace, n int) {
+	r.count(ns, func(s *CacheStats) { s.Hits += uint64(n) })
+}
+
+func (r *Repo) misses(ns namespace, n int) {
+	r.count(ns, func(s *CacheStats) { s.Misses += uint64(n) })
+}
@@ -0,0 +1,43 @@
+package cache
+
+import (
+	"github.com/jeek120/repo/mocks"
+	"testing"
+)
+
+func TestRepoStats(t *testing.T) {
+	inner := mocks.NewRepo()
+	r := NewRepo(inner)
+	if err := r.Register(mocks.ModelType, 10); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	ns := string(mocks.ModelType)
+
+	if err := inner.Save(&mocks.Model{ID: "1"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := r.FindById(ns, "1"); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+	r.Invalidate(mocks.ModelType)
+	r.InvalidateAll()
+
+	if s := r.Stats(mocks.ModelType); s != (CacheStats{Hits: 2, Misses: 1, Purges: 2}) {
+		t.Error("the stats should be counted:", s)
+	}
+
+	r.ResetStats()
+	if s := r.Stats(mocks.ModelType); s != (CacheStats{}) {
+		t.Error("the stats should be reset:", s)
+	}
+
+	// Counting resumes after a reset.
+	if _, err := r.FindById(ns, "1"); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if s := r.Stats(mocks.ModelType); s != (CacheStats{Misses: 1}) {
+		t.Error("the stats should be counted after a reset:", s)
+	}
+}
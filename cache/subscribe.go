@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"github.com/jeek120/eventbus"
+	"sync"
+)
+
+// Op is the kind of write of an Event.
+type Op int
+
+const (
+	// OpSave is a saved entity.
+	OpSave Op = iota
+	// OpRemove is a removed entity.
+	OpRemove
+)
+
+// Event is a write to the repo, sent to subscribers.
+type Event struct {
+	Op        Op
+	Namespace eventbus.DataType
+	Id        eventbus.DataId
+}
+
+// subscriberBuffer is the size of the channel of a subscriber.
+const subscriberBuffer = 64
+
+type subscribers struct {
+	mu   sync.Mutex
+	next int
+	chs  map[int]chan Event
+}
+
+// Subscribe returns a channel receiving an Event for every successful Save and
+// Remove, and a func to unsubscribe which closes the channel. Writes never
+// block on a subscriber, events are dropped if its channel is full.
+func (r *Repo) Subscribe() (<-chan Event, func()) {
+	r.subs.mu.Lock()
+	defer r.subs.mu.Unlock()
+
+	if r.subs.chs == nil {
+		r.subs.chs = map[int]chan Event{}
+	}
+	id := r.subs.next
+	r.subs.next++
+	ch := make(chan Event, subscriberBuffer)
+	r.subs.chs[id] = ch
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			r.subs.mu.Lock()
+			defer r.subs.mu.Unlock()
+
+			delete(r.subs.chs, id)
+			close(ch)
+		})
+	}
+}
+
+// publish sends the event to all subscribers.
+func (r *Repo) publish(op Op, data eventbus.Data) {
+	r.subs.mu.Lock()
+	defer r.subs.mu.Unlock()
+
+	e := Event{
+		Op:        op,
+		Namespace: data.DataType(),
+		Id:        data.Id(),
+	}
+	for _, ch := range r.subs.chs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package cache
+
+import (
+	"errors"
+	"github.com/jeek120/repo"
+	"github.com/jeek120/repo/mocks"
+	"reflect"
+	"testing"
+)
+
+func TestRepoSubscribe(t *testing.T) {
+	inner := mocks.NewRepo()
+	r := NewRepo(inner)
+	ch, unsubscribe := r.Subscribe()
+
+	if err := r.Save(&mocks.Model{ID: "1"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := r.Remove(&mocks.Model{ID: "1"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	// Failed writes are not published.
+	inner.SetError(repo.RepoError{Err: errors.New("error")})
+	if err := r.Save(&mocks.Model{ID: "2"}); err == nil {
+		t.Fatal("there should be an error")
+	}
+	inner.SetError(nil)
+
+	unsubscribe()
+	unsubscribe()
+	events := []Event{}
+	for e := range ch {
+		events = append(events, e)
+	}
+	expected := []Event{
+		{Op: OpSave, Namespace: mocks.ModelType, Id: "1"},
+		{Op: OpRemove, Namespace: mocks.ModelType, Id: "1"},
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("the events should be received: %+v", events)
+	}
+
+	if err := r.Save(&mocks.Model{ID: "3"}); err != nil {
+		t.Error("there should be no error after unsubscribing:", err)
+	}
+}
+
+func TestRepoSubscribeFull(t *testing.T) {
+	r := NewRepo(mocks.NewRepo())
+	ch, unsubscribe := r.Subscribe()
+	defer unsubscribe()
+
+	// Writes do not block on a full subscriber.
+	for i := 0; i < subscriberBuffer+10; i++ {
+		if err := r.Save(&mocks.Model{ID: "1"}); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+	if n := len(ch); n != subscriberBuffer {
+		t.Error("the events should be dropped when the channel is full:", n)
+	}
+}
@@ -0,0 +1,232 @@
+package debounce
+
+import (
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo"
+	"sync"
+	"time"
+)
+
+// Repo is a middleware that coalesces frequent saves of the same entity. Saves
+// are buffered and only the latest value of each entity is written to the
+// inner repo when the buffer is flushed, at most once per interval. Buffered
+// entities are returned by FindById and Find before they are written.
+type Repo struct {
+	repo.ReadWriteRepo
+	interval time.Duration
+	onError  func(error)
+	// timerErr is the first error of a flush done by the timer, without an
+	// error handler, returned by the next Flush.
+	timerErr error
+
+	// flushMu serializes the writes to the inner repo, so that an older value
+	// is never written after a newer one and a removed entity is not written
+	// back by a flush in progress.
+	flushMu sync.Mutex
+
+	mu      sync.Mutex
+	pending map[key]eventbus.Data
+	// flushing are the entities being written by a flush.
+	flushing map[key]eventbus.Data
+	timer    *time.Timer
+}
+
+type key struct {
+	ns eventbus.DataType
+	id eventbus.DataId
+}
+
+// NewRepo creates a new Repo that writes buffered saves after interval.
+func NewRepo(repo repo.ReadWriteRepo, interval time.Duration) *Repo {
+	return &Repo{
+		ReadWriteRepo: repo,
+		interval:      interval,
+		pending:       map[key]eventbus.Data{},
+	}
+}
+
+// SetErrorHandler sets a func called with the errors of flushes done by the
+// timer. Without a handler the first error is returned by the next Flush.
+func (r *Repo) SetErrorHandler(f func(error)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.onError = f
+}
+
+// Parent implements the Parent method of the eventhorizon.ReadRepo interface.
+func (r *Repo) Parent() repo.ReadRepo {
+	return r.ReadWriteRepo
+}
+
+// Find implements the Find method of the eventhorizon.ReadRepo interface.
+func (r *Repo) Find(data eventbus.Data) (eventbus.Data, error) {
+	if entity, ok := r.buffered(data.DataType(), data.Id()); ok {
+		return entity, nil
+	}
+
+	return r.ReadWriteRepo.Find(data)
+}
+
+// FindById implements the FindById method of the eventhorizon.ReadRepo interface.
+func (r *Repo) FindById(ns string, id eventbus.DataId) (eventbus.Data, error) {
+	if entity, ok := r.buffered(eventbus.DataType(ns), id); ok {
+		return entity, nil
+	}
+
+	return r.ReadWriteRepo.FindById(ns, id)
+}
+
+// Save implements the Save method of the eventhorizon.WriteRepo interface. The
+// entity is only buffered, write errors are reported by Flush or the error
+// handler.
+func (r *Repo) Save(data eventbus.Data) error {
+	if data.Id() == "" {
+		return repo.RepoError{
+			Err:     repo.ErrCouldNotSaveEntity,
+			BaseErr: repo.ErrMissingEntityID,
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.pending[key{data.DataType(), data.Id()}] = data
+	if r.timer == nil {
+		r.timer = time.AfterFunc(r.interval, r.flushTimer)
+	}
+
+	return nil
+}
+
+// Remove implements the Remove method of the eventhorizon.WriteRepo interface.
+// A buffered save of the entity is discarded, the entity is then removed even
+// if it was never written to the inner repo. A flush in progress is waited
+// for, so that it can not write the entity back after the remove.
+func (r *Repo) Remove(data eventbus.Data) error {
+	r.flushMu.Lock()
+	defer r.flushMu.Unlock()
+
+	k := key{data.DataType(), data.Id()}
+	r.mu.Lock()
+	_, buffered := r.pending[k]
+	delete(r.pending, k)
+	r.mu.Unlock()
+
+	err := r.ReadWriteRepo.Remove(data)
+	if buffered && isNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// Flush writes all buffered entities to the inner repo, after a flush in
+// progress. The first error is returned, the other entities are still written.
+// Entities that could not be written are buffered again, unless saved again
+// meanwhile, and retried by the timer.
+func (r *Repo) Flush() error {
+	r.flushMu.Lock()
+	defer r.flushMu.Unlock()
+
+	r.mu.Lock()
+	pending := r.pending
+	r.pending = map[key]eventbus.Data{}
+	r.flushing = pending
+	if r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
+	}
+	r.mu.Unlock()
+
+	defer func() {
+		r.mu.Lock()
+		r.flushing = nil
+		r.mu.Unlock()
+	}()
+
+	var firstErr error
+	for k, data := range pending {
+		if err := r.ReadWriteRepo.Save(data); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			r.requeue(k, data)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if firstErr == nil {
+		firstErr = r.timerErr
+	}
+	r.timerErr = nil
+	return firstErr
+}
+
+// requeue buffers an entity that could not be written again, if no newer value
+// was saved meanwhile.
+func (r *Repo) requeue(k key, data eventbus.Data) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.pending[k]; ok {
+		return
+	}
+	r.pending[k] = data
+	if r.timer == nil {
+		r.timer = time.AfterFunc(r.interval, r.flushTimer)
+	}
+}
+
+// Close writes all buffered entities, after a flush in progress. The repo must
+// not be used after Close, but entities that could not be written are still
+// retried by the timer.
+func (r *Repo) Close() error {
+	return r.Flush()
+}
+
+func (r *Repo) flushTimer() {
+	if err := r.Flush(); err != nil {
+		r.mu.Lock()
+		onError := r.onError
+		if onError == nil && r.timerErr == nil {
+			r.timerErr = err
+		}
+		r.mu.Unlock()
+
+		if onError != nil {
+			onError(err)
+		}
+	}
+}
+
+func (r *Repo) buffered(ns eventbus.DataType, id eventbus.DataId) (eventbus.Data, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if entity, ok := r.pending[key{ns, id}]; ok {
+		return entity, true
+	}
+	// Not yet written by the flush in progress.
+	entity, ok := r.flushing[key{ns, id}]
+	return entity, ok
+}
+
+func isNotFound(err error) bool {
+	rrErr, ok := err.(repo.RepoError)
+	return ok && rrErr.Err == repo.ErrEntityNotFound
+}
+
+// Repository returns a parent ReadRepo if there is one.
+func Repository(repo repo.ReadRepo) *Repo {
+	if repo == nil {
+		return nil
+	}
+
+	if r, ok := repo.(*Repo); ok {
+		return r
+	}
+
+	return Repository(repo.Parent())
+}
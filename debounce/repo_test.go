@@ -0,0 +1,232 @@
+package debounce
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo/mocks"
+	"testing"
+	"time"
+)
+
+func TestRepoCoalesce(t *testing.T) {
+	inner := mocks.NewRepo()
+	r := NewRepo(inner, 50*time.Millisecond)
+
+	for i := 0; i < 100; i++ {
+		if err := r.Save(&mocks.Model{ID: "1", Content: fmt.Sprint(i)}); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+	entity, err := r.FindById(string(mocks.ModelType), "1")
+	if err != nil || entity.(*mocks.Model).Content != "99" {
+		t.Error("the buffered entity should be found:", entity, err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	if n := inner.Calls("Save"); n < 1 || n > 2 {
+		t.Error("only a couple of saves should reach the inner repo:", n)
+	}
+	entity, err = inner.FindById(string(mocks.ModelType), "1")
+	if err != nil || entity.(*mocks.Model).Content != "99" {
+		t.Error("the latest value should be written:", entity, err)
+	}
+}
+
+func TestRepoTimerFlush(t *testing.T) {
+	inner := mocks.NewRepo()
+	r := NewRepo(inner, 10*time.Millisecond)
+
+	r.Save(&mocks.Model{ID: "1"})
+	deadline := time.Now().Add(time.Second)
+	for inner.Calls("Save") == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if inner.Calls("Save") != 1 {
+		t.Error("the timer should flush the save")
+	}
+}
+
+// slowRepo blocks saves until released.
+type slowRepo struct {
+	*mocks.Repo
+	saving  chan eventbus.Data
+	release chan struct{}
+}
+
+func newSlowRepo() *slowRepo {
+	return &slowRepo{
+		Repo:    mocks.NewRepo(),
+		saving:  make(chan eventbus.Data, 10),
+		release: make(chan struct{}),
+	}
+}
+
+func (r *slowRepo) Save(data eventbus.Data) error {
+	r.saving <- data
+	<-r.release
+	return r.Repo.Save(data)
+}
+
+func TestRepoFlushOrder(t *testing.T) {
+	inner := newSlowRepo()
+	r := NewRepo(inner, time.Hour)
+
+	r.Save(&mocks.Model{ID: "1", Content: "old"})
+	done := make(chan error, 2)
+	go func() { done <- r.Flush() }()
+	<-inner.saving
+
+	// The buffered entity is found while being written.
+	if entity, err := r.FindById(string(mocks.ModelType), "1"); err != nil || entity.(*mocks.Model).Content != "old" {
+		t.Error("the entity being flushed should be found:", entity, err)
+	}
+
+	// A newer value flushed concurrently must be written after the older.
+	r.Save(&mocks.Model{ID: "1", Content: "new"})
+	go func() { done <- r.Flush() }()
+
+	close(inner.release)
+	<-done
+	<-done
+
+	entity, err := inner.FindById(string(mocks.ModelType), "1")
+	if err != nil || entity.(*mocks.Model).Content != "new" {
+		t.Error("the newest value should be written last:", entity, err)
+	}
+}
+
+func TestRepoRemoveDuringFlush(t *testing.T) {
+	inner := newSlowRepo()
+	r := NewRepo(inner, time.Hour)
+
+	r.Save(&mocks.Model{ID: "1"})
+	flushed := make(chan error)
+	go func() { flushed <- r.Flush() }()
+	<-inner.saving
+
+	removed := make(chan error)
+	go func() { removed <- r.Remove(&mocks.Model{ID: "1"}) }()
+	select {
+	case err := <-removed:
+		t.Fatal("the remove should wait for the flush:", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(inner.release)
+	if err := <-flushed; err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := <-removed; err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	if _, err := inner.FindById(string(mocks.ModelType), "1"); err == nil {
+		t.Error("the removed entity should not be written back")
+	}
+}
+
+func TestRepoRemoveBuffered(t *testing.T) {
+	inner := mocks.NewRepo()
+	r := NewRepo(inner, time.Hour)
+	ns := string(mocks.ModelType)
+
+	r.Save(&mocks.Model{ID: "1"})
+	if err := r.Remove(&mocks.Model{ID: "1"}); err != nil {
+		t.Error("the buffered entity should be removed:", err)
+	}
+	if _, err := r.FindById(ns, "1"); !isNotFound(err) {
+		t.Error("there should be a not found error:", err)
+	}
+	if err := r.Flush(); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if n := inner.Calls("Save"); n != 0 {
+		t.Error("the removed entity should not be written:", n)
+	}
+
+	if err := r.Remove(&mocks.Model{ID: "1"}); !isNotFound(err) {
+		t.Error("there should be a not found error:", err)
+	}
+}
+
+func TestRepoFlushError(t *testing.T) {
+	inner := mocks.NewRepo()
+	r := NewRepo(inner, time.Hour)
+	ns := string(mocks.ModelType)
+
+	r.Save(&mocks.Model{ID: "1", Content: "old"})
+	r.Save(&mocks.Model{ID: "2"})
+	inner.SetError(errors.New("error"))
+	if err := r.Flush(); err == nil {
+		t.Error("there should be an error")
+	}
+
+	// The failed entities are still buffered, a newer value is kept.
+	r.Save(&mocks.Model{ID: "1", Content: "new"})
+	if entity, err := r.FindById(ns, "2"); err != nil {
+		t.Error("the failed entity should still be buffered:", entity, err)
+	}
+	inner.SetError(nil)
+	if err := r.Flush(); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if entity, err := inner.FindById(ns, "1"); err != nil || entity.(*mocks.Model).Content != "new" {
+		t.Error("the newer value should be written:", entity, err)
+	}
+	if _, err := inner.FindById(ns, "2"); err != nil {
+		t.Error("the failed entity should be written:", err)
+	}
+}
+
+// failingRepo fails saves with a newer save of the entity done meanwhile.
+type failingRepo struct {
+	*mocks.Repo
+	r *Repo
+}
+
+func (r *failingRepo) Save(data eventbus.Data) error {
+	r.r.Save(&mocks.Model{ID: data.Id(), Content: "new"})
+	return errors.New("error")
+}
+
+func TestRepoFlushErrorNewer(t *testing.T) {
+	inner := &failingRepo{Repo: mocks.NewRepo()}
+	r := NewRepo(inner, time.Hour)
+	inner.r = r
+
+	r.Save(&mocks.Model{ID: "1", Content: "old"})
+	if err := r.Flush(); err == nil {
+		t.Error("there should be an error")
+	}
+	if entity, err := r.FindById(string(mocks.ModelType), "1"); err != nil || entity.(*mocks.Model).Content != "new" {
+		t.Error("the failed value should not replace the newer value:", entity, err)
+	}
+}
+
+func TestRepoTimerFlushError(t *testing.T) {
+	inner := mocks.NewRepo()
+	r := NewRepo(inner, 10*time.Millisecond)
+	saveErr := errors.New("error")
+	inner.SetError(saveErr)
+
+	r.Save(&mocks.Model{ID: "1"})
+	deadline := time.Now().Add(time.Second)
+	for inner.Calls("Save") == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// The error of the timer is returned by the next flush.
+	inner.SetError(nil)
+	if err := r.Flush(); err != saveErr {
+		t.Error("the error of the timer should be returned:", err)
+	}
+	if _, err := inner.FindById(string(mocks.ModelType), "1"); err != nil {
+		t.Error("the failed entity should be written:", err)
+	}
+	if err := r.Flush(); err != nil {
+		t.Error("the error should only be returned once:", err)
+	}
+}
@@ -0,0 +1,90 @@
+package dualwrite
+
+import (
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo"
+)
+
+// Repo is a middleware for dual writes during a migration. Writes go to the
+// primary and then to the secondary repo, reads only to the primary. By
+// default writes to the secondary are best effort: their errors are passed to
+// the error handler, if any. In strict mode they are returned.
+type Repo struct {
+	repo.ReadWriteRepo
+	secondary repo.ReadWriteRepo
+	strict    bool
+	onError   func(error)
+}
+
+// NewRepo creates a new Repo.
+func NewRepo(primary, secondary repo.ReadWriteRepo) *Repo {
+	return &Repo{
+		ReadWriteRepo: primary,
+		secondary:     secondary,
+	}
+}
+
+// SetStrict makes writes fail if the write to the secondary fails. The write
+// to the primary is not undone.
+func (r *Repo) SetStrict(enabled bool) {
+	r.strict = enabled
+}
+
+// SetErrorHandler sets a func called with the errors of best effort writes to
+// the secondary.
+func (r *Repo) SetErrorHandler(f func(error)) {
+	r.onError = f
+}
+
+// Parent implements the Parent method of the eventhorizon.ReadRepo interface.
+func (r *Repo) Parent() repo.ReadRepo {
+	return r.ReadWriteRepo
+}
+
+// Save implements the Save method of the eventhorizon.WriteRepo interface.
+func (r *Repo) Save(data eventbus.Data) error {
+	if err := r.ReadWriteRepo.Save(data); err != nil {
+		return err
+	}
+
+	return r.secondaryDone(r.secondary.Save(data))
+}
+
+// Remove implements the Remove method of the eventhorizon.WriteRepo interface.
+func (r *Repo) Remove(data eventbus.Data) error {
+	if err := r.ReadWriteRepo.Remove(data); err != nil {
+		return err
+	}
+
+	// The entity may not have been copied to the secondary yet.
+	err := r.secondary.Remove(data)
+	if rrErr, ok := err.(repo.RepoError); ok && rrErr.Err == repo.ErrEntityNotFound {
+		err = nil
+	}
+	return r.secondaryDone(err)
+}
+
+// secondaryDone handles the result of a write to the secondary.
+func (r *Repo) secondaryDone(err error) error {
+	if err == nil || r.strict {
+		return err
+	}
+
+	if r.onError != nil {
+		r.onError(err)
+	}
+	return nil
+}
+
+// Repository returns a parent ReadRepo if there is one.
+func Repository(repo repo.ReadRepo) *Repo {
+	if repo == nil {
+		return nil
+	}
+
+	if r, ok := repo.(*Repo); ok {
+		return r
+	}
+
+	return Repository(repo.Parent())
+}
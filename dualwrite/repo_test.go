@@ -0,0 +1,102 @@
+package dualwrite
+
+import (
+	"errors"
+	"github.com/jeek120/repo"
+	"github.com/jeek120/repo/mocks"
+	"testing"
+)
+
+func TestRepo(t *testing.T) {
+	primary, secondary := mocks.NewRepo(), mocks.NewRepo()
+	r := NewRepo(primary, secondary)
+	ns := string(mocks.ModelType)
+
+	m := &mocks.Model{ID: "1"}
+	if err := r.Save(m); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	for _, s := range []*mocks.Repo{primary, secondary} {
+		if _, err := s.FindById(ns, "1"); err != nil {
+			t.Error("the entity should be saved in both stores:", err)
+		}
+	}
+
+	// Reads only go to the primary.
+	secondary.ResetCalls()
+	if _, err := r.FindById(ns, "1"); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := r.FindAll(ns); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if secondary.Calls("FindById") != 0 || secondary.Calls("FindAll") != 0 {
+		t.Error("the secondary should not be read")
+	}
+
+	if err := r.Remove(m); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if n := secondary.Calls("Remove"); n != 1 {
+		t.Error("the entity should be removed from the secondary:", n)
+	}
+
+	// An entity not yet copied to the secondary can be removed.
+	if err := primary.Save(m); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	r.SetStrict(true)
+	if err := r.Remove(m); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	if r.Parent() != primary {
+		t.Error("the parent should be the primary")
+	}
+}
+
+func TestRepoBestEffort(t *testing.T) {
+	primary, secondary := mocks.NewRepo(), mocks.NewRepo()
+	r := NewRepo(primary, secondary)
+	secondaryErr := repo.RepoError{Err: errors.New("secondary error")}
+	secondary.SetError(secondaryErr)
+
+	var handled []error
+	r.SetErrorHandler(func(err error) {
+		handled = append(handled, err)
+	})
+	if err := r.Save(&mocks.Model{ID: "1"}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := r.Remove(&mocks.Model{ID: "1"}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(handled) != 2 || handled[0] != secondaryErr {
+		t.Error("the secondary errors should be handled:", handled)
+	}
+}
+
+func TestRepoStrict(t *testing.T) {
+	primary, secondary := mocks.NewRepo(), mocks.NewRepo()
+	r := NewRepo(primary, secondary)
+	r.SetStrict(true)
+	secondaryErr := repo.RepoError{Err: errors.New("secondary error")}
+	secondary.SetError(secondaryErr)
+
+	if err := r.Save(&mocks.Model{ID: "1"}); err != secondaryErr {
+		t.Error("the secondary error should be returned:", err)
+	}
+	if _, err := primary.FindById(string(mocks.ModelType), "1"); err != nil {
+		t.Error("the write to the primary should not be undone:", err)
+	}
+
+	// A failed write to the primary is not done on the secondary.
+	secondary.SetError(nil)
+	primary.SetError(repo.RepoError{Err: errors.New("primary error")})
+	if err := r.Save(&mocks.Model{ID: "2"}); err == nil {
+		t.Error("there should be an error")
+	}
+	if n := secondary.Calls("Save"); n != 1 {
+		t.Error("the secondary should not be written:", n)
+	}
+}
@@ -0,0 +1,229 @@
+package failover
+
+import (
+	"errors"
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo"
+	"sync"
+	"time"
+)
+
+// ErrNoRepos is when a Repo is created without repos.
+var ErrNoRepos = errors.New("no repos")
+
+// Repo is a middleware that fails over between repos, for example in several
+// regions. All operations go to the first healthy repo. A repo is demoted when
+// an operation fails with an infrastructure error, and the operation is retried
+// on the next healthy repo. Demoted repos are promoted again by a successful
+// health check.
+type Repo struct {
+	repos       []repo.ReadWriteRepo
+	healthCheck func(repo.ReadWriteRepo) error
+	isFailure   func(error) bool
+
+	mu      sync.RWMutex
+	healthy []bool
+	stop    chan struct{}
+}
+
+// NewRepo creates a new Repo. All repos start as healthy.
+func NewRepo(repos []repo.ReadWriteRepo, healthCheck func(repo.ReadWriteRepo) error) (*Repo, error) {
+	if len(repos) == 0 {
+		return nil, ErrNoRepos
+	}
+
+	healthy := make([]bool, len(repos))
+	for i := range healthy {
+		healthy[i] = true
+	}
+
+	return &Repo{
+		repos:       repos,
+		healthCheck: healthCheck,
+		isFailure:   repo.IsInfrastructureError,
+		healthy:     healthy,
+	}, nil
+}
+
+// SetFailureFunc sets the function deciding which errors demote a repo. By
+// default they are the errors of repo.IsInfrastructureError.
+func (r *Repo) SetFailureFunc(f func(error) bool) {
+	r.isFailure = f
+}
+
+// CheckHealth runs the health check on all repos and updates their state.
+func (r *Repo) CheckHealth() {
+	for i, rr := range r.repos {
+		err := r.healthCheck(rr)
+
+		r.mu.Lock()
+		r.healthy[i] = err == nil
+		r.mu.Unlock()
+	}
+}
+
+// Start runs the health checks every interval until Stop is called.
+func (r *Repo) Start(interval time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stop != nil {
+		return
+	}
+	stop := make(chan struct{})
+	r.stop = stop
+
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-t.C:
+				r.CheckHealth()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the health checks started with Start.
+func (r *Repo) Stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stop != nil {
+		close(r.stop)
+		r.stop = nil
+	}
+}
+
+// Parent implements the Parent method of the eventhorizon.ReadRepo interface.
+// It returns the active repo.
+func (r *Repo) Parent() repo.ReadRepo {
+	return r.repos[r.order()[0]]
+}
+
+// Find implements the Find method of the eventhorizon.ReadRepo interface.
+func (r *Repo) Find(data eventbus.Data) (eventbus.Data, error) {
+	var entity eventbus.Data
+	err := r.do(func(rr repo.ReadWriteRepo) (err error) {
+		entity, err = rr.Find(data)
+		return
+	})
+	return entity, err
+}
+
+// FindById implements the FindById method of the eventhorizon.ReadRepo interface.
+func (r *Repo) FindById(ns string, id eventbus.DataId) (eventbus.Data, error) {
+	var entity eventbus.Data
+	err := r.do(func(rr repo.ReadWriteRepo) (err error) {
+		entity, err = rr.FindById(ns, id)
+		return
+	})
+	return entity, err
+}
+
+// FindByIds implements the FindByIds method of the eventhorizon.ReadRepo interface.
+func (r *Repo) FindByIds(ns string, ids []eventbus.DataId) ([]eventbus.Data, error) {
+	var entities []eventbus.Data
+	err := r.do(func(rr repo.ReadWriteRepo) (err error) {
+		entities, err = rr.FindByIds(ns, ids)
+		return
+	})
+	return entities, err
+}
+
+// FindAll implements the FindAll method of the eventhorizon.ReadRepo interface.
+func (r *Repo) FindAll(ns string) ([]eventbus.Data, error) {
+	var entities []eventbus.Data
+	err := r.do(func(rr repo.ReadWriteRepo) (err error) {
+		entities, err = rr.FindAll(ns)
+		return
+	})
+	return entities, err
+}
+
+// FindAllIter implements the FindAllIter method of the eventhorizon.ReadRepo interface.
+func (r *Repo) FindAllIter(ns string) (repo.Iter, error) {
+	var i repo.Iter
+	err := r.do(func(rr repo.ReadWriteRepo) (err error) {
+		i, err = rr.FindAllIter(ns)
+		return
+	})
+	return i, err
+}
+
+// Count implements the Count method of the eventhorizon.ReadRepo interface.
+func (r *Repo) Count(ns string) (int64, error) {
+	var n int64
+	err := r.do(func(rr repo.ReadWriteRepo) (err error) {
+		n, err = rr.Count(ns)
+		return
+	})
+	return n, err
+}
+
+// Save implements the Save method of the eventhorizon.WriteRepo interface.
+func (r *Repo) Save(data eventbus.Data) error {
+	return r.do(func(rr repo.ReadWriteRepo) error {
+		return rr.Save(data)
+	})
+}
+
+// Remove implements the Remove method of the eventhorizon.WriteRepo interface.
+func (r *Repo) Remove(data eventbus.Data) error {
+	return r.do(func(rr repo.ReadWriteRepo) error {
+		return rr.Remove(data)
+	})
+}
+
+// do runs f on the healthy repos in order until it does not fail.
+func (r *Repo) do(f func(repo.ReadWriteRepo) error) error {
+	var err error
+	for _, i := range r.order() {
+		err = f(r.repos[i])
+		if err == nil || !r.isFailure(err) {
+			return err
+		}
+
+		r.mu.Lock()
+		r.healthy[i] = false
+		r.mu.Unlock()
+	}
+	return err
+}
+
+// order returns the indexes of the healthy repos, or of all repos if none is
+// healthy.
+func (r *Repo) order() []int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var idxs []int
+	for i, ok := range r.healthy {
+		if ok {
+			idxs = append(idxs, i)
+		}
+	}
+	if len(idxs) == 0 {
+		for i := range r.repos {
+			idxs = append(idxs, i)
+		}
+	}
+	return idxs
+}
+
+// Repository returns a parent ReadRepo if there is one.
+func Repository(repo repo.ReadRepo) *Repo {
+	if repo == nil {
+		return nil
+	}
+
+	if r, ok := repo.(*Repo); ok {
+		return r
+	}
+
+	return Repository(repo.Parent())
+}
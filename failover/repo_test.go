@@ -0,0 +1,107 @@
+package failover
+
+import (
+	"errors"
+	"github.com/jeek120/repo"
+	"github.com/jeek120/repo/mocks"
+	"net"
+	"testing"
+)
+
+func TestRepoFailover(t *testing.T) {
+	primary := mocks.NewRepo()
+	secondary := mocks.NewRepo()
+	var primaryDown bool
+	r, err := NewRepo([]repo.ReadWriteRepo{primary, secondary}, func(rr repo.ReadWriteRepo) error {
+		if rr == primary && primaryDown {
+			return errors.New("down")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	m := &mocks.Model{ID: "1"}
+	if err := r.Save(m); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if primary.Calls("Save") != 1 || secondary.Calls("Save") != 0 {
+		t.Error("the save should go to the primary")
+	}
+	if r.Parent() != primary {
+		t.Error("the primary should be active")
+	}
+
+	// A write failing with a driver network error demotes the primary and is
+	// retried on the secondary.
+	primary.SetError(repo.RepoError{
+		Err:     repo.ErrCouldNotSaveEntity,
+		BaseErr: &net.OpError{Op: "write", Net: "tcp", Err: errors.New("broken pipe")},
+	})
+	primaryDown = true
+	if err := r.Save(m); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if secondary.Calls("Save") != 1 {
+		t.Error("the save should be retried on the secondary")
+	}
+	if r.Parent() != secondary {
+		t.Error("the secondary should be active")
+	}
+
+	// The traffic stays on the secondary.
+	primary.ResetCalls()
+	if _, err := r.FindAll(string(mocks.ModelType)); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := r.Count(string(mocks.ModelType)); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if primary.Calls("FindAll") != 0 || primary.Calls("Count") != 0 {
+		t.Error("the demoted primary should not be used")
+	}
+	if secondary.Calls("FindAll") != 1 || secondary.Calls("Count") != 1 {
+		t.Error("the reads should go to the secondary")
+	}
+
+	// A failed health check keeps it demoted, a successful one promotes it.
+	r.CheckHealth()
+	if r.Parent() != secondary {
+		t.Error("the secondary should still be active")
+	}
+	primary.SetError(nil)
+	primaryDown = false
+	r.CheckHealth()
+	if r.Parent() != primary {
+		t.Error("the primary should be active again")
+	}
+}
+
+func TestRepoNoFailoverOnOperationError(t *testing.T) {
+	primary := mocks.NewRepo()
+	secondary := mocks.NewRepo()
+	r, err := NewRepo([]repo.ReadWriteRepo{primary, secondary}, func(repo.ReadWriteRepo) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	_, err = r.FindById(string(mocks.ModelType), "missing")
+	if rrErr, ok := err.(repo.RepoError); !ok || rrErr.Err != repo.ErrEntityNotFound {
+		t.Error("there should be a not found error:", err)
+	}
+	if secondary.Calls("FindById") != 0 {
+		t.Error("a not found error should not fail over")
+	}
+	if r.Parent() != primary {
+		t.Error("the primary should still be active")
+	}
+}
+
+func TestNewRepoNoRepos(t *testing.T) {
+	if _, err := NewRepo(nil, func(repo.ReadWriteRepo) error { return nil }); err != ErrNoRepos {
+		t.Error("there should be a no repos error:", err)
+	}
+}
@@ -0,0 +1,131 @@
+package fallback
+
+import (
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo"
+	"sync"
+)
+
+// Repo is a middleware for migrating between two stores. Reads try the primary
+// repo and on a miss the secondary repo, copying found entities to the primary
+// so that later reads are served by it. Writes only go to the primary, removed
+// entities are remembered so that they are not read from the secondary again.
+type Repo struct {
+	repo.ReadWriteRepo
+	secondary repo.ReadRepo
+
+	mu      sync.RWMutex
+	removed map[entry]bool
+}
+
+type entry struct {
+	ns string
+	id eventbus.DataId
+}
+
+// NewRepo creates a new Repo.
+func NewRepo(primary repo.ReadWriteRepo, secondary repo.ReadRepo) *Repo {
+	return &Repo{
+		ReadWriteRepo: primary,
+		secondary:     secondary,
+		removed:       map[entry]bool{},
+	}
+}
+
+// Parent implements the Parent method of the eventhorizon.ReadRepo interface.
+func (r *Repo) Parent() repo.ReadRepo {
+	return r.ReadWriteRepo
+}
+
+// Find implements the Find method of the eventhorizon.ReadRepo interface.
+func (r *Repo) Find(data eventbus.Data) (eventbus.Data, error) {
+	entity, err := r.ReadWriteRepo.Find(data)
+	if !isNotFound(err) || r.isRemoved(string(data.DataType()), data.Id()) {
+		return entity, err
+	}
+
+	return r.migrate(r.secondary.Find(data))
+}
+
+// FindById implements the FindById method of the eventhorizon.ReadRepo interface.
+func (r *Repo) FindById(ns string, id eventbus.DataId) (eventbus.Data, error) {
+	entity, err := r.ReadWriteRepo.FindById(ns, id)
+	if !isNotFound(err) || r.isRemoved(ns, id) {
+		return entity, err
+	}
+
+	return r.migrate(r.secondary.FindById(ns, id))
+}
+
+// migrate copies an entity found in the secondary repo to the primary.
+func (r *Repo) migrate(entity eventbus.Data, err error) (eventbus.Data, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.ReadWriteRepo.Save(entity); err != nil {
+		return nil, err
+	}
+
+	return entity, nil
+}
+
+// Save implements the Save method of the eventhorizon.WriteRepo interface.
+func (r *Repo) Save(data eventbus.Data) error {
+	if err := r.ReadWriteRepo.Save(data); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.removed, entry{string(data.DataType()), data.Id()})
+	return nil
+}
+
+// Remove implements the Remove method of the eventhorizon.WriteRepo interface.
+// An entity that was not migrated yet is only found in the secondary repo, it
+// is removed as well.
+func (r *Repo) Remove(data eventbus.Data) error {
+	ns := string(data.DataType())
+	err := r.ReadWriteRepo.Remove(data)
+	if isNotFound(err) && !r.isRemoved(ns, data.Id()) {
+		if _, serr := r.secondary.FindById(ns, data.Id()); serr == nil {
+			err = nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.removed[entry{ns, data.Id()}] = true
+	return nil
+}
+
+func (r *Repo) isRemoved(ns string, id eventbus.DataId) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.removed[entry{ns, id}]
+}
+
+func isNotFound(err error) bool {
+	rrErr, ok := err.(repo.RepoError)
+	return ok && rrErr.Err == repo.ErrEntityNotFound
+}
+
+// Repository returns a parent ReadRepo if there is one.
+func Repository(repo repo.ReadRepo) *Repo {
+	if repo == nil {
+		return nil
+	}
+
+	if r, ok := repo.(*Repo); ok {
+		return r
+	}
+
+	return Repository(repo.Parent())
+}
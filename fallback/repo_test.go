@@ -0,0 +1,121 @@
+package fallback
+
+import (
+	"errors"
+	"github.com/jeek120/repo"
+	"github.com/jeek120/repo/mocks"
+	"testing"
+)
+
+func TestRepoMigration(t *testing.T) {
+	primary, secondary := mocks.NewRepo(), mocks.NewRepo()
+	r := NewRepo(primary, secondary)
+	ns := string(mocks.ModelType)
+
+	m := &mocks.Model{ID: "1", Content: "old store"}
+	if err := secondary.Save(m); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	// A miss in the primary is read from the secondary and copied forward.
+	if entity, err := r.FindById(ns, "1"); err != nil || entity != m {
+		t.Fatal("the entity should be found in the secondary:", entity, err)
+	}
+	if entity, err := primary.FindById(ns, "1"); err != nil || entity != m {
+		t.Error("the entity should be copied to the primary:", entity, err)
+	}
+
+	// The second read is served by the primary.
+	secondary.ResetCalls()
+	if _, err := r.FindById(ns, "1"); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := r.Find(m); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if n := secondary.Calls("FindById") + secondary.Calls("Find"); n != 0 {
+		t.Error("the secondary should not be read:", n)
+	}
+
+	if _, err := r.FindById(ns, "2"); !isNotFound(err) {
+		t.Error("there should be a not found error:", err)
+	}
+}
+
+func TestRepoWrites(t *testing.T) {
+	primary, secondary := mocks.NewRepo(), mocks.NewRepo()
+	r := NewRepo(primary, secondary)
+
+	if err := r.Save(&mocks.Model{ID: "1"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if primary.Calls("Save") != 1 || secondary.Calls("Save") != 0 {
+		t.Error("the write should only go to the primary")
+	}
+
+	// Errors other than not found are not retried on the secondary.
+	primary.SetError(repo.RepoError{Err: errors.New("error")})
+	if _, err := r.FindById(string(mocks.ModelType), "1"); err == nil || isNotFound(err) {
+		t.Error("the primary error should be returned:", err)
+	}
+	if n := secondary.Calls("FindById"); n != 0 {
+		t.Error("the secondary should not be read:", n)
+	}
+
+	if r.Parent() != primary {
+		t.Error("the parent should be the primary")
+	}
+}
+
+func TestRepoRemove(t *testing.T) {
+	primary, secondary := mocks.NewRepo(), mocks.NewRepo()
+	r := NewRepo(primary, secondary)
+	ns := string(mocks.ModelType)
+
+	m := &mocks.Model{ID: "1"}
+	if err := secondary.Save(m); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if _, err := r.FindById(ns, "1"); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	// A removed entity is not migrated again from the secondary.
+	if err := r.Save(m); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := r.Remove(m); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if _, err := r.FindById(ns, "1"); !isNotFound(err) {
+		t.Error("there should be a not found error:", err)
+	}
+	if _, err := r.Find(m); !isNotFound(err) {
+		t.Error("there should be a not found error:", err)
+	}
+	if _, err := primary.FindById(ns, "1"); !isNotFound(err) {
+		t.Error("the entity should not be copied to the primary:", err)
+	}
+	if err := r.Remove(m); !isNotFound(err) {
+		t.Error("there should be a not found error:", err)
+	}
+
+	// An entity only in the secondary can be removed.
+	if err := secondary.Save(&mocks.Model{ID: "2"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := r.Remove(&mocks.Model{ID: "2"}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := r.FindById(ns, "2"); !isNotFound(err) {
+		t.Error("there should be a not found error:", err)
+	}
+
+	// A saved entity is found again.
+	if err := r.Save(m); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if _, err := r.FindById(ns, "1"); err != nil {
+		t.Error("there should be no error:", err)
+	}
+}
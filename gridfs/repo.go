@@ -0,0 +1,159 @@
+package gridfs
+
+import (
+	"context"
+	"errors"
+	"github.com/jeek120/repo"
+	"github.com/jeek120/repo/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"io"
+)
+
+// Repo is a repository for large binary objects, stored in a GridFS bucket so
+// that they are not limited by the maximum BSON document size.
+type Repo struct {
+	bucket *gridfs.Bucket
+}
+
+// NewRepo creates a new Repo using the default GridFS bucket of the database.
+func NewRepo(client *mongo.Client, db string) (*Repo, error) {
+	if client == nil {
+		return nil, mongodb.ErrNoDBClient
+	}
+
+	bucket, err := gridfs.NewBucket(client.Database(db))
+	if err != nil {
+		return nil, repo.RepoError{
+			Err: err,
+		}
+	}
+
+	return &Repo{
+		bucket: bucket,
+	}, nil
+}
+
+// Save stores the content of rd as the file with the ID and name. An existing
+// file with the ID is replaced. The content is uploaded as a new revision of
+// the file before the old revisions are removed, so that a failed upload keeps
+// the old content.
+func (r *Repo) Save(id, name string, rd io.Reader) error {
+	if id == "" {
+		return repo.RepoError{
+			Err: repo.ErrMissingEntityID,
+		}
+	}
+
+	old, err := r.revisions(id)
+	if err != nil {
+		return err
+	}
+
+	opts := options.GridFSUpload().SetMetadata(bson.M{idField: id})
+	if err := r.bucket.UploadFromStreamWithID(primitive.NewObjectID(), name, rd, opts); err != nil {
+		return repo.RepoError{
+			Err:     repo.ErrCouldNotSaveEntity,
+			BaseErr: err,
+		}
+	}
+
+	for _, fileID := range old {
+		if err := r.bucket.Delete(fileID); err != nil && !errors.Is(err, gridfs.ErrFileNotFound) {
+			return repo.RepoError{
+				Err:     repo.ErrCouldNotSaveEntity,
+				BaseErr: err,
+			}
+		}
+	}
+
+	return nil
+}
+
+// Open returns a reader for the content of the file with the ID. The reader
+// must be closed.
+func (r *Repo) Open(id string) (io.ReadCloser, error) {
+	revisions, err := r.revisions(id)
+	if err != nil {
+		return nil, err
+	}
+	if len(revisions) == 0 {
+		return nil, repo.RepoError{
+			Err: repo.ErrEntityNotFound,
+		}
+	}
+
+	stream, err := r.bucket.OpenDownloadStream(revisions[0])
+	if err != nil {
+		return nil, fileError(err)
+	}
+
+	return stream, nil
+}
+
+// Remove removes the file with the ID.
+func (r *Repo) Remove(id string) error {
+	revisions, err := r.revisions(id)
+	if err != nil {
+		return err
+	}
+	if len(revisions) == 0 {
+		return repo.RepoError{
+			Err: repo.ErrEntityNotFound,
+		}
+	}
+
+	for _, fileID := range revisions {
+		if err := r.bucket.Delete(fileID); err != nil && !errors.Is(err, gridfs.ErrFileNotFound) {
+			return fileError(err)
+		}
+	}
+
+	return nil
+}
+
+// idField is the metadata field of the stored files with the ID of the file
+// in the repo. Each save stores a new revision with its own file ID.
+const idField = "id"
+
+// revisions returns the file IDs of the stored revisions of the file with the
+// ID, newest first.
+func (r *Repo) revisions(id string) ([]interface{}, error) {
+	ctx := context.Background()
+	opts := options.GridFSFind().SetSort(bson.D{
+		{Key: "uploadDate", Value: -1},
+		{Key: "_id", Value: -1},
+	})
+	cursor, err := r.bucket.FindContext(ctx, bson.M{"metadata." + idField: id}, opts)
+	if err != nil {
+		return nil, fileError(err)
+	}
+
+	var files []struct {
+		ID interface{} `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &files); err != nil {
+		return nil, fileError(err)
+	}
+
+	ids := make([]interface{}, len(files))
+	for i, f := range files {
+		ids[i] = f.ID
+	}
+	return ids, nil
+}
+
+func fileError(err error) error {
+	if errors.Is(err, gridfs.ErrFileNotFound) {
+		return repo.RepoError{
+			Err:     repo.ErrEntityNotFound,
+			BaseErr: err,
+		}
+	}
+	return repo.RepoError{
+		Err: err,
+	}
+}
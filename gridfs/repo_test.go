@@ -0,0 +1,129 @@
+package gridfs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jeek120/repo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"io"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+)
+
+// newTestRepo returns a repo on a new database. The test is skipped if there
+// is no MongoDB server at MONGODB_ADDR, localhost:27017 by default.
+func newTestRepo(t *testing.T) *Repo {
+	addr := os.Getenv("MONGODB_ADDR")
+	if addr == "" {
+		addr = "localhost:27017"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().
+		ApplyURI("mongodb://"+addr).
+		SetServerSelectionTimeout(time.Second))
+	if err == nil {
+		err = client.Ping(ctx, nil)
+	}
+	if err != nil {
+		t.Skip("no MongoDB server:", err)
+	}
+
+	db := fmt.Sprintf("test-%d", time.Now().UnixNano())
+	r, err := NewRepo(client, db)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	t.Cleanup(func() {
+		client.Database(db).Drop(context.Background())
+		client.Disconnect(context.Background())
+	})
+
+	return r
+}
+
+func read(t *testing.T, r *Repo, id string) []byte {
+	rd, err := r.Open(id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer rd.Close()
+
+	b, err := io.ReadAll(rd)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	return b
+}
+
+func isNotFound(err error) bool {
+	rrErr, ok := err.(repo.RepoError)
+	return ok && rrErr.Err == repo.ErrEntityNotFound
+}
+
+func TestRepo(t *testing.T) {
+	r := newTestRepo(t)
+
+	if _, err := r.Open("blob"); !isNotFound(err) {
+		t.Error("there should be a not found error:", err)
+	}
+
+	// Larger than the maximum BSON document size.
+	blob := make([]byte, 20<<20)
+	rand.New(rand.NewSource(1)).Read(blob)
+	if err := r.Save("blob", "blob.bin", bytes.NewReader(blob)); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if b := read(t, r, "blob"); !bytes.Equal(b, blob) {
+		t.Error("the content should be correct:", len(b))
+	}
+
+	if err := r.Remove("blob"); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := r.Open("blob"); !isNotFound(err) {
+		t.Error("there should be a not found error:", err)
+	}
+	if err := r.Remove("blob"); !isNotFound(err) {
+		t.Error("there should be a not found error:", err)
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("read error")
+}
+
+func TestRepoReplace(t *testing.T) {
+	r := newTestRepo(t)
+
+	if err := r.Save("file", "file.txt", bytes.NewReader([]byte("old"))); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := r.Save("file", "file.txt", bytes.NewReader([]byte("new"))); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if b := read(t, r, "file"); string(b) != "new" {
+		t.Error("the content should be replaced:", string(b))
+	}
+	n, err := r.bucket.GetFilesCollection().CountDocuments(context.Background(), bson.M{})
+	if err != nil || n != 1 {
+		t.Error("the old revision should be removed:", n, err)
+	}
+
+	// A failed upload keeps the stored content.
+	if err := r.Save("file", "file.txt", io.MultiReader(bytes.NewReader([]byte("partial")), failingReader{})); err == nil {
+		t.Error("there should be an error")
+	}
+	if b := read(t, r, "file"); string(b) != "new" {
+		t.Error("the content should be kept:", string(b))
+	}
+}
@@ -0,0 +1,220 @@
+// Package mocks contains mocks for testing the repos and middlewares.
+package mocks
+
+import (
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ModelType is the data type of Model.
+const ModelType eventbus.DataType = "Model"
+
+// Model is a mocked entity.
+type Model struct {
+	ID        eventbus.DataId `json:"id"         bson:"_id"`
+	Content   string          `json:"content"    bson:"content"`
+	CreatedAt time.Time       `json:"created_at" bson:"created_at"`
+}
+
+// Id implements the Id method of the eventbus.Data interface.
+func (m *Model) Id() eventbus.DataId {
+	return m.ID
+}
+
+// DataType implements the DataType method of the eventbus.Data interface.
+func (m *Model) DataType() eventbus.DataType {
+	return ModelType
+}
+
+// Repo is a mocked in-memory repo. It counts the calls of each method and can
+// be made to fail all operations, to assert what reaches the inner repo of a
+// middleware.
+type Repo struct {
+	ParentRepo repo.ReadRepo
+
+	mu    sync.RWMutex
+	datas map[string]map[eventbus.DataId]eventbus.Data
+	err   error
+	calls map[string]int
+}
+
+// NewRepo creates a new empty Repo.
+func NewRepo() *Repo {
+	return &Repo{
+		datas: map[string]map[eventbus.DataId]eventbus.Data{},
+		calls: map[string]int{},
+	}
+}
+
+// SetError makes all operations fail with err, or succeed again if nil.
+func (r *Repo) SetError(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.err = err
+}
+
+// Calls returns the number of calls of a method, by name.
+func (r *Repo) Calls(method string) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.calls[method]
+}
+
+// ResetCalls resets the call counts.
+func (r *Repo) ResetCalls() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls = map[string]int{}
+}
+
+// Parent implements the Parent method of the eventhorizon.ReadRepo interface.
+func (r *Repo) Parent() repo.ReadRepo {
+	return r.ParentRepo
+}
+
+// Find implements the Find method of the eventhorizon.ReadRepo interface.
+func (r *Repo) Find(data eventbus.Data) (eventbus.Data, error) {
+	return r.find("Find", string(data.DataType()), data.Id())
+}
+
+// FindById implements the FindById method of the eventhorizon.ReadRepo interface.
+func (r *Repo) FindById(ns string, id eventbus.DataId) (eventbus.Data, error) {
+	return r.find("FindById", ns, id)
+}
+
+func (r *Repo) find(method, ns string, id eventbus.DataId) (eventbus.Data, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls[method]++
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	data, ok := r.datas[ns][id]
+	if !ok {
+		return nil, repo.RepoError{
+			Err: repo.ErrEntityNotFound,
+		}
+	}
+	return data, nil
+}
+
+// FindByIds implements the FindByIds method of the eventhorizon.ReadRepo interface.
+func (r *Repo) FindByIds(ns string, ids []eventbus.DataId) ([]eventbus.Data, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls["FindByIds"]++
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	result := []eventbus.Data{}
+	for _, id := range ids {
+		if data, ok := r.datas[ns][id]; ok {
+			result = append(result, data)
+		}
+	}
+	return result, nil
+}
+
+// FindAll implements the FindAll method of the eventhorizon.ReadRepo interface.
+// The entities are sorted by ID.
+func (r *Repo) FindAll(ns string) ([]eventbus.Data, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls["FindAll"]++
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	return r.all(ns), nil
+}
+
+// FindAllIter implements the FindAllIter method of the eventhorizon.ReadRepo interface.
+func (r *Repo) FindAllIter(ns string) (repo.Iter, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls["FindAllIter"]++
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	return repo.NewSliceIter(r.all(ns)), nil
+}
+
+func (r *Repo) all(ns string) []eventbus.Data {
+	result := make([]eventbus.Data, 0, len(r.datas[ns]))
+	for _, data := range r.datas[ns] {
+		result = append(result, data)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Id() < result[j].Id()
+	})
+	return result
+}
+
+// Count implements the Count method of the eventhorizon.ReadRepo interface.
+func (r *Repo) Count(ns string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls["Count"]++
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	return int64(len(r.datas[ns])), nil
+}
+
+// Save implements the Save method of the eventhorizon.WriteRepo interface.
+func (r *Repo) Save(data eventbus.Data) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls["Save"]++
+	if r.err != nil {
+		return r.err
+	}
+	if data.Id() == "" {
+		return repo.RepoError{
+			Err: repo.ErrMissingEntityID,
+		}
+	}
+
+	ns := string(data.DataType())
+	if r.datas[ns] == nil {
+		r.datas[ns] = map[eventbus.DataId]eventbus.Data{}
+	}
+	r.datas[ns][data.Id()] = data
+	return nil
+}
+
+// Remove implements the Remove method of the eventhorizon.WriteRepo interface.
+func (r *Repo) Remove(data eventbus.Data) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls["Remove"]++
+	if r.err != nil {
+		return r.err
+	}
+
+	ns := string(data.DataType())
+	if _, ok := r.datas[ns][data.Id()]; !ok {
+		return repo.RepoError{
+			Err: repo.ErrEntityNotFound,
+		}
+	}
+	delete(r.datas[ns], data.Id())
+	return nil
+}
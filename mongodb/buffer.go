@@ -0,0 +1,265 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo"
+	"go.mongodb.org/mongo-driver/mongo"
+	"sync"
+)
+
+// WriteBuffer is a repo that buffers saves and writes them with one bulk write
+// per collection when the batch size is reached or Flush is called. Buffered
+// saves are not visible to reads until they are flushed. All writes of the
+// entities must go through the buffer, as a write made directly on the Repo
+// could be overwritten by an older buffered save.
+type WriteBuffer struct {
+	r         *Repo
+	batchSize int
+	pending   map[string][]bufferedSave
+	n         int
+	mu        sync.Mutex
+}
+
+type bufferedSave struct {
+	data  eventbus.Data
+	model mongo.WriteModel
+}
+
+// FlushError is the error of a flush of a WriteBuffer. Saves rejected by the
+// server, for example for a duplicate key, are dropped from the buffer and
+// reported once in Rejected. Err is the error that stopped the flush, if any,
+// the saves that were not applied stay buffered to be retried by the next
+// flush.
+type FlushError struct {
+	Rejected []RejectedSave
+	Err      error
+}
+
+// RejectedSave is a buffered save rejected by the server.
+type RejectedSave struct {
+	Data eventbus.Data
+	Err  mongo.WriteError
+}
+
+// Error implements the Error method of the error interface.
+func (e *FlushError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("flush: %s (%d saves rejected)", e.Err, len(e.Rejected))
+	}
+	return fmt.Sprintf("flush: %d saves rejected, first %s: %s", len(e.Rejected), e.Rejected[0].Data.Id(), e.Rejected[0].Err.Message)
+}
+
+// Unwrap returns the error that stopped the flush.
+func (e *FlushError) Unwrap() error {
+	return e.Err
+}
+
+// NewWriteBuffer creates a new WriteBuffer writing to r in batches of batchSize.
+func NewWriteBuffer(r *Repo, batchSize int) *WriteBuffer {
+	return &WriteBuffer{
+		r:         r,
+		batchSize: batchSize,
+		pending:   map[string][]bufferedSave{},
+	}
+}
+
+// Parent implements the Parent method of the eventhorizon.ReadRepo interface.
+func (b *WriteBuffer) Parent() repo.ReadRepo {
+	return b.r
+}
+
+// Find implements the Find method of the eventhorizon.ReadRepo interface.
+func (b *WriteBuffer) Find(data eventbus.Data) (eventbus.Data, error) {
+	return b.r.Find(data)
+}
+
+// FindById implements the FindById method of the eventhorizon.ReadRepo interface.
+func (b *WriteBuffer) FindById(ns string, id eventbus.DataId) (eventbus.Data, error) {
+	return b.r.FindById(ns, id)
+}
+
+// FindByIds implements the FindByIds method of the eventhorizon.ReadRepo interface.
+func (b *WriteBuffer) FindByIds(ns string, ids []eventbus.DataId) ([]eventbus.Data, error) {
+	return b.r.FindByIds(ns, ids)
+}
+
+// FindAll implements the FindAll method of the eventhorizon.ReadRepo interface.
+func (b *WriteBuffer) FindAll(ns string) ([]eventbus.Data, error) {
+	return b.r.FindAll(ns)
+}
+
+// FindAllIter implements the FindAllIter method of the eventhorizon.ReadRepo interface.
+func (b *WriteBuffer) FindAllIter(ns string) (repo.Iter, error) {
+	return b.r.FindAllIter(ns)
+}
+
+// Count implements the Count method of the eventhorizon.ReadRepo interface.
+func (b *WriteBuffer) Count(ns string) (int64, error) {
+	return b.r.Count(ns)
+}
+
+// Save implements the Save method of the eventhorizon.WriteRepo interface. The
+// entity is buffered, unless an error other than a *FlushError is returned. A
+// *FlushError is the error of the flush of a full batch, the entity must not
+// be saved again.
+func (b *WriteBuffer) Save(data eventbus.Data) error {
+	filter, update, err := b.r.saveUpdate(data)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ns := string(data.DataType())
+	b.pending[ns] = append(b.pending[ns], bufferedSave{
+		data: data,
+		model: mongo.NewUpdateOneModel().
+			SetFilter(filter).
+			SetUpdate(update).
+			SetUpsert(true),
+	})
+	b.n++
+
+	if b.n >= b.batchSize {
+		return b.flush()
+	}
+	return nil
+}
+
+// Remove implements the Remove method of the eventhorizon.WriteRepo interface.
+// Buffered saves of the entity are discarded so that they can not recreate it,
+// the entity is then removed even if it was never written.
+func (b *WriteBuffer) Remove(data eventbus.Data) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ns := string(data.DataType())
+	var saves []bufferedSave
+	for _, save := range b.pending[ns] {
+		if save.data.Id() != data.Id() {
+			saves = append(saves, save)
+		}
+	}
+	buffered := len(saves) < len(b.pending[ns])
+	b.n -= len(b.pending[ns]) - len(saves)
+	if len(saves) > 0 {
+		b.pending[ns] = saves
+	} else {
+		delete(b.pending, ns)
+	}
+
+	err := b.r.Remove(data)
+	if rrErr, ok := err.(repo.RepoError); ok && rrErr.Err == repo.ErrEntityNotFound && buffered {
+		return nil
+	}
+	return err
+}
+
+// Flush writes all pending saves. The error, if any, is a *FlushError.
+func (b *WriteBuffer) Flush() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.flush()
+}
+
+func (b *WriteBuffer) flush() error {
+	ctx := context.Background()
+	flushErr := &FlushError{}
+	for ns, saves := range b.pending {
+		for len(saves) > 0 && flushErr.Err == nil {
+			models := make([]mongo.WriteModel, len(saves))
+			for i, save := range saves {
+				models[i] = save.model
+			}
+
+			_, err := b.r.bulkWrite(ctx, "BulkWrite", ns, models)
+			if err == nil {
+				saves = nil
+				break
+			}
+
+			// The writes are ordered, the saves after a rejected save were
+			// not attempted and are written by the next bulk write.
+			left := len(notApplied(models, err))
+			if we, ok := firstWriteError(err); ok {
+				flushErr.Rejected = append(flushErr.Rejected, RejectedSave{
+					Data: saves[len(saves)-left].data,
+					Err:  we,
+				})
+				left--
+			} else {
+				flushErr.Err = err
+			}
+			saves = saves[len(saves)-left:]
+		}
+
+		b.n -= len(b.pending[ns]) - len(saves)
+		if len(saves) > 0 {
+			b.pending[ns] = saves
+		} else {
+			delete(b.pending, ns)
+		}
+		if flushErr.Err != nil {
+			break
+		}
+	}
+
+	if flushErr.Err != nil || len(flushErr.Rejected) > 0 {
+		return flushErr
+	}
+	return nil
+}
+
+// notApplied returns the models of an ordered bulk write that were not applied
+// because of the error: the model that failed and the ones after it, which
+// were not attempted. All models are returned if the error does not tell which
+// failed, none for a write concern error without write errors.
+func notApplied(models []mongo.WriteModel, err error) []mongo.WriteModel {
+	var bwErr mongo.BulkWriteException
+	if !errors.As(unwrapRepoError(err), &bwErr) {
+		return models
+	}
+	if len(bwErr.WriteErrors) == 0 {
+		return nil
+	}
+
+	we, _ := firstWriteError(err)
+	return models[we.Index:]
+}
+
+// firstWriteError returns the write error of the first failed model of a bulk
+// write, if the error has write errors.
+func firstWriteError(err error) (mongo.WriteError, bool) {
+	var bwErr mongo.BulkWriteException
+	if !errors.As(unwrapRepoError(err), &bwErr) || len(bwErr.WriteErrors) == 0 {
+		return mongo.WriteError{}, false
+	}
+
+	first := bwErr.WriteErrors[0].WriteError
+	for _, we := range bwErr.WriteErrors {
+		if we.Index < first.Index {
+			first = we.WriteError
+		}
+	}
+	return first, true
+}
+
+func unwrapRepoError(err error) error {
+	if rrErr, ok := err.(repo.RepoError); ok {
+		return rrErr.BaseErr
+	}
+	return err
+}
+
+// Close flushes the pending saves and closes the database session.
+func (b *WriteBuffer) Close() error {
+	err := b.Flush()
+	b.r.Close()
+
+	return err
+}
@@ -0,0 +1,196 @@
+package mongodb
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jeek120/repo"
+	"github.com/jeek120/repo/mocks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWriteBuffer(t *testing.T) {
+	r := newTestRepo(t)
+	ns := string(mocks.ModelType)
+
+	var mu sync.Mutex
+	var bulkWrites int
+	r.SetSlowQueryThreshold(0, func(op, ns string, dur time.Duration) {
+		if op == "BulkWrite" {
+			mu.Lock()
+			bulkWrites++
+			mu.Unlock()
+		}
+	})
+
+	b := NewWriteBuffer(r, 500)
+	for i := 0; i < 2500; i++ {
+		if err := b.Save(&mocks.Model{ID: testId(i)}); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+	if bulkWrites != 5 {
+		t.Error("there should be 5 bulk writes:", bulkWrites)
+	}
+	if n, err := b.Count(ns); err != nil || n != 2500 {
+		t.Error("all entities should be written:", n, err)
+	}
+
+	// A final flush with fewer than a batch.
+	if err := b.Save(&mocks.Model{ID: "last"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if n, _ := b.Count(ns); n != 2500 {
+		t.Error("the save should be buffered:", n)
+	}
+	if err := b.Flush(); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if bulkWrites != 6 {
+		t.Error("there should be a final bulk write:", bulkWrites)
+	}
+	if _, err := b.FindById(ns, "last"); err != nil {
+		t.Error("the entity should be written:", err)
+	}
+}
+
+func TestWriteBufferRejected(t *testing.T) {
+	r := newTestRepo(t)
+	r.SetAutoVersion(true)
+	ns := string(mocks.ModelType)
+
+	if _, err := r.EnsureIndex(ns, mongo.IndexModel{
+		Keys:    bson.D{{Key: "content", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	// The second save violates the index, it is rejected and the third is
+	// still written.
+	b := NewWriteBuffer(r, 3)
+	b.Save(&mocks.Model{ID: "1", Content: "a"})
+	b.Save(&mocks.Model{ID: "2", Content: "a"})
+	err := b.Save(&mocks.Model{ID: "3", Content: "c"})
+	var flushErr *FlushError
+	if !errors.As(err, &flushErr) {
+		t.Fatal("there should be a flush error:", err)
+	}
+	if flushErr.Err != nil || len(flushErr.Rejected) != 1 || flushErr.Rejected[0].Data.Id() != "2" {
+		t.Error("the second save should be rejected:", flushErr)
+	}
+	if !mongo.IsDuplicateKeyError(flushErr.Rejected[0].Err) {
+		t.Error("the write error should be returned:", flushErr.Rejected[0].Err)
+	}
+
+	// The rejected save is dropped and reported once.
+	if err := b.Save(&mocks.Model{ID: "4", Content: "d"}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := b.Flush(); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	docs, err := r.FindRaw(ns, nil)
+	if err != nil || len(docs) != 3 {
+		t.Fatal("there should be 3 documents:", docs, err)
+	}
+	for _, doc := range docs {
+		if v := fmt.Sprint(doc["_version"]); v != "1" {
+			t.Error("each save should be applied once:", doc)
+		}
+	}
+}
+
+func TestWriteBufferRemove(t *testing.T) {
+	r := newTestRepo(t)
+	ns := string(mocks.ModelType)
+
+	b := NewWriteBuffer(r, 10)
+	if err := b.Save(&mocks.Model{ID: "1"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := b.Remove(&mocks.Model{ID: "1"}); err != nil {
+		t.Error("the buffered entity should be removed:", err)
+	}
+	if err := b.Flush(); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if _, err := b.FindById(ns, "1"); !isNotFound(err) {
+		t.Error("the removed entity should not be written:", err)
+	}
+	if err := b.Remove(&mocks.Model{ID: "1"}); !isNotFound(err) {
+		t.Error("there should be a not found error:", err)
+	}
+}
+
+func TestNotApplied(t *testing.T) {
+	models := make([]mongo.WriteModel, 5)
+	for i := range models {
+		models[i] = mongo.NewUpdateOneModel()
+	}
+
+	left := notApplied(models, mongo.BulkWriteException{
+		WriteErrors: []mongo.BulkWriteError{
+			{WriteError: mongo.WriteError{Index: 2}},
+		},
+	})
+	if len(left) != 3 || left[0] != models[2] {
+		t.Error("the failed and following models should be left:", len(left))
+	}
+
+	if left := notApplied(models, mongo.BulkWriteException{
+		WriteConcernError: &mongo.WriteConcernError{},
+	}); len(left) != 0 {
+		t.Error("no models should be left on a write concern error:", len(left))
+	}
+
+	if left := notApplied(models, errors.New("error")); len(left) != 5 {
+		t.Error("all models should be left on an unknown error:", len(left))
+	}
+}
+
+func TestFirstWriteError(t *testing.T) {
+	err := repo.RepoError{
+		Err: repo.ErrCouldNotSaveEntity,
+		BaseErr: mongo.BulkWriteException{
+			WriteErrors: []mongo.BulkWriteError{
+				{WriteError: mongo.WriteError{Index: 3, Code: 1}},
+				{WriteError: mongo.WriteError{Index: 1, Code: 11000}},
+			},
+		},
+	}
+	if we, ok := firstWriteError(err); !ok || we.Index != 1 || we.Code != 11000 {
+		t.Error("the write error of the first failed model should be returned:", we, ok)
+	}
+
+	if _, ok := firstWriteError(mongo.BulkWriteException{
+		WriteConcernError: &mongo.WriteConcernError{},
+	}); ok {
+		t.Error("there should be no write error")
+	}
+	if _, ok := firstWriteError(errors.New("error")); ok {
+		t.Error("there should be no write error")
+	}
+}
+
+func TestFlushError(t *testing.T) {
+	err := &FlushError{
+		Rejected: []RejectedSave{{
+			Data: &mocks.Model{ID: "1"},
+			Err:  mongo.WriteError{Message: "duplicate key"},
+		}},
+	}
+	if msg := err.Error(); msg != "flush: 1 saves rejected, first 1: duplicate key" {
+		t.Error("the rejected saves should be reported:", msg)
+	}
+
+	baseErr := errors.New("error")
+	err.Err = baseErr
+	if !errors.Is(err, baseErr) {
+		t.Error("the error that stopped the flush should be unwrapped")
+	}
+}
@@ -0,0 +1,109 @@
+package mongodb
+
+import (
+	"context"
+	"github.com/jeek120/eventbus"
+	"go.mongodb.org/mongo-driver/mongo"
+	"time"
+)
+
+// SaveResult is the result of saving one entity with SaveAllResult.
+type SaveResult struct {
+	// Id is the ID of the entity.
+	Id eventbus.DataId
+	// Created is set if the entity was inserted, and unset if it was updated.
+	Created bool
+}
+
+// SaveAll saves many entities with one bulk write per collection.
+func (r *Repo) SaveAll(datas []eventbus.Data) error {
+	_, err := r.SaveAllResult(datas)
+	return err
+}
+
+// SaveAllResult saves many entities with one bulk write per collection and
+// reports for each entity, in order, whether it was inserted or updated.
+func (r *Repo) SaveAllResult(datas []eventbus.Data) ([]SaveResult, error) {
+	results := make([]SaveResult, len(datas))
+	models := map[string][]mongo.WriteModel{}
+	// indexes maps the index of a model in its collection to the index of
+	// the entity in datas.
+	indexes := map[string][]int{}
+	var order []string
+	for i, data := range datas {
+		filter, update, err := r.saveUpdate(data)
+		if err != nil {
+			return nil, err
+		}
+
+		ns := string(data.DataType())
+		if _, ok := models[ns]; !ok {
+			order = append(order, ns)
+		}
+		models[ns] = append(models[ns], mongo.NewUpdateOneModel().
+			SetFilter(filter).
+			SetUpdate(update).
+			SetUpsert(true))
+		indexes[ns] = append(indexes[ns], i)
+		results[i].Id = data.Id()
+	}
+
+	ctx := context.Background()
+	for _, ns := range order {
+		res, err := r.bulkWrite(ctx, "SaveAll", ns, models[ns])
+		if err != nil {
+			return nil, err
+		}
+		for i := range res.UpsertedIDs {
+			results[indexes[ns][i]].Created = true
+		}
+	}
+
+	return results, nil
+}
+
+// MergeAll loads the entities with the IDs, applies merge to each and writes
+// them back with one bulk write. IDs that are not found are skipped, as are
+// entities removed before the write. If merge returns an error nothing is
+// written and the error is returned.
+func (r *Repo) MergeAll(ns string, ids []eventbus.DataId, merge func(eventbus.Data) error) error {
+	entities, err := r.FindByIds(ns, ids)
+	if err != nil {
+		return err
+	}
+	if len(entities) == 0 {
+		return nil
+	}
+
+	models := make([]mongo.WriteModel, 0, len(entities))
+	for _, entity := range entities {
+		if err := merge(entity); err != nil {
+			return err
+		}
+
+		filter, update, err := r.saveUpdate(entity)
+		if err != nil {
+			return err
+		}
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(filter).
+			SetUpdate(update))
+	}
+
+	_, err = r.bulkWrite(context.Background(), "MergeAll", ns, models)
+	return err
+}
+
+// bulkWrite does an ordered bulk write of the models. All the bulk saves go
+// through it, and are counted in the metrics as one save each.
+func (r *Repo) bulkWrite(ctx context.Context, op, ns string, models []mongo.WriteModel) (_ *mongo.BulkWriteResult, err error) {
+	defer r.countOp(&r.metrics.saves, &err)
+	defer r.trackSlow(op, ns, time.Now())
+
+	res, err := r.collection(ns).BulkWrite(ctx, models)
+	if err != nil {
+		return nil, writeError(err)
+	}
+
+	return res, nil
+}
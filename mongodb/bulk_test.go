@@ -0,0 +1,90 @@
+package mongodb
+
+import (
+	"errors"
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo/mocks"
+	"reflect"
+	"testing"
+)
+
+func TestRepoSaveAllResult(t *testing.T) {
+	r := newTestRepo(t)
+	r.RegisterFactory("User", func() eventbus.Data {
+		return &User{}
+	})
+
+	if err := r.Save(&mocks.Model{ID: "2", Content: "old"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := r.Save(&User{ID: "1", Name: "old"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	results, err := r.SaveAllResult([]eventbus.Data{
+		&mocks.Model{ID: "1"},
+		&User{ID: "1", Name: "new"},
+		&mocks.Model{ID: "2", Content: "new"},
+		&User{ID: "2"},
+		&mocks.Model{ID: "3"},
+	})
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	expected := []SaveResult{
+		{Id: "1", Created: true},
+		{Id: "1", Created: false},
+		{Id: "2", Created: false},
+		{Id: "2", Created: true},
+		{Id: "3", Created: true},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("the results should be reported per entity: %+v", results)
+	}
+
+	if entity, err := r.FindById("User", "1"); err != nil || entity.(*User).Name != "new" {
+		t.Error("the existing entity should be updated:", entity, err)
+	}
+	if n, err := r.Count(string(mocks.ModelType)); err != nil || n != 3 {
+		t.Error("all entities should be saved:", n, err)
+	}
+}
+
+func TestRepoMergeAll(t *testing.T) {
+	r := newTestOrders(t)
+
+	if err := r.MergeAll("Order", []eventbus.DataId{"1", "3", "5"}, func(entity eventbus.Data) error {
+		entity.(*Order).Total += 100
+		return nil
+	}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	entities, err := r.FindAll("Order")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	totals := map[eventbus.DataId]int{}
+	for _, e := range entities {
+		totals[e.Id()] = e.(*Order).Total
+	}
+	expected := map[eventbus.DataId]int{"1": 130, "2": 10, "3": 120, "4": 40}
+	if !reflect.DeepEqual(totals, expected) {
+		t.Error("only the merged entities should be mutated:", totals)
+	}
+
+	// Nothing is written if a merge fails.
+	mergeErr := errors.New("merge error")
+	if err := r.MergeAll("Order", []eventbus.DataId{"2", "4"}, func(entity eventbus.Data) error {
+		if entity.Id() == "4" {
+			return mergeErr
+		}
+		entity.(*Order).Total = 0
+		return nil
+	}); err != mergeErr {
+		t.Error("the merge error should be returned:", err)
+	}
+	if entity, err := r.FindById("Order", "2"); err != nil || entity.(*Order).Total != 10 {
+		t.Error("the entity should not be written:", entity, err)
+	}
+}
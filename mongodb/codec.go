@@ -0,0 +1,85 @@
+package mongodb
+
+import (
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// StorageCodec maps entities to and from the documents stored in MongoDB.
+type StorageCodec interface {
+	// Encode encodes an entity to a document.
+	Encode(eventbus.Data) (bson.M, error)
+	// Decode decodes a document into an entity.
+	Decode(bson.M, eventbus.Data) error
+}
+
+// BSONCodec is the default StorageCodec, it maps entities directly to
+// documents using their BSON struct tags.
+type BSONCodec struct{}
+
+// Encode implements the Encode method of the StorageCodec interface.
+func (BSONCodec) Encode(data eventbus.Data) (bson.M, error) {
+	b, err := bson.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := bson.M{}
+	if err := bson.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// Decode implements the Decode method of the StorageCodec interface.
+func (BSONCodec) Decode(doc bson.M, data eventbus.Data) error {
+	b, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	return bson.Unmarshal(b, data)
+}
+
+// SetStorageCodec sets the codec used to map entities to documents. A nil
+// codec maps entities directly with their BSON struct tags, like BSONCodec.
+func (r *Repo) SetStorageCodec(codec StorageCodec) {
+	r.codec = codec
+}
+
+// decoder is a cursor or single result that can be decoded.
+type decoder interface {
+	Decode(v interface{}) error
+}
+
+// decode decodes the current document of d into the entity, using the codec
+// if one is set.
+func (r *Repo) decode(d decoder, data eventbus.Data) error {
+	if r.codec == nil {
+		return d.Decode(data)
+	}
+
+	doc := bson.M{}
+	if err := d.Decode(&doc); err != nil {
+		return err
+	}
+	return r.codec.Decode(doc, data)
+}
+
+// encode encodes the entity to a document, using the codec if one is set.
+func (r *Repo) encode(data eventbus.Data) (bson.M, error) {
+	var codec StorageCodec = BSONCodec{}
+	if r.codec != nil {
+		codec = r.codec
+	}
+
+	doc, err := codec.Encode(data)
+	if err != nil {
+		return nil, repo.RepoError{
+			Err:     repo.ErrCouldNotSaveEntity,
+			BaseErr: err,
+		}
+	}
+	return doc, nil
+}
@@ -0,0 +1,75 @@
+package mongodb
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo/mocks"
+	"go.mongodb.org/mongo-driver/bson"
+	"testing"
+	"time"
+)
+
+// jsonCodec stores entities as a JSON blob in the data field.
+type jsonCodec struct{}
+
+func (jsonCodec) Encode(data eventbus.Data) (bson.M, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return bson.M{"_id": data.Id(), "data": string(b)}, nil
+}
+
+func (jsonCodec) Decode(doc bson.M, data eventbus.Data) error {
+	return json.Unmarshal([]byte(doc["data"].(string)), data)
+}
+
+func TestBSONCodec(t *testing.T) {
+	m := &mocks.Model{ID: "1", Content: "content", CreatedAt: time.Now().Round(time.Millisecond).UTC()}
+	doc, err := BSONCodec{}.Encode(m)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if doc["_id"] != "1" || doc["content"] != "content" {
+		t.Error("the document should use the BSON struct tags:", doc)
+	}
+
+	decoded := &mocks.Model{}
+	if err := (BSONCodec{}).Decode(doc, decoded); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if *decoded != *m {
+		t.Errorf("the entity should be round-tripped: %+v", decoded)
+	}
+}
+
+func TestRepoStorageCodec(t *testing.T) {
+	r := newTestRepo(t)
+	r.SetStorageCodec(jsonCodec{})
+	ns := string(mocks.ModelType)
+
+	m := &mocks.Model{ID: "1", Content: "content", CreatedAt: time.Now().Round(time.Millisecond).UTC()}
+	if err := r.Save(m); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	var doc bson.M
+	if err := r.collection(ns).FindOne(context.Background(), bson.M{"_id": "1"}).Decode(&doc); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if _, ok := doc["data"].(string); !ok || len(doc) != 2 {
+		t.Error("the entity should be stored as a JSON blob:", doc)
+	}
+
+	entity, err := r.FindById(ns, "1")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if decoded := entity.(*mocks.Model); !decoded.CreatedAt.Equal(m.CreatedAt) || decoded.Content != m.Content || decoded.ID != m.ID {
+		t.Errorf("the entity should be round-tripped: %+v", decoded)
+	}
+	if entities, err := r.FindAll(ns); err != nil || len(entities) != 1 {
+		t.Error("the entity should be found:", entities, err)
+	}
+}
@@ -0,0 +1,64 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	"time"
+)
+
+// ErrWriteConcernTimeout is when a write was not acknowledged as required by
+// the write concern in time. The write may still be applied.
+var ErrWriteConcernTimeout = errors.New("write concern timeout")
+
+// writeConcernFailed is the server error code of a write concern that was not
+// satisfied in time.
+const writeConcernFailed = 64
+
+type contextKey int
+
+const writeConcernKey contextKey = iota
+
+// WithWriteConcern returns a context with a write concern that overrides the
+// write concern of the client for the writes done with it, like SaveContext.
+func WithWriteConcern(ctx context.Context, wc *writeconcern.WriteConcern) context.Context {
+	return context.WithValue(ctx, writeConcernKey, wc)
+}
+
+// writeCollection returns the collection with the write concern of the
+// context, if any.
+func (r *Repo) writeCollection(ctx context.Context, name string) *mongo.Collection {
+	if wc, ok := ctx.Value(writeConcernKey).(*writeconcern.WriteConcern); ok && wc != nil {
+		return r.collection(name, options.Collection().SetWriteConcern(wc))
+	}
+	return r.collection(name)
+}
+
+// SaveAndWait saves the entity like Save and waits until the write concern is
+// satisfied, for example until the write is replicated to a majority with
+// writeconcern.Majority(). If it is not satisfied within timeout
+// ErrWriteConcernTimeout is returned. A nil write concern waits for a majority.
+func (r *Repo) SaveAndWait(data eventbus.Data, wc *writeconcern.WriteConcern, timeout time.Duration) error {
+	if wc == nil {
+		wc = writeconcern.Majority()
+	}
+	w := *wc
+	w.WTimeout = timeout
+
+	err := r.SaveContext(WithWriteConcern(context.Background(), &w), data)
+	if rrErr, ok := err.(repo.RepoError); ok {
+		var we mongo.WriteException
+		if errors.As(rrErr.BaseErr, &we) && we.WriteConcernError != nil && we.WriteConcernError.Code == writeConcernFailed {
+			return repo.RepoError{
+				Err:     ErrWriteConcernTimeout,
+				BaseErr: rrErr.BaseErr,
+			}
+		}
+	}
+
+	return err
+}
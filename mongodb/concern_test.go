@@ -0,0 +1,109 @@
+package mongodb
+
+import (
+	"context"
+	"github.com/jeek120/repo"
+	"github.com/jeek120/repo/mocks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRepoWithWriteConcern(t *testing.T) {
+	// The write concerns of the update commands sent to the server.
+	var mu sync.Mutex
+	var concerns []bson.Raw
+	monitor := &event.CommandMonitor{
+		Started: func(_ context.Context, e *event.CommandStartedEvent) {
+			if e.CommandName != "update" {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+
+			wc, _ := e.Command.Lookup("writeConcern").DocumentOK()
+			concerns = append(concerns, wc)
+		},
+	}
+	r := newTestRepo(t, func(opts *options.ClientOptions) {
+		opts.SetMonitor(monitor)
+		opts.SetWriteConcern(writeconcern.Majority())
+	})
+
+	if err := r.Save(&mocks.Model{ID: "1"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	ctx := WithWriteConcern(context.Background(), writeconcern.W1())
+	if err := r.SaveContext(ctx, &mocks.Model{ID: "2"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(concerns) != 2 {
+		t.Fatal("there should be two updates:", len(concerns))
+	}
+	if w := concerns[0].Lookup("w").StringValue(); w != "majority" {
+		t.Error("the write concern of the client should be used:", concerns[0])
+	}
+	if w := concerns[1].Lookup("w").AsInt64(); w != 1 {
+		t.Error("the write concern of the context should be used:", concerns[1])
+	}
+}
+
+func TestRepoSaveAndWait(t *testing.T) {
+	// The write concerns of the update commands sent to the server.
+	var mu sync.Mutex
+	var concerns []bson.Raw
+	monitor := &event.CommandMonitor{
+		Started: func(_ context.Context, e *event.CommandStartedEvent) {
+			if e.CommandName != "update" {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+
+			wc, _ := e.Command.Lookup("writeConcern").DocumentOK()
+			concerns = append(concerns, wc)
+		},
+	}
+	r := newTestRepo(t, func(opts *options.ClientOptions) {
+		opts.SetMonitor(monitor)
+	})
+	skipStandalone(t, r, "a majority needs a replica set")
+
+	if err := r.SaveAndWait(&mocks.Model{ID: "1"}, nil, 5*time.Second); err != nil {
+		t.Fatal("the write should be acknowledged by a majority:", err)
+	}
+	mu.Lock()
+	if len(concerns) != 1 || concerns[0].Lookup("w").StringValue() != "majority" ||
+		concerns[0].Lookup("wtimeout").AsInt64() != 5000 {
+		t.Error("the write should wait for a majority:", concerns)
+	}
+	mu.Unlock()
+
+	// A write concern timeout is simulated with a fail point, which needs the
+	// test commands of the server.
+	admin := r.getClient().Database("admin")
+	if err := admin.RunCommand(context.Background(), bson.D{
+		{Key: "configureFailPoint", Value: "failCommand"},
+		{Key: "mode", Value: bson.M{"times": 1}},
+		{Key: "data", Value: bson.M{
+			"failCommands": bson.A{"update"},
+			"writeConcernError": bson.M{
+				"code":   writeConcernFailed,
+				"errmsg": "waiting for replication timed out",
+			},
+		}},
+	}).Err(); err != nil {
+		t.Skip("no failCommand fail point:", err)
+	}
+	err := r.SaveAndWait(&mocks.Model{ID: "2"}, writeconcern.Majority(), time.Second)
+	if rrErr, ok := err.(repo.RepoError); !ok || rrErr.Err != ErrWriteConcernTimeout {
+		t.Error("there should be a write concern timeout error:", err)
+	}
+}
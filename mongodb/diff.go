@@ -0,0 +1,60 @@
+package mongodb
+
+import (
+	"context"
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"reflect"
+	"time"
+)
+
+// SaveWithDiff saves the entity like Save and returns the top level fields of
+// the document that changed, with their new values. All fields are changed
+// for a new entity. The stored document is read before the write, which is not
+// atomic with it.
+func (r *Repo) SaveWithDiff(data eventbus.Data) (map[string]interface{}, error) {
+	ns := string(data.DataType())
+	defer r.trackSlow("SaveWithDiff", ns, time.Now())
+
+	filter, update, err := r.saveUpdate(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Round trip the new fields so that they have the types of decoded fields.
+	set := bson.M{}
+	if doc, ok := update["$set"].(bson.M); ok {
+		b, err := bson.Marshal(doc)
+		if err == nil {
+			err = bson.Unmarshal(b, &set)
+		}
+		if err != nil {
+			return nil, repo.RepoError{
+				Err:     repo.ErrCouldNotSaveEntity,
+				BaseErr: err,
+			}
+		}
+	}
+
+	c := r.collection(ns)
+	ctx := context.Background()
+	stored := bson.M{}
+	if err := c.FindOne(ctx, filter).Decode(&stored); err != nil && err != mongo.ErrNoDocuments {
+		return nil, findError(err)
+	}
+
+	changed := map[string]interface{}{}
+	for k, v := range set {
+		if sv, ok := stored[k]; !ok || !reflect.DeepEqual(sv, v) {
+			changed[k] = v
+		}
+	}
+
+	if _, err := r.upsert(ctx, ns, filter, update, false); err != nil {
+		return nil, err
+	}
+
+	return changed, nil
+}
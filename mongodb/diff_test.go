@@ -0,0 +1,39 @@
+package mongodb
+
+import (
+	"github.com/jeek120/repo/mocks"
+	"testing"
+	"time"
+)
+
+func TestRepoSaveWithDiff(t *testing.T) {
+	r := newTestRepo(t)
+
+	m := &mocks.Model{ID: "1", Content: "old", CreatedAt: time.Now()}
+	changed, err := r.SaveWithDiff(m)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if _, ok := changed["content"]; !ok || len(changed) != 2 {
+		t.Error("all fields of a new entity should be changed:", changed)
+	}
+	if _, ok := changed["created_at"]; !ok {
+		t.Error("all fields of a new entity should be changed:", changed)
+	}
+
+	m.Content = "new"
+	changed, err = r.SaveWithDiff(m)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(changed) != 1 || changed["content"] != "new" {
+		t.Error("only the modified field should be changed:", changed)
+	}
+	if entity, err := r.FindById("Model", "1"); err != nil || entity.(*mocks.Model).Content != "new" {
+		t.Error("the entity should be saved:", entity, err)
+	}
+
+	if changed, err := r.SaveWithDiff(m); err != nil || len(changed) != 0 {
+		t.Error("there should be no changed fields:", changed, err)
+	}
+}
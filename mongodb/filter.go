@@ -0,0 +1,37 @@
+package mongodb
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Op is a comparison operator for Where.
+type Op string
+
+// The supported comparison operators.
+const (
+	Eq    Op = "$eq"
+	Ne    Op = "$ne"
+	Gt    Op = "$gt"
+	Gte   Op = "$gte"
+	Lt    Op = "$lt"
+	Lte   Op = "$lte"
+	In    Op = "$in"
+	Regex Op = "$regex"
+)
+
+// Where returns a filter comparing a field with a value. Fields of embedded
+// documents are selected with a dotted path, like "address.city". The filter
+// can be used with Query and CountFiltered, and combined with And and Or.
+func Where(field string, op Op, value interface{}) bson.M {
+	return bson.M{field: bson.M{string(op): value}}
+}
+
+// And returns a filter matching documents that match all the filters.
+func And(filters ...bson.M) bson.M {
+	return bson.M{"$and": filters}
+}
+
+// Or returns a filter matching documents that match any of the filters.
+func Or(filters ...bson.M) bson.M {
+	return bson.M{"$or": filters}
+}
@@ -0,0 +1,73 @@
+package mongodb
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"reflect"
+	"testing"
+)
+
+func TestWhere(t *testing.T) {
+	testCases := map[string]struct {
+		filter   bson.M
+		expected bson.M
+	}{
+		"eq": {
+			Where("name", Eq, "a"),
+			bson.M{"name": bson.M{"$eq": "a"}},
+		},
+		"dotted": {
+			Where("address.city", Ne, "b"),
+			bson.M{"address.city": bson.M{"$ne": "b"}},
+		},
+		"in": {
+			Where("tags", In, []string{"a", "b"}),
+			bson.M{"tags": bson.M{"$in": []string{"a", "b"}}},
+		},
+		"regex": {
+			Where("email", Regex, "^a@"),
+			bson.M{"email": bson.M{"$regex": "^a@"}},
+		},
+		"and": {
+			And(Where("total", Gte, 10), Where("total", Lt, 20)),
+			bson.M{"$and": []bson.M{
+				{"total": bson.M{"$gte": 10}},
+				{"total": bson.M{"$lt": 20}},
+			}},
+		},
+		"or of and": {
+			Or(Where("a.b", Gt, 1), And(Where("c", Lte, 2), Where("d", Eq, 3))),
+			bson.M{"$or": []bson.M{
+				{"a.b": bson.M{"$gt": 1}},
+				{"$and": []bson.M{
+					{"c": bson.M{"$lte": 2}},
+					{"d": bson.M{"$eq": 3}},
+				}},
+			}},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if !reflect.DeepEqual(tc.filter, tc.expected) {
+				t.Error("the filter should be correct:", tc.filter)
+			}
+		})
+	}
+}
+
+func TestRepoQueryWhere(t *testing.T) {
+	r := newTestOrders(t)
+
+	entities, err := r.Query("Order", QueryOptions{
+		Filter: Or(
+			And(Where("customer", Eq, "a"), Where("total", Gt, 25)),
+			Where("total", Lt, 15),
+		),
+		Sort: bson.D{{Key: "_id", Value: 1}},
+	})
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if ids := orderIds(entities); len(ids) != 2 || ids[0] != "1" || ids[1] != "2" {
+		t.Error("the matching entities should be found:", ids)
+	}
+}
@@ -0,0 +1,158 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// EnsureIndex creates the index in the namespace if it does not exist and
+// returns its name.
+func (r *Repo) EnsureIndex(ns string, model mongo.IndexModel) (string, error) {
+	c := r.collection(ns)
+	name, err := c.Indexes().CreateOne(context.Background(), model)
+	if err != nil {
+		return "", repo.RepoError{
+			Err: err,
+		}
+	}
+
+	return name, nil
+}
+
+// EnsurePartialIndex creates an index on the keys that only covers the
+// documents matching the filter, and only enforces uniqueness among them.
+func (r *Repo) EnsurePartialIndex(ns string, keys bson.D, filter bson.M, unique bool) (string, error) {
+	opts := options.Index().SetPartialFilterExpression(filter)
+	if unique {
+		opts.SetUnique(true)
+	}
+
+	return r.EnsureIndex(ns, mongo.IndexModel{
+		Keys:    keys,
+		Options: opts,
+	})
+}
+
+// DropIndex drops the index with the name in the namespace.
+func (r *Repo) DropIndex(ns string, name string) error {
+	c := r.collection(ns)
+	if _, err := c.Indexes().DropOne(context.Background(), name); err != nil {
+		return repo.RepoError{
+			Err: err,
+		}
+	}
+
+	return nil
+}
+
+// ListIndexes returns the specifications of the indexes in the namespace.
+func (r *Repo) ListIndexes(ns string) ([]bson.M, error) {
+	c := r.collection(ns)
+	ctx := context.Background()
+	cursor, err := c.Indexes().List(ctx)
+	if err != nil {
+		return nil, repo.RepoError{
+			Err: err,
+		}
+	}
+
+	result := []bson.M{}
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, repo.RepoError{
+			Err: err,
+		}
+	}
+
+	return result, nil
+}
+
+// EnsureIndexesFromType creates the indexes declared with index struct tags on
+// the fields of the entity, in the namespace of its type. The tag values are
+// comma separated:
+//
+//	Email   string    `bson:"email" index:"unique"`
+//	Name    string    `bson:"name" index:"index"`
+//	Bio     string    `bson:"bio" index:"text"`
+//	Expires time.Time `bson:"expires" index:"ttl=30s"`
+//
+// Only the top level fields of the struct are scanned.
+func (r *Repo) EnsureIndexesFromType(sample eventbus.Data) error {
+	t := reflect.TypeOf(sample)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	ns := string(sample.DataType())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, ok := f.Tag.Lookup("index")
+		if !ok || !f.IsExported() {
+			continue
+		}
+
+		name := fieldName(f)
+		if name == "-" {
+			continue
+		}
+
+		model, err := indexModel(name, tag)
+		if err != nil {
+			return repo.RepoError{
+				Err: fmt.Errorf("field %s: %w", f.Name, err),
+			}
+		}
+		if _, err := r.EnsureIndex(ns, model); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fieldName returns the name of the field in the document, as mapped by the
+// BSON codec.
+func fieldName(f reflect.StructField) string {
+	if name := strings.Split(f.Tag.Get("bson"), ",")[0]; name != "" {
+		return name
+	}
+	return strings.ToLower(f.Name)
+}
+
+// indexModel returns the index of a field for the value of its index tag.
+func indexModel(field, tag string) (mongo.IndexModel, error) {
+	var value interface{} = 1
+	opts := options.Index()
+	for _, v := range strings.Split(tag, ",") {
+		switch {
+		case v == "index":
+		case v == "unique":
+			opts.SetUnique(true)
+		case v == "text":
+			value = "text"
+		case strings.HasPrefix(v, "ttl="):
+			d, err := time.ParseDuration(strings.TrimPrefix(v, "ttl="))
+			if err != nil {
+				return mongo.IndexModel{}, err
+			}
+			opts.SetExpireAfterSeconds(int32(d.Seconds()))
+		default:
+			return mongo.IndexModel{}, fmt.Errorf("unknown index tag %q", v)
+		}
+	}
+
+	return mongo.IndexModel{
+		Keys:    bson.D{{Key: field, Value: value}},
+		Options: opts,
+	}, nil
+}
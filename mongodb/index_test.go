@@ -0,0 +1,142 @@
+package mongodb
+
+import (
+	"fmt"
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo"
+	"github.com/jeek120/repo/mocks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func indexNames(t *testing.T, r *Repo, ns string) map[string]bool {
+	indexes, err := r.ListIndexes(ns)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	names := map[string]bool{}
+	for _, index := range indexes {
+		names[index["name"].(string)] = true
+	}
+	return names
+}
+
+func TestRepoIndexes(t *testing.T) {
+	r := newTestRepo(t)
+	ns := string(mocks.ModelType)
+
+	name, err := r.EnsureIndex(ns, mongo.IndexModel{
+		Keys: bson.D{{Key: "content", Value: 1}},
+	})
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if name != "content_1" {
+		t.Error("the index name should be returned:", name)
+	}
+	if names := indexNames(t, r, ns); len(names) != 2 || !names["_id_"] || !names[name] {
+		t.Error("the index should be listed:", names)
+	}
+
+	if err := r.DropIndex(ns, name); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if names := indexNames(t, r, ns); len(names) != 1 || names[name] {
+		t.Error("the index should be dropped:", names)
+	}
+
+	if err := r.DropIndex(ns, name); err == nil {
+		t.Error("there should be an error for a missing index")
+	} else if _, ok := err.(repo.RepoError); !ok {
+		t.Error("the error should be a repo error:", err)
+	}
+}
+
+type indexedModel struct {
+	ID      eventbus.DataId `bson:"_id"`
+	Email   string          `bson:"email" index:"unique"`
+	Name    string          `bson:"name" index:"index"`
+	Bio     string          `bson:"bio" index:"text"`
+	Expires time.Time       `bson:"expires" index:"ttl=30s"`
+	Plain   string          `bson:"plain"`
+}
+
+func (m *indexedModel) Id() eventbus.DataId         { return m.ID }
+func (m *indexedModel) DataType() eventbus.DataType { return "Indexed" }
+
+func TestRepoEnsureIndexesFromType(t *testing.T) {
+	r := newTestRepo(t)
+
+	if err := r.EnsureIndexesFromType(&indexedModel{}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	indexes, err := r.ListIndexes("Indexed")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	byName := map[string]bson.M{}
+	for _, index := range indexes {
+		byName[index["name"].(string)] = index
+	}
+	if len(byName) != 5 {
+		t.Error("the tagged fields should be indexed:", byName)
+	}
+	if index, ok := byName["email_1"]; !ok || index["unique"] != true {
+		t.Error("the email index should be unique:", index)
+	}
+	if _, ok := byName["name_1"]; !ok {
+		t.Error("the name index should be created")
+	}
+	if _, ok := byName["bio_text"]; !ok {
+		t.Error("the bio text index should be created")
+	}
+	if index, ok := byName["expires_1"]; !ok || fmt.Sprint(index["expireAfterSeconds"]) != "30" {
+		t.Error("the expires index should have a TTL:", index)
+	}
+
+	// Creating the indexes again is a no-op.
+	if err := r.EnsureIndexesFromType(&indexedModel{}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+}
+
+func TestIndexModel(t *testing.T) {
+	if _, err := indexModel("field", "ttl=forever"); err == nil {
+		t.Error("there should be an error for an invalid TTL")
+	}
+	if _, err := indexModel("field", "sparse"); err == nil {
+		t.Error("there should be an error for an unknown tag")
+	}
+
+	model, err := indexModel("field", "unique,ttl=1m")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(model.Keys, bson.D{{Key: "field", Value: 1}}) ||
+		*model.Options.Unique != true || *model.Options.ExpireAfterSeconds != 60 {
+		t.Error("the tag values should be combined:", model)
+	}
+}
+
+func TestRepoEnsurePartialIndex(t *testing.T) {
+	r := newTestOrders(t)
+
+	// Only the orders with a total of at least 30 have unique customers.
+	if _, err := r.EnsurePartialIndex("Order", bson.D{{Key: "customer", Value: 1}},
+		bson.M{"total": bson.M{"$gte": 30}}, true); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	if err := r.Save(&Order{ID: "5", Customer: "a", Total: 5}); err != nil {
+		t.Error("a document outside of the filter should not be unique:", err)
+	}
+	if err := r.Save(&Order{ID: "6", Customer: "c", Total: 50}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := r.Save(&Order{ID: "7", Customer: "a", Total: 50}); err == nil {
+		t.Error("a document inside of the filter should be unique")
+	}
+}
@@ -0,0 +1,151 @@
+package mongodb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/jeek120/repo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"io"
+	"time"
+)
+
+// ExportJSONL streams all entities in the namespace to w as newline delimited
+// JSON and returns the number of entities written. If the stream fails, for
+// example on a network error, the error is returned with the number of
+// entities written before it, and the export must be considered incomplete.
+func (r *Repo) ExportJSONL(ns string, w io.Writer) (int64, error) {
+	i, err := r.FindCustomIter(ns, func(ctx context.Context, c *mongo.Collection) (*mongo.Cursor, error) {
+		return c.Find(ctx, bson.M{}, r.FindOptions())
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return writeJSONL(context.Background(), i, w)
+}
+
+// writeJSONL writes the entities of the iterator to w and closes it. The error
+// ending the iteration, if any, is returned.
+func writeJSONL(ctx context.Context, i repo.Iter, w io.Writer) (int64, error) {
+	enc := json.NewEncoder(w)
+	var n int64
+	for i.Next(ctx) {
+		if err := enc.Encode(i.Value()); err != nil {
+			i.Close(ctx)
+			return n, repo.RepoError{
+				Err: err,
+			}
+		}
+		n++
+	}
+
+	if err := i.Close(ctx); err != nil {
+		return n, repo.RepoError{
+			Err: err,
+		}
+	}
+
+	return n, nil
+}
+
+// importBatchSize is the number of entities written per bulk write by ImportJSONL.
+const importBatchSize = 1000
+
+// ImportJSONL reads newline delimited JSON from rd and upserts the entities
+// into the namespace in batches, returning the number of entities imported.
+// Errors are reported with the line number that caused them.
+func (r *Repo) ImportJSONL(ns string, rd io.Reader) (int64, error) {
+	defer r.trackSlow("ImportJSONL", ns, time.Now())
+
+	factoryFn, err := r.factory(ns)
+	if err != nil {
+		return 0, err
+	}
+
+	c := r.collection(ns)
+	ctx := context.Background()
+
+	var n int64
+	var models []mongo.WriteModel
+	var lines []int
+	flush := func() error {
+		if len(models) == 0 {
+			return nil
+		}
+		if _, err := c.BulkWrite(ctx, models); err != nil {
+			line := lines[0]
+			if bwErr, ok := err.(mongo.BulkWriteException); ok && len(bwErr.WriteErrors) > 0 {
+				line = lines[bwErr.WriteErrors[0].Index]
+			}
+			return repo.RepoError{
+				Err:     repo.ErrCouldNotSaveEntity,
+				BaseErr: fmt.Errorf("line %d: %v", line, err),
+			}
+		}
+		n += int64(len(models))
+		models = models[:0]
+		lines = lines[:0]
+		return nil
+	}
+
+	scanner := bufio.NewScanner(rd)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		entity := factoryFn()
+		if err := json.Unmarshal(scanner.Bytes(), entity); err != nil {
+			return n, repo.RepoError{
+				Err:     repo.ErrCouldNotSaveEntity,
+				BaseErr: fmt.Errorf("line %d: %v", line, err),
+			}
+		}
+		filter, update, err := r.saveUpdate(entity)
+		if err != nil {
+			rrErr, ok := err.(repo.RepoError)
+			if !ok {
+				rrErr = repo.RepoError{
+					Err:     repo.ErrCouldNotSaveEntity,
+					BaseErr: err,
+				}
+			}
+			if rrErr.BaseErr != nil {
+				rrErr.BaseErr = fmt.Errorf("line %d: %v", line, rrErr.BaseErr)
+			} else {
+				rrErr.BaseErr = fmt.Errorf("line %d", line)
+			}
+			return n, rrErr
+		}
+
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(filter).
+			SetUpdate(update).
+			SetUpsert(true))
+		lines = append(lines, line)
+		if len(models) == importBatchSize {
+			if err := flush(); err != nil {
+				return n, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return n, repo.RepoError{
+			Err:     repo.ErrCouldNotSaveEntity,
+			BaseErr: fmt.Errorf("line %d: %v", line+1, err),
+		}
+	}
+
+	if err := flush(); err != nil {
+		return n, err
+	}
+
+	return n, nil
+}
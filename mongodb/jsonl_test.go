@@ -0,0 +1,144 @@
+package mongodb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo"
+	"github.com/jeek120/repo/mocks"
+	"go.mongodb.org/mongo-driver/bson"
+	"testing"
+)
+
+func TestRepoExportJSONL(t *testing.T) {
+	r := newTestRepo(t)
+	ns := string(mocks.ModelType)
+
+	for i := 0; i < 3; i++ {
+		if err := r.Save(&mocks.Model{ID: testId(i), Content: fmt.Sprint("content ", i)}); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	n, err := r.ExportJSONL(ns, &buf)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if n != 3 {
+		t.Error("there should be 3 entities exported:", n)
+	}
+
+	scanner := bufio.NewScanner(&buf)
+	seen := map[string]string{}
+	for scanner.Scan() {
+		var m mocks.Model
+		if err := json.Unmarshal(scanner.Bytes(), &m); err != nil {
+			t.Fatalf("line %q should be JSON: %v", scanner.Text(), err)
+		}
+		seen[string(m.ID)] = m.Content
+	}
+	for i := 0; i < 3; i++ {
+		if seen[string(testId(i))] != fmt.Sprint("content ", i) {
+			t.Error("the entity should be exported:", i, seen)
+		}
+	}
+}
+
+func TestWriteJSONLStreamError(t *testing.T) {
+	i := newTestIter(t, nil, errors.New("connection reset"))
+
+	var buf bytes.Buffer
+	if _, err := writeJSONL(context.Background(), i, &buf); err == nil {
+		t.Error("a failed stream should fail the export")
+	}
+}
+
+func TestWriteJSONL(t *testing.T) {
+	i := newTestIter(t, []interface{}{
+		bson.M{"_id": "1", "content": "a"},
+		bson.M{"_id": "2", "content": "b"},
+	}, nil)
+
+	var buf bytes.Buffer
+	n, err := writeJSONL(context.Background(), i, &buf)
+	if err != nil || n != 2 {
+		t.Fatal("there should be 2 entities written:", n, err)
+	}
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatal("there should be one line per entity:", buf.String())
+	}
+	var m mocks.Model
+	if err := json.Unmarshal(lines[1], &m); err != nil || m.ID != "2" || m.Content != "b" {
+		t.Error("the line should be the entity:", string(lines[1]), err)
+	}
+}
+
+func testId(i int) eventbus.DataId {
+	return eventbus.DataId(fmt.Sprint(i))
+}
+
+func TestRepoImportJSONL(t *testing.T) {
+	r := newTestRepo(t)
+	ns := string(mocks.ModelType)
+
+	for i := 0; i < 3; i++ {
+		if err := r.Save(&mocks.Model{ID: testId(i), Content: fmt.Sprint("content ", i)}); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+	var buf bytes.Buffer
+	if _, err := r.ExportJSONL(ns, &buf); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := r.Clear(ns); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	n, err := r.ImportJSONL(ns, &buf)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if n != 3 {
+		t.Error("there should be 3 entities imported:", n)
+	}
+	for i := 0; i < 3; i++ {
+		entity, err := r.FindById(ns, testId(i))
+		if err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+		if m := entity.(*mocks.Model); m.Content != fmt.Sprint("content ", i) {
+			t.Errorf("the entity should be imported: %+v", m)
+		}
+	}
+}
+
+func TestRepoImportJSONLSaveError(t *testing.T) {
+	// The import fails before any write, no server is needed.
+	r, err := NewRepo("mongodb://localhost:1", "test")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer r.Close()
+	r.SetEntityFactory(func() eventbus.Data {
+		return &mocks.Model{}
+	})
+	hookErr := errors.New("hook error")
+	r.AddSaveHook(func(eventbus.Data) error {
+		return hookErr
+	})
+
+	_, err = r.ImportJSONL(string(mocks.ModelType), bytes.NewBufferString("{\"id\":\"1\"}\n"))
+	rrErr, ok := err.(repo.RepoError)
+	if !ok {
+		t.Fatal("there should be a repo error:", err)
+	}
+	if rrErr.BaseErr == nil || rrErr.BaseErr.Error() != "line 1: hook error" {
+		t.Error("the error should have the line number:", rrErr.BaseErr)
+	}
+}
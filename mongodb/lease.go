@@ -0,0 +1,88 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo"
+	"go.mongodb.org/mongo-driver/bson"
+	"time"
+)
+
+// ErrLeaseNotHeld is when a lease is released by an owner not holding it.
+var ErrLeaseNotHeld = errors.New("lease not held")
+
+// Acquire leases the entity to owner for ttl, if it is not leased or the lease
+// expired. The lease is stored in the _lease and _leaseExpiry fields of the
+// document. It returns whether the lease was acquired; an owner already
+// holding the lease renews it.
+func (r *Repo) Acquire(ns string, id eventbus.DataId, owner string, ttl time.Duration) (bool, error) {
+	defer r.trackSlow("Acquire", ns, time.Now())
+
+	now := time.Now()
+	filter := bson.M{
+		"_id": string(id),
+		"$or": bson.A{
+			bson.M{"_lease": bson.M{"$exists": false}},
+			bson.M{"_lease": owner},
+			bson.M{"_leaseExpiry": bson.M{"$lte": now}},
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"_lease":       owner,
+			"_leaseExpiry": now.Add(ttl),
+		},
+	}
+
+	c := r.collection(ns)
+	ctx := context.Background()
+	res, err := c.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, repo.RepoError{
+			Err: err,
+		}
+	}
+	if res.MatchedCount > 0 {
+		return true, nil
+	}
+
+	// Either leased to another owner or missing.
+	n, err := c.CountDocuments(ctx, bson.M{"_id": string(id)})
+	if err != nil {
+		return false, repo.RepoError{
+			Err: err,
+		}
+	}
+	if n == 0 {
+		return false, repo.RepoError{
+			Err: repo.ErrEntityNotFound,
+		}
+	}
+
+	return false, nil
+}
+
+// Release clears the lease of the entity if it is held by owner, otherwise
+// ErrLeaseNotHeld is returned.
+func (r *Repo) Release(ns string, id eventbus.DataId, owner string) error {
+	defer r.trackSlow("Release", ns, time.Now())
+
+	c := r.collection(ns)
+	res, err := c.UpdateOne(context.Background(),
+		bson.M{"_id": string(id), "_lease": owner},
+		bson.M{"$unset": bson.M{"_lease": "", "_leaseExpiry": ""}},
+	)
+	if err != nil {
+		return repo.RepoError{
+			Err: err,
+		}
+	}
+	if res.MatchedCount == 0 {
+		return repo.RepoError{
+			Err: ErrLeaseNotHeld,
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package mongodb
+
+import (
+	"fmt"
+	"github.com/jeek120/repo"
+	"github.com/jeek120/repo/mocks"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRepoAcquire(t *testing.T) {
+	r := newTestRepo(t)
+	ns := string(mocks.ModelType)
+
+	if _, err := r.Acquire(ns, "1", "a", time.Minute); !isNotFound(err) {
+		t.Error("there should be a not found error:", err)
+	}
+	if err := r.Save(&mocks.Model{ID: "1"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	// Many workers race for the lease, only one gets it.
+	var (
+		mu     sync.Mutex
+		owners []string
+		wg     sync.WaitGroup
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(owner string) {
+			defer wg.Done()
+			ok, err := r.Acquire(ns, "1", owner, time.Minute)
+			if err != nil {
+				t.Error("there should be no error:", err)
+			}
+			if ok {
+				mu.Lock()
+				owners = append(owners, owner)
+				mu.Unlock()
+			}
+		}(fmt.Sprint("worker", i))
+	}
+	wg.Wait()
+	if len(owners) != 1 {
+		t.Fatal("the lease should be acquired once:", owners)
+	}
+	owner := owners[0]
+
+	// The owner can renew it, others can not release it.
+	if ok, err := r.Acquire(ns, "1", owner, time.Minute); err != nil || !ok {
+		t.Error("the owner should renew the lease:", ok, err)
+	}
+	if err := r.Release(ns, "1", "other"); err == nil || err.(repo.RepoError).Err != ErrLeaseNotHeld {
+		t.Error("there should be a lease not held error:", err)
+	}
+	if err := r.Release(ns, "1", owner); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if ok, err := r.Acquire(ns, "1", "other", time.Millisecond); err != nil || !ok {
+		t.Error("the released lease should be acquired:", ok, err)
+	}
+
+	// An expired lease can be taken over.
+	time.Sleep(5 * time.Millisecond)
+	if ok, err := r.Acquire(ns, "1", owner, time.Minute); err != nil || !ok {
+		t.Error("the expired lease should be acquired:", ok, err)
+	}
+}
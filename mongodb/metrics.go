@@ -0,0 +1,53 @@
+package mongodb
+
+import (
+	"github.com/jeek120/repo"
+	"sync/atomic"
+)
+
+// RepoMetrics are the operation counters of a repo.
+type RepoMetrics struct {
+	// Finds is the number of reads of entities, by the Find methods, queries
+	// and iterators.
+	Finds uint64
+	// Saves is the number of saves, including upserts, replaces and inserts.
+	// A bulk write, like SaveAll, counts as one save.
+	Saves uint64
+	// Removes is the number of removes, including RemoveIfVersion and
+	// FindOneAndRemove.
+	Removes uint64
+	// Errors is the number of the above operations that failed. Entities that
+	// are not found are not counted as errors.
+	Errors uint64
+}
+
+type metrics struct {
+	finds   atomic.Uint64
+	saves   atomic.Uint64
+	removes atomic.Uint64
+	errors  atomic.Uint64
+}
+
+// Metrics returns the operation counters of the repo.
+func (r *Repo) Metrics() RepoMetrics {
+	return RepoMetrics{
+		Finds:   r.metrics.finds.Load(),
+		Saves:   r.metrics.saves.Load(),
+		Removes: r.metrics.removes.Load(),
+		Errors:  r.metrics.errors.Load(),
+	}
+}
+
+// countOp counts an operation and its error, if any. As all operations end
+// here, it is also where a disconnected client is detected.
+func (r *Repo) countOp(ops *atomic.Uint64, err *error) {
+	ops.Add(1)
+	if *err == nil {
+		return
+	}
+	r.reconnectIfDisconnected(*err)
+	if rrErr, ok := (*err).(repo.RepoError); ok && rrErr.Err == repo.ErrEntityNotFound {
+		return
+	}
+	r.metrics.errors.Add(1)
+}
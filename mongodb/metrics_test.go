@@ -0,0 +1,120 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo"
+	"github.com/jeek120/repo/mocks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"testing"
+)
+
+func TestRepoMetrics(t *testing.T) {
+	r := newTestRepo(t)
+	ns := string(mocks.ModelType)
+	m1 := &mocks.Model{ID: "1", Content: "a"}
+	m2 := &mocks.Model{ID: "2", Content: "b"}
+
+	// Saves.
+	if err := r.Save(m1); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := r.Save(m2); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := r.SaveAll([]eventbus.Data{
+		&mocks.Model{ID: "3", Content: "a"},
+		&mocks.Model{ID: "4", Content: "b"},
+	}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	m1.Content = "c"
+	if _, err := r.SaveWithDiff(m1); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	// Finds, a missing entity is not an error.
+	if _, err := r.FindById(ns, "1"); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := r.FindById(ns, "5"); !isNotFound(err) {
+		t.Error("there should be a not found error:", err)
+	}
+	if _, err := r.FindAll(ns); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := r.FindByIds(ns, []eventbus.DataId{"1", "2"}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := r.Query(ns, QueryOptions{Limit: 1}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := r.FindAllMap(ns); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := r.FindAllGrouped(ns, "content"); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := r.FindCustom(ns, func(ctx context.Context, c *mongo.Collection) (*mongo.Cursor, error) {
+		return c.Find(ctx, bson.M{})
+	}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := r.FindCustomOne(ns, func(ctx context.Context, c *mongo.Collection) *mongo.SingleResult {
+		return c.FindOne(ctx, bson.M{"_id": "2"})
+	}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	queryErr := errors.New("query error")
+	if _, err := r.FindCustom(ns, func(ctx context.Context, c *mongo.Collection) (*mongo.Cursor, error) {
+		return nil, queryErr
+	}); err == nil || err.(repo.RepoError).BaseErr != queryErr {
+		t.Error("there should be a query error:", err)
+	}
+
+	// Removes, a missing entity is not an error.
+	if err := r.RemoveIfVersion(m1, 5); err == nil || err.(repo.RepoError).Err != repo.ErrIncorrectEntityVersion {
+		t.Error("there should be an incorrect version error:", err)
+	}
+	if err := r.Remove(m2); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := r.FindOneAndRemove(ns, bson.M{"_id": "3"}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := r.Remove(m2); !isNotFound(err) {
+		t.Error("there should be a not found error:", err)
+	}
+
+	expected := RepoMetrics{
+		Finds:   10,
+		Saves:   4,
+		Removes: 4,
+		Errors:  1,
+	}
+	if m := r.Metrics(); m != expected {
+		t.Errorf("the metrics should be correct: %+v", m)
+	}
+}
+
+func TestRepoCountOp(t *testing.T) {
+	r := &Repo{}
+
+	var err error
+	r.countOp(&r.metrics.finds, &err)
+	err = repo.RepoError{Err: repo.ErrEntityNotFound}
+	r.countOp(&r.metrics.finds, &err)
+	err = repo.RepoError{Err: repo.ErrCouldNotSaveEntity}
+	r.countOp(&r.metrics.saves, &err)
+
+	expected := RepoMetrics{
+		Finds:  2,
+		Saves:  1,
+		Errors: 1,
+	}
+	if m := r.Metrics(); m != expected {
+		t.Errorf("the metrics should be correct: %+v", m)
+	}
+}
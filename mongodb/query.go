@@ -0,0 +1,375 @@
+package mongodb
+
+import (
+	"context"
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// QueryOptions are the options for a Query. Zero values are ignored.
+type QueryOptions struct {
+	// Filter is the query filter, a nil filter matches all documents.
+	Filter bson.M
+	// Sort is the sort order.
+	Sort bson.D
+	// Skip is the number of documents to skip.
+	Skip int64
+	// Limit is the maximum number of documents to return.
+	Limit int64
+	// Projection limits the fields returned.
+	Projection bson.D
+	// ReadPreference overrides the read preference of the repo for the query,
+	// for example to let reporting queries read from secondaries.
+	ReadPreference *readpref.ReadPref
+	// Hint forces the index used by the query, an index name or key spec.
+	Hint interface{}
+}
+
+// Query returns the entities in the namespace matching the query options.
+func (r *Repo) Query(ns string, q QueryOptions) ([]eventbus.Data, error) {
+	defer r.trackSlow("Query", ns, time.Now())
+
+	factoryFn, err := r.factory(ns)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := q.Filter
+	if filter == nil {
+		filter = bson.M{}
+	}
+
+	opts := r.FindOptions()
+	if q.Sort != nil {
+		opts.SetSort(q.Sort)
+	}
+	if q.Skip > 0 {
+		opts.SetSkip(q.Skip)
+	}
+	if q.Limit > 0 {
+		opts.SetLimit(q.Limit)
+	}
+	if q.Projection != nil {
+		opts.SetProjection(q.Projection)
+	}
+	if q.Hint != nil {
+		opts.SetHint(q.Hint)
+	}
+
+	collOpts := options.Collection()
+	if q.ReadPreference != nil {
+		collOpts.SetReadPreference(q.ReadPreference)
+	}
+
+	c := r.collection(ns, collOpts)
+	ctx := context.Background()
+	find := func() (*mongo.Cursor, error) {
+		return c.Find(ctx, filter, opts)
+	}
+
+	result := []eventbus.Data{}
+	if err := r.findEach(ctx, find, factoryFn, func(entity eventbus.Data) error {
+		result = append(result, entity)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// FindAllSnapshot returns all entities in the namespace as of a single point in
+// time, with a snapshot read concern session. Writes done while the query runs
+// are not seen, not even partially. Snapshot reads need a replica set or a
+// sharded cluster of MongoDB 5.0 or later.
+func (r *Repo) FindAllSnapshot(ns string) ([]eventbus.Data, error) {
+	defer r.trackSlow("FindAllSnapshot", ns, time.Now())
+
+	factoryFn, err := r.factory(ns)
+	if err != nil {
+		return nil, err
+	}
+
+	sess, err := r.getClient().StartSession(options.Session().SetSnapshot(true))
+	if err != nil {
+		return nil, repo.RepoError{
+			Err: err,
+		}
+	}
+	ctx := context.Background()
+	defer sess.EndSession(ctx)
+
+	result := []eventbus.Data{}
+	err = mongo.WithSession(ctx, sess, func(sc mongo.SessionContext) error {
+		cursor, err := r.collection(ns).Find(sc, bson.M{}, r.FindOptions())
+		if err != nil {
+			return err
+		}
+		defer cursor.Close(sc)
+
+		for cursor.Next(sc) {
+			entity := factoryFn()
+			if err := r.decode(cursor, entity); err != nil {
+				return err
+			}
+			result = append(result, entity)
+		}
+		return cursor.Err()
+	})
+	if err != nil {
+		return nil, repo.RepoError{
+			Err: err,
+		}
+	}
+
+	return result, nil
+}
+
+// FindAllInto decodes all documents in the namespace into out, which must be a
+// non-nil pointer to a slice of a concrete type, for example *[]*User. The
+// documents are decoded by the driver, the entity factory and the storage
+// codec are not used.
+func (r *Repo) FindAllInto(ns string, out interface{}) error {
+	defer r.trackSlow("FindAllInto", ns, time.Now())
+
+	if err := checkSlicePtr(out); err != nil {
+		return err
+	}
+
+	c := r.collection(ns)
+	ctx := context.Background()
+	cursor, err := c.Find(ctx, bson.M{}, r.FindOptions())
+	if err != nil {
+		return findError(err)
+	}
+
+	if err := cursor.All(ctx, out); err != nil {
+		return repo.RepoError{
+			Err: err,
+		}
+	}
+
+	return nil
+}
+
+// FindAllGrouped returns all entities in the namespace grouped by the value of
+// a field of the stored documents. The field can be a dotted path into embedded
+// documents, like "address.city". Documents without the field are grouped
+// under the empty string, values that are not strings by their extended JSON.
+func (r *Repo) FindAllGrouped(ns string, groupField string) (map[string][]eventbus.Data, error) {
+	defer r.trackSlow("FindAllGrouped", ns, time.Now())
+
+	factoryFn, err := r.factory(ns)
+	if err != nil {
+		return nil, err
+	}
+
+	c := r.collection(ns)
+	ctx := context.Background()
+	var cursor *mongo.Cursor
+	find := func() (*mongo.Cursor, error) {
+		cursor, err = c.Find(ctx, bson.M{}, r.FindOptions())
+		return cursor, err
+	}
+
+	result := map[string][]eventbus.Data{}
+	if err := r.findEach(ctx, find, factoryFn, func(entity eventbus.Data) error {
+		group := groupKey(cursor.Current, groupField)
+		result[group] = append(result[group], entity)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// groupKey returns the value of the dotted path field in the document as a
+// string, or the empty string if the document does not have the field.
+func groupKey(doc bson.Raw, field string) string {
+	v, err := doc.LookupErr(strings.Split(field, ".")...)
+	if err != nil {
+		return ""
+	}
+	if s, ok := v.StringValueOK(); ok {
+		return s
+	}
+	return v.String()
+}
+
+// checkSlicePtr returns ErrInvalidResult if out is not a non-nil pointer to a
+// slice.
+func checkSlicePtr(out interface{}) error {
+	v := reflect.ValueOf(out)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Slice {
+		return repo.RepoError{
+			Err: ErrInvalidResult,
+		}
+	}
+	return nil
+}
+
+// Count implements the Count method of the eventhorizon.ReadRepo interface.
+func (r *Repo) Count(ns string) (int64, error) {
+	return r.CountFiltered(ns, nil)
+}
+
+// CountFiltered returns the number of documents in the namespace matching the
+// filter. A nil filter matches all documents.
+func (r *Repo) CountFiltered(ns string, filter bson.M) (int64, error) {
+	defer r.trackSlow("CountFiltered", ns, time.Now())
+
+	if filter == nil {
+		filter = bson.M{}
+	}
+
+	c := r.collection(ns)
+	n, err := c.CountDocuments(context.Background(), filter)
+	if err != nil {
+		return 0, findError(err)
+	}
+
+	return n, nil
+}
+
+// ListOpts are the per call options of FindAllOpts.
+type ListOpts struct {
+	// IncludeDeleted includes soft deleted documents, which have the _deleted
+	// field set to true.
+	IncludeDeleted bool
+}
+
+// FindAllOpts returns all entities in the namespace according to the options.
+// Soft deleted documents are excluded unless IncludeDeleted is set.
+func (r *Repo) FindAllOpts(ns string, opts ListOpts) ([]eventbus.Data, error) {
+	filter := bson.M{}
+	if !opts.IncludeDeleted {
+		filter["_deleted"] = bson.M{"$ne": true}
+	}
+
+	return r.Query(ns, QueryOptions{
+		Filter: filter,
+	})
+}
+
+// FindWithHint returns the entities in the namespace matching the filter, using
+// the index of the hint, an index name or key spec. The driver error is kept
+// if the index does not exist.
+func (r *Repo) FindWithHint(ns string, filter bson.M, hint interface{}) ([]eventbus.Data, error) {
+	return r.Query(ns, QueryOptions{
+		Filter: filter,
+		Hint:   hint,
+	})
+}
+
+// FindByIdProjected returns the entity with the ID with only the fields set,
+// the other fields are left at their zero value. The _id is always returned.
+func (r *Repo) FindByIdProjected(ns string, id eventbus.DataId, fields ...string) (eventbus.Data, error) {
+	defer r.trackSlow("FindByIdProjected", ns, time.Now())
+
+	factoryFn, err := r.factory(ns)
+	if err != nil {
+		return nil, err
+	}
+
+	projection := bson.D{}
+	for _, f := range fields {
+		projection = append(projection, bson.E{Key: f, Value: 1})
+	}
+
+	c := r.collection(ns)
+	opts := options.FindOne().SetProjection(projection)
+
+	return r.findOne(&r.metrics.finds, c.FindOne(context.Background(), bson.M{"_id": string(id)}, opts), factoryFn)
+}
+
+// FindOneWithCollation returns the first entity in the namespace matching the
+// filter using the collation, for example a strength 2 collation for case
+// insensitive matching of strings.
+func (r *Repo) FindOneWithCollation(ns string, filter bson.M, collation *options.Collation) (eventbus.Data, error) {
+	defer r.trackSlow("FindOneWithCollation", ns, time.Now())
+
+	factoryFn, err := r.factory(ns)
+	if err != nil {
+		return nil, err
+	}
+
+	c := r.collection(ns)
+	opts := options.FindOne().SetCollation(collation)
+
+	return r.findOne(&r.metrics.finds, c.FindOne(context.Background(), filter, opts), factoryFn)
+}
+
+// FindRaw returns the documents in the namespace matching the filter as raw
+// BSON documents, without decoding them to entities. It does not need an entity
+// factory. A nil filter matches all documents.
+func (r *Repo) FindRaw(ns string, filter bson.M) ([]bson.M, error) {
+	defer r.trackSlow("FindRaw", ns, time.Now())
+
+	if filter == nil {
+		filter = bson.M{}
+	}
+
+	c := r.collection(ns)
+	ctx := context.Background()
+	cursor, err := c.Find(ctx, filter, r.FindOptions())
+	if err != nil {
+		return nil, findError(err)
+	}
+
+	result := []bson.M{}
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, repo.RepoError{
+			Err: err,
+		}
+	}
+
+	return result, nil
+}
+
+// FindModifiedSince returns the entities in the namespace where the timestamp
+// field is after since, in ascending order of the field.
+func (r *Repo) FindModifiedSince(ns string, field string, since time.Time) ([]eventbus.Data, error) {
+	return r.Query(ns, QueryOptions{
+		Filter: bson.M{field: bson.M{"$gt": since}},
+		Sort:   bson.D{{Key: field, Value: 1}},
+	})
+}
+
+// CountAll returns the number of documents in every collection of the
+// database, skipping system collections. If estimated is set the faster
+// collection metadata based estimate is used instead of an exact count, except
+// for views which have no metadata and are always counted exactly.
+func (r *Repo) CountAll(estimated bool) (map[string]int64, error) {
+	ctx := context.Background()
+	db := r.getClient().Database(r.db)
+	specs, err := db.ListCollectionSpecifications(ctx, bson.M{
+		"name": bson.M{"$not": bson.M{"$regex": "^system\\."}},
+	})
+	if err != nil {
+		return nil, findError(err)
+	}
+
+	counts := make(map[string]int64, len(specs))
+	for _, spec := range specs {
+		var n int64
+		if estimated && spec.Type != "view" {
+			n, err = db.Collection(spec.Name).EstimatedDocumentCount(ctx)
+		} else {
+			n, err = db.Collection(spec.Name).CountDocuments(ctx, bson.M{})
+		}
+		if err != nil {
+			return nil, findError(err)
+		}
+		counts[spec.Name] = n
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,525 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo"
+	"github.com/jeek120/repo/mocks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestOrders(t *testing.T) *Repo {
+	r := newTestRepo(t)
+	r.RegisterFactory("Order", func() eventbus.Data {
+		return &Order{}
+	})
+
+	orders := []*Order{
+		{ID: "1", Customer: "a", Total: 30},
+		{ID: "2", Customer: "b", Total: 10},
+		{ID: "3", Customer: "a", Total: 20},
+		{ID: "4", Customer: "b", Total: 40},
+	}
+	for _, o := range orders {
+		if err := r.Save(o); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+
+	return r
+}
+
+func orderIds(entities []eventbus.Data) []eventbus.DataId {
+	ids := []eventbus.DataId{}
+	for _, e := range entities {
+		ids = append(ids, e.Id())
+	}
+	return ids
+}
+
+// sortedIds returns the IDs of the entities in ascending order, for queries
+// without a sort.
+func sortedIds(entities []eventbus.Data) []eventbus.DataId {
+	ids := orderIds(entities)
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func TestRepoQuery(t *testing.T) {
+	r := newTestOrders(t)
+
+	byTotal := bson.D{{Key: "total", Value: 1}}
+	testCases := map[string]struct {
+		q   QueryOptions
+		ids []eventbus.DataId
+	}{
+		"no options": {
+			q:   QueryOptions{Sort: bson.D{{Key: "_id", Value: 1}}},
+			ids: []eventbus.DataId{"1", "2", "3", "4"},
+		},
+		"filter": {
+			q:   QueryOptions{Filter: bson.M{"customer": "a"}, Sort: bson.D{{Key: "_id", Value: 1}}},
+			ids: []eventbus.DataId{"1", "3"},
+		},
+		"sort": {
+			q:   QueryOptions{Sort: byTotal},
+			ids: []eventbus.DataId{"2", "3", "1", "4"},
+		},
+		"skip": {
+			q:   QueryOptions{Sort: byTotal, Skip: 2},
+			ids: []eventbus.DataId{"1", "4"},
+		},
+		"limit": {
+			q:   QueryOptions{Sort: byTotal, Limit: 2},
+			ids: []eventbus.DataId{"2", "3"},
+		},
+		"combined": {
+			q: QueryOptions{
+				Filter: bson.M{"total": bson.M{"$gte": 20}},
+				Sort:   bson.D{{Key: "total", Value: -1}},
+				Skip:   1,
+				Limit:  1,
+			},
+			ids: []eventbus.DataId{"1"},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			entities, err := r.Query("Order", tc.q)
+			if err != nil {
+				t.Fatal("there should be no error:", err)
+			}
+			if ids := orderIds(entities); !reflect.DeepEqual(ids, tc.ids) {
+				t.Error("the entities should be correct:", ids)
+			}
+		})
+	}
+
+	entities, err := r.Query("Order", QueryOptions{
+		Filter:     bson.M{"_id": "1"},
+		Projection: bson.D{{Key: "total", Value: 1}},
+	})
+	if err != nil || len(entities) != 1 {
+		t.Fatal("there should be one entity:", entities, err)
+	}
+	if o := entities[0].(*Order); o.Customer != "" || o.Total != 30 {
+		t.Errorf("only the projected fields should be set: %+v", o)
+	}
+}
+
+func TestGroupKey(t *testing.T) {
+	doc, err := bson.Marshal(bson.M{
+		"category": "books",
+		"count":    3,
+		"address":  bson.M{"city": "Oslo"},
+	})
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	testCases := map[string]string{
+		"category":     "books",
+		"count":        `{"$numberInt":"3"}`,
+		"address.city": "Oslo",
+		"address.zip":  "",
+		"missing":      "",
+		"category.sub": "",
+	}
+	for field, key := range testCases {
+		if got := groupKey(doc, field); got != key {
+			t.Errorf("the group of %s should be %q: %q", field, key, got)
+		}
+	}
+}
+
+func TestRepoFindAllGrouped(t *testing.T) {
+	r := newTestOrders(t)
+
+	groups, err := r.FindAllGrouped("Order", "customer")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(groups) != 2 {
+		t.Error("there should be two groups:", groups)
+	}
+	for customer, entities := range groups {
+		if len(entities) != 2 {
+			t.Error("there should be two entities in the group:", customer, entities)
+		}
+		for _, e := range entities {
+			if o := e.(*Order); o.Customer != customer {
+				t.Errorf("the entity should be in the group of its customer: %s %+v", customer, o)
+			}
+		}
+	}
+}
+
+func TestRepoCountAll(t *testing.T) {
+	r := newTestOrders(t)
+	if err := r.Save(&mocks.Model{ID: "1"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := r.getClient().Database(r.db).CreateView(context.Background(),
+		"BigOrders", "Order", bson.A{bson.M{"$match": bson.M{"total": bson.M{"$gte": 30}}}},
+	); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	expected := map[string]int64{
+		"Order":     4,
+		"Model":     1,
+		"BigOrders": 2,
+	}
+	for _, estimated := range []bool{false, true} {
+		counts, err := r.CountAll(estimated)
+		if err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+		if !reflect.DeepEqual(counts, expected) {
+			t.Error("the counts should be correct:", estimated, counts)
+		}
+	}
+}
+
+func TestRepoCountFiltered(t *testing.T) {
+	r := newTestOrders(t)
+
+	if n, err := r.CountFiltered("Order", bson.M{"customer": "a"}); err != nil || n != 2 {
+		t.Error("the matching entities should be counted:", n, err)
+	}
+	if n, err := r.CountFiltered("Order", bson.M{"customer": "c"}); err != nil || n != 0 {
+		t.Error("there should be no matching entities:", n, err)
+	}
+	if n, err := r.CountFiltered("Order", nil); err != nil || n != 4 {
+		t.Error("a nil filter should match all entities:", n, err)
+	}
+}
+
+// skipStandalone skips the test with the reason if the server is not a
+// replica set or a sharded cluster.
+func skipStandalone(t *testing.T, r *Repo, reason string) {
+	var hello bson.M
+	if err := r.getClient().Database("admin").RunCommand(context.Background(), bson.M{"hello": 1}).Decode(&hello); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if hello["setName"] == nil && hello["msg"] != "isdbgrid" {
+		t.Skip(reason)
+	}
+}
+
+func TestRepoQueryReadPreference(t *testing.T) {
+	// The read preferences of the find commands sent to the server.
+	var mu sync.Mutex
+	var modes []string
+	monitor := &event.CommandMonitor{
+		Started: func(_ context.Context, e *event.CommandStartedEvent) {
+			if e.CommandName != "find" {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+
+			mode := ""
+			if v, err := e.Command.LookupErr("$readPreference", "mode"); err == nil {
+				mode = v.StringValue()
+			}
+			modes = append(modes, mode)
+		},
+	}
+	r := newTestRepo(t, func(opts *options.ClientOptions) {
+		opts.SetMonitor(monitor)
+	})
+	r.RegisterFactory("Order", func() eventbus.Data {
+		return &Order{}
+	})
+
+	// The read preference is only sent to replica sets and sharded clusters.
+	skipStandalone(t, r, "the read preference is not sent to a standalone server")
+
+	if _, err := r.Query("Order", QueryOptions{}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if _, err := r.Query("Order", QueryOptions{ReadPreference: readpref.SecondaryPreferred()}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(modes) != 2 || modes[1] != "secondaryPreferred" {
+		t.Error("the read preference of the query should reach the driver:", modes)
+	} else if modes[0] == "secondaryPreferred" {
+		t.Error("the default read preference should not change:", modes)
+	}
+}
+
+func TestRepoFindModifiedSince(t *testing.T) {
+	r := newTestRepo(t)
+	ns := string(mocks.ModelType)
+
+	now := time.Now().Round(time.Millisecond).UTC()
+	// Saved out of order, from 3 hours ago to now.
+	ages := map[eventbus.DataId]time.Duration{"1": 3 * time.Hour, "2": 0, "3": 2 * time.Hour, "4": time.Hour}
+	for id, age := range ages {
+		if err := r.Save(&mocks.Model{ID: id, CreatedAt: now.Add(-age)}); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+
+	entities, err := r.FindModifiedSince(ns, "created_at", now.Add(-90*time.Minute))
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if ids := orderIds(entities); !reflect.DeepEqual(ids, []eventbus.DataId{"4", "2"}) {
+		t.Error("the recent entities should be found in order:", ids)
+	}
+
+	if entities, err := r.FindModifiedSince(ns, "created_at", now); err != nil || len(entities) != 0 {
+		t.Error("there should be no entities:", entities, err)
+	}
+}
+
+func TestRepoFindRaw(t *testing.T) {
+	r := newTestRepo(t)
+	r.SetEntityFactory(nil)
+	ns := string(mocks.ModelType)
+
+	for _, doc := range []bson.M{
+		{"_id": "1", "content": "a", "extra": int32(1)},
+		{"_id": "2", "content": "b"},
+	} {
+		if _, err := r.collection(ns).InsertOne(context.Background(), doc); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+
+	docs, err := r.FindRaw(ns, bson.M{"content": "a"})
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(docs) != 1 || !reflect.DeepEqual(docs[0], bson.M{"_id": "1", "content": "a", "extra": int32(1)}) {
+		t.Error("the raw documents should be returned with all fields:", docs)
+	}
+
+	if docs, err := r.FindRaw(ns, nil); err != nil || len(docs) != 2 {
+		t.Error("all documents should be returned:", docs, err)
+	}
+}
+
+func TestRepoFindOneWithCollation(t *testing.T) {
+	r := newTestRepo(t)
+	r.RegisterFactory("User", func() eventbus.Data {
+		return &User{}
+	})
+
+	if err := r.Save(&User{ID: "1", Name: "foo@bar.com"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	filter := bson.M{"name": "Foo@Bar.com"}
+	entity, err := r.FindOneWithCollation("User", filter, &options.Collation{Locale: "en", Strength: 2})
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if entity.Id() != "1" {
+		t.Error("the entity should be matched case-insensitively:", entity)
+	}
+
+	if _, err := r.FindOneWithCollation("User", filter, &options.Collation{Locale: "en", Strength: 3}); !isNotFound(err) {
+		t.Error("there should be a not found error:", err)
+	}
+}
+
+func TestRepoFindAllSnapshot(t *testing.T) {
+	r := newTestRepo(t)
+	skipStandalone(t, r, "snapshot reads need a replica set or a sharded cluster")
+	r.RegisterFactory("Order", func() eventbus.Data {
+		return &Order{}
+	})
+
+	for _, id := range []eventbus.DataId{"1", "2"} {
+		if err := r.Save(&Order{ID: id, Total: 50}); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+
+	// Transfers between the orders in transactions keep the sum at 100.
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		c := r.collection("Order")
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			from, to := "1", "2"
+			if i%2 == 1 {
+				from, to = to, from
+			}
+			err := r.getClient().UseSession(context.Background(), func(sc mongo.SessionContext) error {
+				_, err := sc.WithTransaction(sc, func(sc mongo.SessionContext) (interface{}, error) {
+					if _, err := c.UpdateByID(sc, from, bson.M{"$inc": bson.M{"total": -1}}); err != nil {
+						return nil, err
+					}
+					_, err := c.UpdateByID(sc, to, bson.M{"$inc": bson.M{"total": 1}})
+					return nil, err
+				})
+				return err
+			})
+			if err != nil {
+				t.Error("there should be no error:", err)
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 20; i++ {
+		entities, err := r.FindAllSnapshot("Order")
+		if err != nil {
+			t.Error("there should be no error:", err)
+			break
+		}
+		sum := 0
+		for _, e := range entities {
+			sum += e.(*Order).Total
+		}
+		if len(entities) != 2 || sum != 100 {
+			t.Error("the snapshot should not see partial transactions:", len(entities), sum)
+		}
+	}
+	close(done)
+	wg.Wait()
+}
+
+func TestRepoFindAllInto(t *testing.T) {
+	r := newTestRepo(t)
+
+	for _, u := range []*User{{ID: "1", Name: "a"}, {ID: "2", Name: "b"}} {
+		if err := r.Save(u); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+
+	var users []*User
+	if err := r.FindAllInto("User", &users); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(users) != 2 || *users[0] != (User{ID: "1", Name: "a"}) || *users[1] != (User{ID: "2", Name: "b"}) {
+		t.Errorf("the slice should be populated: %+v", users)
+	}
+}
+
+func TestRepoFindAllIntoInvalid(t *testing.T) {
+	// The output is checked before the query, no server is needed.
+	r, err := NewRepo("mongodb://localhost:1", "test")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer r.Close()
+
+	var users []*User
+	for name, out := range map[string]interface{}{
+		"nil":            nil,
+		"slice":          users,
+		"nil pointer":    (*[]*User)(nil),
+		"not a slice":    &User{},
+		"pointer to nil": (*User)(nil),
+	} {
+		if err := r.FindAllInto("User", out); err == nil || err.(repo.RepoError).Err != ErrInvalidResult {
+			t.Errorf("%s: there should be an invalid result error: %v", name, err)
+		}
+	}
+}
+
+func TestRepoFindWithHint(t *testing.T) {
+	r := newTestOrders(t)
+
+	if _, err := r.EnsureIndex("Order", mongo.IndexModel{
+		Keys:    bson.D{{Key: "customer", Value: 1}},
+		Options: options.Index().SetName("by_customer"),
+	}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	entities, err := r.FindWithHint("Order", bson.M{"customer": "a"}, "by_customer")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if ids := orderIds(entities); len(ids) != 2 {
+		t.Error("the matching entities should be found:", ids)
+	}
+
+	_, err = r.FindWithHint("Order", bson.M{"customer": "a"}, "missing")
+	var cmdErr mongo.CommandError
+	if rrErr, ok := err.(repo.RepoError); !ok || !errors.As(rrErr.Err, &cmdErr) {
+		t.Error("the driver error should be returned for a missing index:", err)
+	}
+}
+
+func TestRepoFindAllOpts(t *testing.T) {
+	r := newTestRepo(t)
+	ns := string(mocks.ModelType)
+
+	for _, doc := range []bson.M{
+		{"_id": "1"},
+		{"_id": "2", "_deleted": true},
+		{"_id": "3", "_deleted": false},
+	} {
+		if _, err := r.collection(ns).InsertOne(context.Background(), doc); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+
+	entities, err := r.FindAllOpts(ns, ListOpts{})
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if ids := sortedIds(entities); !reflect.DeepEqual(ids, []eventbus.DataId{"1", "3"}) {
+		t.Error("the deleted entities should be excluded:", ids)
+	}
+
+	entities, err = r.FindAllOpts(ns, ListOpts{IncludeDeleted: true})
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if ids := sortedIds(entities); !reflect.DeepEqual(ids, []eventbus.DataId{"1", "2", "3"}) {
+		t.Error("the deleted entities should be included:", ids)
+	}
+}
+
+func TestRepoCount(t *testing.T) {
+	r := newTestRepo(t)
+	ns := string(mocks.ModelType)
+
+	if n, err := r.Count(ns); err != nil || n != 0 {
+		t.Error("a missing collection should be empty:", n, err)
+	}
+	for _, id := range []eventbus.DataId{"1", "2"} {
+		if err := r.Save(&mocks.Model{ID: id}); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+	if n, err := r.Count(ns); err != nil || n != 2 {
+		t.Error("there should be two entities:", n, err)
+	}
+	if err := r.Remove(&mocks.Model{ID: "1"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if n, err := r.Count(ns); err != nil || n != 1 {
+		t.Error("there should be one entity:", n, err)
+	}
+}
@@ -17,6 +17,7 @@ package mongodb
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/jeek120/eventbus"
 	"github.com/jeek120/repo"
 	"go.mongodb.org/mongo-driver/bson"
@@ -25,6 +26,10 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/readconcern"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // ErrCouldNotDialDB is when the database could not be dialed.
@@ -36,31 +41,114 @@ var ErrNoDBClient = errors.New("no database client")
 // ErrCouldNotClearDB is when the database could not be cleared.
 var ErrCouldNotClearDB = errors.New("could not clear database")
 
+// ErrNoClientOptions is when the repo has no client options to reconnect with.
+var ErrNoClientOptions = errors.New("no client options")
+
 // ErrModelNotSet is when an model factory is not set on the Repo.
 var ErrModelNotSet = errors.New("model not set")
 
+// ErrUnregisteredType is when an entity type is not registered in strict mode.
+var ErrUnregisteredType = errors.New("unregistered entity type")
+
+// ErrResultSetTooLarge is when a query returns more results than allowed.
+var ErrResultSetTooLarge = errors.New("result set too large")
+
 // ErrInvalidQuery is when a query was not returned from the callback to FindCustom.
 var ErrInvalidQuery = errors.New("invalid query")
 
+// ErrInvalidResult is when the result of a query can not be decoded into the
+// value passed by the caller.
+var ErrInvalidResult = errors.New("invalid result, must be a non-nil pointer to a slice")
+
+// ErrEmptyEntity is when an entity with only zero values is saved.
+var ErrEmptyEntity = errors.New("empty entity")
+
 // Repo implements an MongoDB repository for entities.
 type Repo struct {
-	client    *mongo.Client
-	db        string
-	factoryFn func() eventbus.Data
+	client     *mongo.Client
+	clientOpts *options.ClientOptions
+	clientMu   sync.RWMutex
+	db         string
+	factoryFn  func() eventbus.Data
+	factories  map[string]func() eventbus.Data
+	saveHooks  []func(eventbus.Data) error
+	batchSize  int32
+
+	autoReconnect bool
+	reconnectMu   sync.Mutex
+
+	autoVersion     bool
+	codec           StorageCodec
+	strictTypes     bool
+	types           map[eventbus.DataType]bool
+	maxResults      int
+	preserveUnknown bool
+	rejectZero      bool
+
+	slowThreshold time.Duration
+	slowLog       func(op, ns string, dur time.Duration)
+
+	metrics metrics
+}
+
+// Option is an option for the client created by NewRepo.
+type Option func(*options.ClientOptions)
+
+// WithMaxPoolSize sets the maximum number of connections in the pool.
+func WithMaxPoolSize(n uint64) Option {
+	return func(opts *options.ClientOptions) {
+		opts.SetMaxPoolSize(n)
+	}
+}
+
+// WithMinPoolSize sets the minimum number of connections in the pool.
+func WithMinPoolSize(n uint64) Option {
+	return func(opts *options.ClientOptions) {
+		opts.SetMinPoolSize(n)
+	}
+}
+
+// WithConnectTimeout sets the timeout for creating a connection.
+func WithConnectTimeout(d time.Duration) Option {
+	return func(opts *options.ClientOptions) {
+		opts.SetConnectTimeout(d)
+	}
+}
+
+// WithServerSelectionTimeout sets the timeout for selecting a server for an
+// operation.
+func WithServerSelectionTimeout(d time.Duration) Option {
+	return func(opts *options.ClientOptions) {
+		opts.SetServerSelectionTimeout(d)
+	}
 }
 
 // NewRepo creates a new Repo.
-func NewRepo(uri, db string) (*Repo, error) {
-	opts := options.Client().ApplyURI(uri)
-	opts.SetWriteConcern(writeconcern.New(writeconcern.WMajority()))
-	opts.SetReadConcern(readconcern.Majority())
-	opts.SetReadPreference(readpref.Primary())
-	client, err := mongo.Connect(context.TODO(), opts)
+func NewRepo(uri, db string, opts ...Option) (*Repo, error) {
+	clientOpts := newClientOptions(uri, opts...)
+	client, err := mongo.Connect(context.TODO(), clientOpts)
 	if err != nil {
 		return nil, ErrCouldNotDialDB
 	}
 
-	return NewRepoWithClient(client, db)
+	r, err := NewRepoWithClient(client, db)
+	if err != nil {
+		return nil, err
+	}
+	r.clientOpts = clientOpts
+
+	return r, nil
+}
+
+func newClientOptions(uri string, opts ...Option) *options.ClientOptions {
+	clientOpts := options.Client().ApplyURI(uri)
+	clientOpts.SetWriteConcern(writeconcern.New(writeconcern.WMajority()))
+	clientOpts.SetReadConcern(readconcern.Majority())
+	clientOpts.SetReadPreference(readpref.Primary())
+	for _, opt := range opts {
+		opt(clientOpts)
+	}
+	return clientOpts
 }
 
 // NewRepoWithClient creates a new Repo with a client.
@@ -84,89 +172,371 @@ func (r *Repo) Parent() repo.ReadRepo {
 
 // Find implements the Find method of the eventhorizon.ReadRepo interface.
 func (r *Repo) Find(data eventbus.Data) (eventbus.Data, error) {
-	if r.factoryFn == nil {
-		return nil, repo.RepoError{
-			Err: ErrModelNotSet,
-		}
-	}
+	defer r.trackSlow("Find", string(data.DataType()), time.Now())
 
-	c := r.client.Database(r.db).Collection(string(data.DataType()))
+	factoryFn, err := r.factory(string(data.DataType()))
+	if err != nil {
+		return nil, err
+	}
 
-	entity := r.factoryFn()
-	if err := c.FindOne(context.Background(), data).Decode(entity); err == mongo.ErrNoDocuments {
-		return nil, repo.RepoError{
-			Err:     repo.ErrEntityNotFound,
-			BaseErr: err,
-		}
-	} else if err != nil {
-		return nil, repo.RepoError{
-			Err: err,
+	var filter interface{} = data
+	if r.codec != nil {
+		doc, err := r.codec.Encode(data)
+		if err != nil {
+			return nil, repo.RepoError{
+				Err: err,
+			}
 		}
+		filter = doc
 	}
 
-	return entity, nil
+	c := r.collection(string(data.DataType()))
+
+	return r.findOne(&r.metrics.finds, c.FindOne(context.Background(), filter), factoryFn)
 }
 
 // Find implements the Find method of the eventhorizon.ReadRepo interface.
 func (r *Repo) FindById(ns string, id eventbus.DataId) (eventbus.Data, error) {
-	if r.factoryFn == nil {
-		return nil, repo.RepoError{
-			Err: ErrModelNotSet,
-		}
+	defer r.trackSlow("FindById", ns, time.Now())
+
+	factoryFn, err := r.factory(ns)
+	if err != nil {
+		return nil, err
 	}
 
-	c := r.client.Database(r.db).Collection(ns)
+	c := r.collection(ns)
 
-	entity := r.factoryFn()
-	if err := c.FindOne(context.Background(), bson.M{"_id": string(id)}).Decode(entity); err == mongo.ErrNoDocuments {
-		return nil, repo.RepoError{
-			Err:     repo.ErrEntityNotFound,
-			BaseErr: err,
-		}
-	} else if err != nil {
-		return nil, repo.RepoError{
-			Err: err,
-		}
+	return r.findOne(&r.metrics.finds, c.FindOne(context.Background(), bson.M{"_id": string(id)}), factoryFn)
+}
+
+// FindByIds implements the FindByIds method of the eventhorizon.ReadRepo interface.
+func (r *Repo) FindByIds(ns string, ids []eventbus.DataId) ([]eventbus.Data, error) {
+	defer r.trackSlow("FindByIds", ns, time.Now())
+
+	factoryFn, err := r.factory(ns)
+	if err != nil {
+		return nil, err
 	}
 
-	return entity, nil
+	in := make([]string, len(ids))
+	for i, id := range ids {
+		in[i] = string(id)
+	}
+
+	c := r.collection(ns)
+	ctx := context.Background()
+	find := func() (*mongo.Cursor, error) {
+		return c.Find(ctx, bson.M{"_id": bson.M{"$in": in}}, r.FindOptions())
+	}
+
+	result := []eventbus.Data{}
+	if err := r.findEach(ctx, find, factoryFn, func(entity eventbus.Data) error {
+		result = append(result, entity)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// FindOrCreate returns the entity with the ID of data, or inserts the entity
+// returned by create if it does not exist. The created entity must have the
+// same ID. The returned bool is set if the entity was created. Concurrent calls
+// for the same ID create the entity only once.
+func (r *Repo) FindOrCreate(data eventbus.Data, create func() eventbus.Data) (eventbus.Data, bool, error) {
+	ns := string(data.DataType())
+	entity, err := r.FindById(ns, data.Id())
+	if err == nil {
+		return entity, false, nil
+	} else if rrErr, ok := err.(repo.RepoError); !ok || rrErr.Err != repo.ErrEntityNotFound {
+		return nil, false, err
+	}
+
+	entity = create()
+	if err := r.prepareSave(entity); err != nil {
+		return nil, false, err
+	}
+	doc, err := r.encode(entity)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Only insert if no one else has in the meantime.
+	c := r.collection(ns)
+	res, err := c.UpdateOne(context.Background(),
+		bson.M{
+			"_id": data.Id(),
+		},
+		bson.M{
+			"$setOnInsert": doc,
+		},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return nil, false, writeError(err)
+	}
+	if res.UpsertedCount > 0 {
+		return entity, true, nil
+	}
+
+	entity, err = r.FindById(ns, data.Id())
+	if err != nil {
+		return nil, false, err
+	}
+	return entity, false, nil
 }
 
 // FindAll implements the FindAll method of the eventhorizon.ReadRepo interface.
 func (r *Repo) FindAll(ns string) ([]eventbus.Data, error) {
-	if r.factoryFn == nil {
-		return nil, repo.RepoError{
-			Err: ErrModelNotSet,
+	defer r.trackSlow("FindAll", ns, time.Now())
+
+	factoryFn, err := r.factory(ns)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := r.FindOptions()
+	if r.maxResults > 0 {
+		// One more than the max is enough to detect a too large result.
+		opts.SetLimit(int64(r.maxResults) + 1)
+	}
+
+	c := r.collection(ns)
+	ctx := context.Background()
+	find := func() (*mongo.Cursor, error) {
+		return c.Find(ctx, bson.M{}, opts)
+	}
+
+	result := []eventbus.Data{}
+	if err := r.findEach(ctx, find, factoryFn, func(entity eventbus.Data) error {
+		if r.maxResults > 0 && len(result) == r.maxResults {
+			return repo.RepoError{
+				Err: ErrResultSetTooLarge,
+			}
+		}
+		result = append(result, entity)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// FindAllIter implements the FindAllIter method of the eventhorizon.ReadRepo
+// interface. The entities are streamed from a cursor in ID order. If the cursor
+// times out on the server, for example with a slow consumer, the query is
+// re-issued after the last returned ID.
+func (r *Repo) FindAllIter(ns string) (repo.Iter, error) {
+	return r.findAllIter(ns, nil)
+}
+
+// findAllIter streams the entities matching the scope filter, if any.
+func (r *Repo) findAllIter(ns string, scope bson.M) (_ repo.Iter, err error) {
+	defer r.countOp(&r.metrics.finds, &err)
+	factoryFn, err := r.factory(ns)
+	if err != nil {
+		return nil, err
+	}
+
+	c := r.collection(ns)
+	find := func(ctx context.Context, after eventbus.DataId) (*mongo.Cursor, error) {
+		filter := bson.M{}
+		for k, v := range scope {
+			filter[k] = v
 		}
+		if after != "" {
+			filter["_id"] = bson.M{"$gt": string(after)}
+		}
+		opts := r.FindOptions().SetSort(bson.D{{Key: "_id", Value: 1}})
+		return c.Find(ctx, filter, opts)
+	}
+
+	cursor, err := find(context.Background(), "")
+	if err != nil {
+		return nil, findError(err)
+	}
+
+	return &iter{
+		cursor:    cursor,
+		factoryFn: factoryFn,
+		decode:    r.decode,
+		resume:    find,
+	}, nil
+}
+
+// FindAllMap returns all entities in the namespace keyed by their ID.
+func (r *Repo) FindAllMap(ns string) (map[eventbus.DataId]eventbus.Data, error) {
+	defer r.trackSlow("FindAllMap", ns, time.Now())
+
+	factoryFn, err := r.factory(ns)
+	if err != nil {
+		return nil, err
+	}
+
+	c := r.collection(ns)
+	ctx := context.Background()
+	find := func() (*mongo.Cursor, error) {
+		return c.Find(ctx, bson.M{}, r.FindOptions())
+	}
+
+	result := map[eventbus.DataId]eventbus.Data{}
+	if err := r.findEach(ctx, find, factoryFn, func(entity eventbus.Data) error {
+		result[entity.Id()] = entity
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// FindAllLenient returns all entities in the namespace that could be decoded,
+// together with the errors for the documents that could not. Unlike FindAll it
+// does not stop at the first undecodable document.
+func (r *Repo) FindAllLenient(ns string) ([]eventbus.Data, []error) {
+	defer r.trackSlow("FindAllLenient", ns, time.Now())
+
+	factoryFn, err := r.factory(ns)
+	if err != nil {
+		return nil, []error{err}
 	}
 
-	c := r.client.Database(r.db).Collection(ns)
+	c := r.collection(ns)
 	ctx := context.Background()
-	cursor, err := c.Find(ctx, bson.M{})
+	cursor, err := c.Find(ctx, bson.M{}, r.FindOptions())
 	if err != nil {
-		return nil, repo.RepoError{
+		return nil, []error{repo.RepoError{
 			Err: err,
-		}
+		}}
 	}
 
 	result := []eventbus.Data{}
+	var errs []error
 	for cursor.Next(ctx) {
-		entity := r.factoryFn()
-		if err := cursor.Decode(entity); err != nil {
-			return nil, repo.RepoError{
+		entity := factoryFn()
+		if err := r.decode(cursor, entity); err != nil {
+			errs = append(errs, repo.RepoError{
 				Err: err,
-			}
+			})
+			continue
 		}
 		result = append(result, entity)
 	}
 
+	// An error of the cursor means that documents are missing from the result.
+	if err := cursor.Err(); err != nil {
+		errs = append(errs, findError(err))
+	}
 	if err := cursor.Close(ctx); err != nil {
-		return nil, repo.RepoError{
+		errs = append(errs, repo.RepoError{
 			Err: err,
+		})
+	}
+
+	return result, errs
+}
+
+// findError classifies an error from a find operation, keeping the driver
+// error as the base error.
+func findError(err error) error {
+	switch {
+	case err == mongo.ErrNoDocuments:
+		return repo.RepoError{
+			Err:     repo.ErrEntityNotFound,
+			BaseErr: err,
+		}
+	case mongo.IsTimeout(err):
+		return repo.RepoError{
+			Err:     repo.ErrQueryTimeout,
+			BaseErr: err,
 		}
+	case mongo.IsNetworkError(err):
+		return repo.RepoError{
+			Err:     repo.ErrConnectionLost,
+			BaseErr: err,
+		}
+	}
+	return repo.RepoError{
+		Err: err,
 	}
+}
 
-	return result, nil
+// findEach runs the query of find and calls fn with each entity of the cursor
+// decoded with the factory. All the reads of many entities go through it, and
+// are counted as finds in the metrics. Errors of find are returned as is.
+func (r *Repo) findEach(ctx context.Context, find func() (*mongo.Cursor, error), factoryFn func() eventbus.Data, fn func(eventbus.Data) error) (err error) {
+	defer r.countOp(&r.metrics.finds, &err)
+
+	cursor, err := find()
+	if err != nil {
+		if _, ok := err.(repo.RepoError); ok {
+			return err
+		}
+		return findError(err)
+	}
+
+	return r.decodeAll(ctx, cursor, factoryFn, fn)
+}
+
+// findOne decodes the single result of a query with the factory. All the reads
+// of one entity go through it, and are counted in ops of the metrics.
+func (r *Repo) findOne(ops *atomic.Uint64, res *mongo.SingleResult, factoryFn func() eventbus.Data) (_ eventbus.Data, err error) {
+	defer r.countOp(ops, &err)
+
+	entity := factoryFn()
+	if err := r.decode(res, entity); err != nil {
+		return nil, findError(err)
+	}
+
+	return entity, nil
+}
+
+// decodeAll decodes the documents of the cursor with the factory, calls fn with
+// each entity and closes the cursor. The error of the cursor is returned if it
+// ends the iteration early, for example a network error while getting more
+// results, so that a partial result is never taken for a complete one.
+func (r *Repo) decodeAll(ctx context.Context, cursor *mongo.Cursor, factoryFn func() eventbus.Data, fn func(eventbus.Data) error) error {
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		entity := factoryFn()
+		if err := r.decode(cursor, entity); err != nil {
+			return repo.RepoError{
+				Err: err,
+			}
+		}
+		if err := fn(entity); err != nil {
+			return err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return findError(err)
+	}
+
+	return nil
+}
+
+// writeError classifies an error from a write operation like findError, with
+// ErrCouldNotSaveEntity for the errors that are not timeouts or network errors.
+func writeError(err error) error {
+	if mongo.IsTimeout(err) || mongo.IsNetworkError(err) {
+		return findError(err)
+	}
+	return repo.RepoError{
+		Err:     repo.ErrCouldNotSaveEntity,
+		BaseErr: err,
+	}
+}
+
+// cursorNotFound is the server error code of a cursor that was killed, for
+// example after it timed out.
+const cursorNotFound = 43
+
+func isCursorNotFound(err error) bool {
+	var se mongo.ServerError
+	return errors.As(err, &se) && se.HasErrorCode(cursorNotFound)
 }
 
 // The iterator is not thread safe.
@@ -174,17 +544,56 @@ type iter struct {
 	cursor    *mongo.Cursor
 	data      eventbus.Data
 	factoryFn func() eventbus.Data
-	decodeErr error
+	decode    func(decoder, eventbus.Data) error
+	err       error
+	closed    bool
+
+	// resume re-issues the query after an ID when the cursor was not found
+	// on the server, if set. The query must be sorted by ID.
+	resume func(ctx context.Context, after eventbus.DataId) (*mongo.Cursor, error)
+	last   eventbus.DataId
 }
 
 func (i *iter) Next(ctx context.Context) bool {
-	if !i.cursor.Next(ctx) {
+	// The cursor still returns the rest of its current batch once closed.
+	if i.err != nil || i.closed {
 		return false
 	}
 
+	if !i.cursor.Next(ctx) {
+		if i.resume == nil || !isCursorNotFound(i.cursor.Err()) {
+			// Stop the iteration, the error of the cursor, if any, is
+			// returned by Close.
+			i.err = i.cursor.Err()
+			i.data = nil
+			return false
+		}
+
+		i.cursor.Close(ctx)
+		cursor, err := i.resume(ctx, i.last)
+		if err != nil {
+			// Stop the iteration, the error is returned by Close.
+			i.err = err
+			i.data = nil
+			return false
+		}
+		i.cursor = cursor
+		if !i.cursor.Next(ctx) {
+			i.err = i.cursor.Err()
+			i.data = nil
+			return false
+		}
+	}
+
 	item := i.factoryFn()
-	i.decodeErr = i.cursor.Decode(item)
+	if err := i.decode(i.cursor, item); err != nil {
+		// Stop the iteration, the error is returned by Close.
+		i.err = err
+		i.data = nil
+		return false
+	}
 	i.data = item
+	i.last = item.Id()
 	return true
 }
 
@@ -192,23 +601,34 @@ func (i *iter) Value() interface{} {
 	return i.data
 }
 
-func (i *iter) Close(ctx context.Context) error {
+// iterCloseTimeout is the timeout for closing the cursor of an iterator.
+const iterCloseTimeout = 5 * time.Second
+
+// Close closes the cursor with a fresh context, as the context of the iteration
+// may be done already, which would leave the cursor open on the server. It
+// returns the error that ended the iteration early, if any, like a decode error
+// or a network error while getting more results.
+func (i *iter) Close(_ context.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), iterCloseTimeout)
+	defer cancel()
+
+	i.closed = true
+	i.data = nil
 	if err := i.cursor.Close(ctx); err != nil {
 		return err
 	}
-	return i.decodeErr
+	return i.err
 }
 
 // FindCustomIter returns a mgo cursor you can use to stream results of very large datasets
 func (r *Repo) FindCustomIter(tb string, f func(context.Context, *mongo.Collection) (*mongo.Cursor, error)) (repo.Iter, error) {
-	if r.factoryFn == nil {
-		return nil, repo.RepoError{
-			Err: ErrModelNotSet,
-		}
+	factoryFn, err := r.factory(tb)
+	if err != nil {
+		return nil, err
 	}
 
 	ctx := context.Background()
-	c := r.client.Database(r.db).Collection(tb)
+	c := r.collection(tb)
 
 	cursor, err := f(ctx, c)
 	if err != nil {
@@ -225,7 +645,8 @@ func (r *Repo) FindCustomIter(tb string, f func(context.Context, *mongo.Collecti
 
 	return &iter{
 		cursor:    cursor,
-		factoryFn: r.factoryFn,
+		factoryFn: factoryFn,
+		decode:    r.decode,
 	}, nil
 }
 
@@ -235,85 +656,431 @@ func (r *Repo) FindCustomIter(tb string, f func(context.Context, *mongo.Collecti
 // the same query in FindCustom. Expect a ErrInvalidQuery if returning a nil
 // query from the callback.
 func (r *Repo) FindCustom(tb string, f func(context.Context, *mongo.Collection) (*mongo.Cursor, error)) ([]interface{}, error) {
-	if r.factoryFn == nil {
-		return nil, repo.RepoError{
-			Err: ErrModelNotSet,
+	defer r.trackSlow("FindCustom", tb, time.Now())
+
+	factoryFn, err := r.factory(tb)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	c := r.collection(tb)
+
+	find := func() (*mongo.Cursor, error) {
+		cursor, err := f(ctx, c)
+		if err != nil {
+			return nil, repo.RepoError{
+				BaseErr: err,
+				Err:     ErrInvalidQuery,
+			}
+		}
+		if cursor == nil {
+			return nil, repo.RepoError{
+				Err: ErrInvalidQuery,
+			}
 		}
+		return cursor, nil
+	}
+
+	result := []interface{}{}
+	if err := r.findEach(ctx, find, factoryFn, func(entity eventbus.Data) error {
+		result = append(result, entity)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// FindCustomInto is like FindCustom but decodes the results of the cursor into
+// out, which must be a non-nil pointer to a slice of a concrete type, for
+// example *[]*Order. The entity factory and storage codec are not used.
+func (r *Repo) FindCustomInto(tb string, f func(context.Context, *mongo.Collection) (*mongo.Cursor, error), out interface{}) (err error) {
+	defer r.countOp(&r.metrics.finds, &err)
+	defer r.trackSlow("FindCustomInto", tb, time.Now())
+
+	if err := checkSlicePtr(out); err != nil {
+		return err
 	}
 
 	ctx := context.Background()
-	c := r.client.Database(r.db).Collection(tb)
+	c := r.collection(tb)
 
 	cursor, err := f(ctx, c)
 	if err != nil {
-		return nil, repo.RepoError{
+		return repo.RepoError{
 			BaseErr: err,
 			Err:     ErrInvalidQuery,
 		}
 	}
 	if cursor == nil {
-		return nil, repo.RepoError{
+		return repo.RepoError{
 			Err: ErrInvalidQuery,
 		}
 	}
 
-	result := []interface{}{}
-	entity := r.factoryFn()
-	for cursor.Next(ctx) {
-		if err := cursor.Decode(entity); err != nil {
-			return nil, repo.RepoError{
-				Err: err,
-			}
+	if err := cursor.All(ctx, out); err != nil {
+		return repo.RepoError{
+			Err: err,
 		}
-		result = append(result, entity)
-		entity = r.factoryFn()
 	}
-	if err := cursor.Close(ctx); err != nil {
+
+	return nil
+}
+
+// FindCustomOne uses a callback to specify a custom query for returning a
+// single model. Expect a ErrInvalidQuery if returning a nil result from the
+// callback.
+func (r *Repo) FindCustomOne(tb string, f func(context.Context, *mongo.Collection) *mongo.SingleResult) (eventbus.Data, error) {
+	defer r.trackSlow("FindCustomOne", tb, time.Now())
+
+	factoryFn, err := r.factory(tb)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	c := r.collection(tb)
+
+	res := f(ctx, c)
+	if res == nil {
 		return nil, repo.RepoError{
-			Err: err,
+			Err: ErrInvalidQuery,
 		}
 	}
 
-	return result, nil
+	return r.findOne(&r.metrics.finds, res, factoryFn)
 }
 
 // Save implements the Save method of the eventhorizon.WriteRepo interface.
 func (r *Repo) Save(data eventbus.Data) error {
-	if data.Id() == "" {
-		return repo.RepoError{
-			Err:     repo.ErrCouldNotSaveEntity,
-			BaseErr: repo.ErrMissingEntityID,
+	return r.SaveContext(context.Background(), data)
+}
+
+// SaveContext is like Save but uses ctx for the operation, including a write
+// concern set with WithWriteConcern.
+func (r *Repo) SaveContext(ctx context.Context, data eventbus.Data) error {
+	defer r.trackSlow("Save", string(data.DataType()), time.Now())
+
+	_, err := r.save(ctx, data, nil)
+	return err
+}
+
+// SaveWithResult is like Save but returns the result of the update, with the
+// matched, modified and upserted counts.
+func (r *Repo) SaveWithResult(data eventbus.Data) (*mongo.UpdateResult, error) {
+	defer r.trackSlow("Save", string(data.DataType()), time.Now())
+
+	return r.save(context.Background(), data, nil)
+}
+
+// Upsert is like Save but also returns whether the entity was inserted, as
+// opposed to an existing entity being updated.
+func (r *Repo) Upsert(data eventbus.Data) (bool, error) {
+	defer r.trackSlow("Upsert", string(data.DataType()), time.Now())
+
+	res, err := r.save(context.Background(), data, nil)
+	if err != nil {
+		return false, err
+	}
+	return res.UpsertedCount > 0, nil
+}
+
+// save upserts the entity. The document must also match the scope filter, if
+// any, a document with the same ID outside of the scope is a conflict.
+func (r *Repo) save(ctx context.Context, data eventbus.Data, scope bson.M) (*mongo.UpdateResult, error) {
+	filter, update, err := r.saveUpdate(data)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range scope {
+		filter[k] = v
+	}
+
+	return r.upsert(ctx, string(data.DataType()), filter, update, scope != nil)
+}
+
+// upsert writes an update of saveUpdate. All the saves of one entity by an
+// update go through it, and are counted in the metrics. If scoped is set a
+// duplicate ID is a conflict with a document outside of the scope.
+func (r *Repo) upsert(ctx context.Context, ns string, filter, update bson.M, scoped bool) (_ *mongo.UpdateResult, err error) {
+	defer r.countOp(&r.metrics.saves, &err)
+
+	c := r.writeCollection(ctx, ns)
+
+	res, err := c.UpdateOne(ctx,
+		filter,
+		update,
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		if scoped && mongo.IsDuplicateKeyError(err) {
+			return nil, repo.RepoError{
+				Err:     repo.ErrConflict,
+				BaseErr: err,
+			}
+		}
+		return nil, writeError(err)
+	}
+	return res, nil
+}
+
+// Insert creates the entity, it fails with ErrConflict if an entity with the
+// same ID exists. Unlike Save, which creates or updates the entity.
+func (r *Repo) Insert(data eventbus.Data) (err error) {
+	defer r.countOp(&r.metrics.saves, &err)
+	defer r.trackSlow("Insert", string(data.DataType()), time.Now())
+
+	if err := r.prepareSave(data); err != nil {
+		return err
+	}
+
+	doc, err := r.encode(data)
+	if err != nil {
+		return err
+	}
+	doc["_id"] = string(data.Id())
+	if r.autoVersion {
+		doc["_version"] = 1
+	}
+
+	c := r.collection(string(data.DataType()))
+	if _, err := c.InsertOne(context.Background(), doc); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return repo.RepoError{
+				Err:     repo.ErrConflict,
+				BaseErr: err,
+			}
 		}
+		return writeError(err)
 	}
 
-	c := r.client.Database(r.db).Collection(string(data.DataType()))
+	return nil
+}
+
+// Replace saves an entity by replacing the whole stored document, so that no
+// fields of a previous version of the document are left behind. Unlike Save,
+// which merges the entity into the stored document.
+func (r *Repo) Replace(data eventbus.Data) (err error) {
+	defer r.countOp(&r.metrics.saves, &err)
+	defer r.trackSlow("Replace", string(data.DataType()), time.Now())
+
+	if err := r.prepareSave(data); err != nil {
+		return err
+	}
+
+	var doc interface{} = data
+	if r.codec != nil {
+		m, err := r.encode(data)
+		if err != nil {
+			return err
+		}
+		doc = m
+	}
+
+	c := r.collection(string(data.DataType()))
 
 	ctx := context.Background()
-	if _, err := c.UpdateOne(ctx,
+	if _, err := c.ReplaceOne(ctx,
 		bson.M{
 			"_id": data.Id(),
 		},
-		bson.M{
-			"$set": data,
-		},
-		options.Update().SetUpsert(true),
+		doc,
+		options.Replace().SetUpsert(true),
 	); err != nil {
+		return writeError(err)
+	}
+	return nil
+}
+
+// prepareSave validates the entity and runs the save hooks.
+func (r *Repo) prepareSave(data eventbus.Data) error {
+	if data.Id() == "" {
+		return repo.RepoError{
+			Err:     repo.ErrCouldNotSaveEntity,
+			BaseErr: repo.ErrMissingEntityID,
+		}
+	}
+
+	if r.strictTypes && !r.types[data.DataType()] {
+		return repo.RepoError{
+			Err:     repo.ErrCouldNotSaveEntity,
+			BaseErr: fmt.Errorf("%w: %s", ErrUnregisteredType, data.DataType()),
+		}
+	}
+
+	// Checked before the hooks, which may set fields like timestamps.
+	if r.rejectZero && isZeroEntity(data) {
+		return repo.RepoError{
+			Err:     repo.ErrCouldNotSaveEntity,
+			BaseErr: ErrEmptyEntity,
+		}
+	}
+
+	for _, hook := range r.saveHooks {
+		if err := hook(data); err != nil {
+			return repo.RepoError{
+				Err:     repo.ErrCouldNotSaveEntity,
+				BaseErr: err,
+			}
+		}
+	}
+
+	return nil
+}
+
+// isZeroEntity returns whether all stored fields of a struct entity are zero,
+// except for the ID field.
+func isZeroEntity(data eventbus.Data) bool {
+	v := reflect.ValueOf(data)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return true
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return false
+	}
+
+	idField := idFieldIndex(v, data.Id())
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() || i == idField || fieldName(f) == "-" {
+			continue
+		}
+		if !v.Field(i).IsZero() {
+			return false
+		}
+	}
+	return true
+}
+
+// idFieldIndex returns the index of the ID field of a struct: the field stored
+// as _id, or else the first string field holding the ID, which may be stored
+// under another name. It returns -1 if there is none.
+func idFieldIndex(v reflect.Value, id eventbus.DataId) int {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); f.IsExported() && fieldName(f) == "_id" {
+			return i
+		}
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if fv := v.Field(i); f.IsExported() && fv.Kind() == reflect.String && fv.String() == string(id) {
+			return i
+		}
+	}
+	return -1
+}
+
+// saveUpdate prepares the entity and returns the filter and update documents
+// used to upsert it.
+func (r *Repo) saveUpdate(data eventbus.Data) (bson.M, bson.M, error) {
+	if err := r.prepareSave(data); err != nil {
+		return nil, nil, err
+	}
+
+	filter := bson.M{
+		"_id": data.Id(),
+	}
+	doc, err := r.encode(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if r.preserveUnknown {
+		if err := r.mergeStored(data, doc); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// The _id of an inserted document is always the ID of the entity, even
+	// if the entity does not map a field to _id. It can not be changed by
+	// $set.
+	delete(doc, "_id")
+	update := bson.M{
+		"$setOnInsert": bson.M{"_id": string(data.Id())},
+	}
+	if r.autoVersion {
+		// The version can not be both set and incremented.
+		delete(doc, "_version")
+		update["$inc"] = bson.M{"_version": 1}
+	}
+	if len(doc) > 0 {
+		update["$set"] = doc
+	}
+	return filter, update, nil
+}
+
+// mergeStored adds the fields of the stored document of the entity that are
+// missing in doc.
+func (r *Repo) mergeStored(data eventbus.Data, doc bson.M) error {
+	stored := bson.M{}
+	c := r.collection(string(data.DataType()))
+	err := c.FindOne(context.Background(), bson.M{"_id": string(data.Id())}).Decode(&stored)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	} else if err != nil {
 		return repo.RepoError{
 			Err:     repo.ErrCouldNotSaveEntity,
 			BaseErr: err,
 		}
 	}
+
+	mergeUnknown(doc, stored)
 	return nil
 }
 
+// mergeUnknown adds the fields of stored that are missing in doc, recursively
+// for nested documents.
+func mergeUnknown(doc, stored bson.M) {
+	for k, sv := range stored {
+		v, ok := doc[k]
+		if !ok {
+			doc[k] = sv
+			continue
+		}
+		d, ok := v.(bson.M)
+		if !ok {
+			continue
+		}
+		if sd, ok := sv.(bson.M); ok {
+			mergeUnknown(d, sd)
+		}
+	}
+}
+
 // Remove implements the Remove method of the eventhorizon.WriteRepo interface.
 func (r *Repo) Remove(data eventbus.Data) error {
-	c := r.client.Database(r.db).Collection(string(data.DataType()))
+	return r.RemoveContext(context.Background(), data)
+}
 
-	if r, err := c.DeleteOne(context.Background(), bson.M{"_id": data.Id()}); err != nil {
-		return repo.RepoError{
-			Err: err,
-		}
+// RemoveContext is like Remove but uses ctx for the operation, including a
+// write concern set with WithWriteConcern.
+func (r *Repo) RemoveContext(ctx context.Context, data eventbus.Data) error {
+	defer r.trackSlow("Remove", string(data.DataType()), time.Now())
+
+	return r.remove(ctx, data, nil)
+}
+
+// remove removes the entity if it also matches the scope filter, if any. All
+// the removes of one entity by its ID go through it, and are counted in the
+// metrics.
+func (r *Repo) remove(ctx context.Context, data eventbus.Data, scope bson.M) (err error) {
+	defer r.countOp(&r.metrics.removes, &err)
+
+	c := r.writeCollection(ctx, string(data.DataType()))
+
+	filter := bson.M{"_id": data.Id()}
+	for k, v := range scope {
+		filter[k] = v
+	}
+	if r, err := c.DeleteOne(ctx, filter); err != nil {
+		return findError(err)
 	} else if r.DeletedCount == 0 {
 		return repo.RepoError{
 			Err: repo.ErrEntityNotFound,
@@ -323,11 +1090,74 @@ func (r *Repo) Remove(data eventbus.Data) error {
 	return nil
 }
 
+// RemoveIfExists removes the entity like Remove, but returns false instead of
+// ErrEntityNotFound if it does not exist.
+func (r *Repo) RemoveIfExists(data eventbus.Data) (bool, error) {
+	err := r.Remove(data)
+	if rrErr, ok := err.(repo.RepoError); ok && rrErr.Err == repo.ErrEntityNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// RemoveIfVersion removes an entity only if its stored version matches the
+// expected version. ErrIncorrectEntityVersion is returned if the entity exists
+// with another version.
+func (r *Repo) RemoveIfVersion(data eventbus.Data, expectedVersion int) error {
+	defer r.trackSlow("RemoveIfVersion", string(data.DataType()), time.Now())
+
+	ctx := context.Background()
+	err := r.remove(ctx, data, bson.M{"_version": expectedVersion})
+	if rrErr, ok := err.(repo.RepoError); !ok || rrErr.Err != repo.ErrEntityNotFound {
+		return err
+	}
+
+	c := r.collection(string(data.DataType()))
+	n, err := c.CountDocuments(ctx, bson.M{"_id": data.Id()})
+	if err != nil {
+		return findError(err)
+	}
+	if n > 0 {
+		return repo.RepoError{
+			Err: repo.ErrIncorrectEntityVersion,
+		}
+	}
+
+	return repo.RepoError{
+		Err: repo.ErrEntityNotFound,
+	}
+}
+
+// FindOneAndRemove atomically removes a document matching the filter and
+// returns it as an entity, for example to dequeue work items.
+func (r *Repo) FindOneAndRemove(ns string, filter bson.M) (eventbus.Data, error) {
+	defer r.trackSlow("FindOneAndRemove", ns, time.Now())
+
+	factoryFn, err := r.factory(ns)
+	if err != nil {
+		return nil, err
+	}
+	if filter == nil {
+		filter = bson.M{}
+	}
+
+	c := r.collection(ns)
+
+	return r.findOne(&r.metrics.removes, c.FindOneAndDelete(context.Background(), filter), factoryFn)
+}
+
 // Collection lets the function do custom actions on the collection.
 func (r *Repo) Collection(tb string, f func(context.Context, *mongo.Collection) error) error {
-	c := r.client.Database(r.db).Collection(tb)
+	return r.CollectionContext(context.Background(), tb, f)
+}
+
+// CollectionContext is like Collection but passes ctx to the function.
+func (r *Repo) CollectionContext(ctx context.Context, tb string, f func(context.Context, *mongo.Collection) error) error {
+	c := r.collection(tb)
 
-	ctx := context.Background()
 	if err := f(ctx, c); err != nil {
 		return repo.RepoError{
 			Err: err,
@@ -342,11 +1172,128 @@ func (r *Repo) SetEntityFactory(f func() eventbus.Data) {
 	r.factoryFn = f
 }
 
+// RegisterFactory sets the factory for the entities of a namespace, so that
+// one repo can store many entity types. Namespaces without a factory use the
+// one set with SetEntityFactory.
+func (r *Repo) RegisterFactory(ns string, f func() eventbus.Data) {
+	if r.factories == nil {
+		r.factories = map[string]func() eventbus.Data{}
+	}
+	r.factories[ns] = f
+}
+
+// SetCursorBatchSize sets the cursor batch size used when listing entities.
+// A size of 0 uses the driver default.
+func (r *Repo) SetCursorBatchSize(n int32) {
+	r.batchSize = n
+}
+
+// FindOptions returns the find options configured on the repo, for use by
+// FindCustom and FindCustomIter callbacks.
+func (r *Repo) FindOptions() *options.FindOptions {
+	opts := options.Find()
+	if r.batchSize > 0 {
+		opts.SetBatchSize(r.batchSize)
+	}
+	return opts
+}
+
+// AddSaveHook adds a hook that is run before every Save, in the order the hooks
+// were added. Hooks may mutate the entity in place; a hook returning an error
+// aborts the save.
+func (r *Repo) AddSaveHook(f func(eventbus.Data) error) {
+	r.saveHooks = append(r.saveHooks, f)
+}
+
+// SetAutoVersion enables incrementing the _version field of the document on
+// every Save, starting at 1 when the document is inserted.
+func (r *Repo) SetAutoVersion(enabled bool) {
+	r.autoVersion = enabled
+}
+
+// SetPreserveUnknownFields enables keeping the fields of stored documents that
+// are not mapped by the entity on Save, also in nested documents which are
+// otherwise replaced as a whole. The stored document is read before the write,
+// which is not atomic with it.
+func (r *Repo) SetPreserveUnknownFields(enabled bool) {
+	r.preserveUnknown = enabled
+}
+
+// SetRejectZeroValue enables rejecting saves of entities with all fields at
+// their zero value except the _id with ErrEmptyEntity, which are typically
+// bugs that would overwrite the stored entity with blanks.
+func (r *Repo) SetRejectZeroValue(enabled bool) {
+	r.rejectZero = enabled
+}
+
+// SetStrictTypes enables rejecting saves of entities with a type that has not
+// been registered with RegisterType.
+func (r *Repo) SetStrictTypes(enabled bool) {
+	r.strictTypes = enabled
+}
+
+// RegisterType allows saving entities of the type in strict mode.
+func (r *Repo) RegisterType(t eventbus.DataType) {
+	if r.types == nil {
+		r.types = map[eventbus.DataType]bool{}
+	}
+	r.types[t] = true
+}
+
+// SetMaxResults sets the maximum number of entities FindAll may return before
+// failing with ErrResultSetTooLarge. A max of 0 disables the check.
+func (r *Repo) SetMaxResults(n int) {
+	r.maxResults = n
+}
+
+// SetSlowQueryThreshold sets a callback that is called with the timing of any
+// operation that takes at least d. A nil callback disables it.
+func (r *Repo) SetSlowQueryThreshold(d time.Duration, log func(op, ns string, dur time.Duration)) {
+	r.slowThreshold = d
+	r.slowLog = log
+}
+
+func (r *Repo) trackSlow(op, ns string, start time.Time) {
+	if r.slowLog == nil {
+		return
+	}
+	if dur := time.Since(start); dur >= r.slowThreshold {
+		r.slowLog(op, ns, dur)
+	}
+}
+
+// HasFactory returns whether there is an entity factory for the namespace,
+// registered with RegisterFactory or set with SetEntityFactory.
+func (r *Repo) HasFactory(ns string) bool {
+	_, err := r.factory(ns)
+	return err == nil
+}
+
+// factory returns the entity factory of the namespace, or ErrModelNotSet if
+// there is none.
+func (r *Repo) factory(ns string) (func() eventbus.Data, error) {
+	if f, ok := r.factories[ns]; ok {
+		return f, nil
+	}
+	if r.factoryFn == nil {
+		return nil, repo.RepoError{
+			Err: ErrModelNotSet,
+		}
+	}
+	return r.factoryFn, nil
+}
+
 // Clear clears the read model database.
 func (r *Repo) Clear(tb string) error {
-	c := r.client.Database(r.db).Collection(tb)
+	return r.ClearContext(context.Background(), tb)
+}
+
+// ClearContext is like Clear but uses ctx for the operation.
+func (r *Repo) ClearContext(ctx context.Context, tb string) error {
+	defer r.trackSlow("Clear", tb, time.Now())
+
+	c := r.collection(tb)
 
-	ctx := context.Background()
 	if err := c.Drop(ctx); err != nil {
 		return repo.RepoError{
 			Err:     ErrCouldNotClearDB,
@@ -356,9 +1303,184 @@ func (r *Repo) Clear(tb string) error {
 	return nil
 }
 
-// Close closes a database session.
+// Rename renames a collection. Both collections are in the database of the
+// repo, as MongoDB can only rename collections within the same database
+// without copying. If dropTarget is set an existing target collection is
+// dropped first, otherwise the rename fails if the target exists.
+func (r *Repo) Rename(from, to string, dropTarget bool) error {
+	defer r.trackSlow("Rename", from, time.Now())
+
+	cmd := bson.D{
+		{Key: "renameCollection", Value: r.db + "." + from},
+		{Key: "to", Value: r.db + "." + to},
+		{Key: "dropTarget", Value: dropTarget},
+	}
+	ctx := context.Background()
+	if err := r.getClient().Database("admin").RunCommand(ctx, cmd).Err(); err != nil {
+		return repo.RepoError{
+			Err: err,
+		}
+	}
+
+	return nil
+}
+
+// CopyCollection copies all documents of a collection to another collection in
+// the database of the repo, on the server. The target collection is replaced,
+// or with merge the documents are merged into it, replacing documents with the
+// same _id. The aggregation does not report the number of written documents,
+// it returns the number of documents in the target collection after the copy,
+// which with merge includes the documents that were already in it.
+func (r *Repo) CopyCollection(from, to string, merge bool) (int64, error) {
+	defer r.trackSlow("CopyCollection", from, time.Now())
+
+	stage := bson.D{{Key: "$out", Value: to}}
+	if merge {
+		stage = bson.D{{Key: "$merge", Value: bson.M{"into": to}}}
+	}
+
+	c := r.collection(from)
+	ctx := context.Background()
+	cursor, err := c.Aggregate(ctx, mongo.Pipeline{stage})
+	if err != nil {
+		return 0, repo.RepoError{
+			Err: err,
+		}
+	}
+	if err := cursor.Close(ctx); err != nil {
+		return 0, repo.RepoError{
+			Err: err,
+		}
+	}
+
+	n, err := r.collection(to).CountDocuments(ctx, bson.M{})
+	if err != nil {
+		return 0, repo.RepoError{
+			Err: err,
+		}
+	}
+
+	return n, nil
+}
+
+// ServerVersion returns the version of the MongoDB server, for example "7.0.2",
+// from the buildInfo command.
+func (r *Repo) ServerVersion() (string, error) {
+	var info struct {
+		Version string `bson:"version"`
+	}
+	ctx := context.Background()
+	if err := r.getClient().Database(r.db).RunCommand(ctx, bson.D{{Key: "buildInfo", Value: 1}}).Decode(&info); err != nil {
+		return "", repo.RepoError{
+			Err: err,
+		}
+	}
+
+	return info.Version, nil
+}
+
+// Reconnect re-dials the database with the options the repo was created with
+// and swaps in the new client. Only repos created with NewRepo can reconnect.
+func (r *Repo) Reconnect() error {
+	if r.clientOpts == nil {
+		return repo.RepoError{
+			Err: ErrNoClientOptions,
+		}
+	}
+
+	ctx := context.Background()
+	client, err := mongo.Connect(ctx, r.clientOpts)
+	if err != nil {
+		return repo.RepoError{
+			Err:     ErrCouldNotDialDB,
+			BaseErr: err,
+		}
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		client.Disconnect(ctx)
+		return repo.RepoError{
+			Err:     ErrCouldNotDialDB,
+			BaseErr: err,
+		}
+	}
+
+	r.clientMu.Lock()
+	old := r.client
+	r.client = client
+	r.clientMu.Unlock()
+
+	// Operations in flight may still use the old client, which is given some
+	// time to finish them. Disconnect also waits for the connections in use.
+	time.AfterFunc(disconnectGrace, func() {
+		old.Disconnect(context.Background())
+	})
+
+	return nil
+}
+
+// disconnectGrace is the time the old client is kept by Reconnect.
+const disconnectGrace = 10 * time.Second
+
+// SetAutoReconnect makes the repo re-dial the database with Reconnect when an
+// operation fails because the client is disconnected, for example after the
+// client was closed elsewhere. The failed operation still returns its error,
+// the following operations use the new client.
+func (r *Repo) SetAutoReconnect(enabled bool) {
+	r.reconnectMu.Lock()
+	defer r.reconnectMu.Unlock()
+
+	r.autoReconnect = enabled
+}
+
+// reconnectIfDisconnected reconnects if the error is caused by a disconnected
+// client and auto reconnect is enabled.
+func (r *Repo) reconnectIfDisconnected(err error) {
+	if !isDisconnected(err) {
+		return
+	}
+
+	r.reconnectMu.Lock()
+	defer r.reconnectMu.Unlock()
+
+	if !r.autoReconnect {
+		return
+	}
+	// Another failed operation may have reconnected already. Pinging a
+	// disconnected client fails right away.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := r.getClient().Ping(ctx, nil); !isDisconnected(err) {
+		return
+	}
+	r.Reconnect()
+}
+
+// isDisconnected returns whether the error is caused by a disconnected client.
+func isDisconnected(err error) bool {
+	if rrErr, ok := err.(repo.RepoError); ok {
+		return isDisconnected(rrErr.Err) || isDisconnected(rrErr.BaseErr)
+	}
+	return err != nil && errors.Is(err, mongo.ErrClientDisconnected)
+}
+
+// Close closes a database session. The repo does not reconnect after Close.
 func (r *Repo) Close() {
-	r.client.Disconnect(context.Background())
+	r.reconnectMu.Lock()
+	r.autoReconnect = false
+	r.reconnectMu.Unlock()
+
+	r.getClient().Disconnect(context.Background())
+}
+
+func (r *Repo) getClient() *mongo.Client {
+	r.clientMu.RLock()
+	defer r.clientMu.RUnlock()
+
+	return r.client
+}
+
+func (r *Repo) collection(name string, opts ...*options.CollectionOptions) *mongo.Collection {
+	return r.getClient().Database(r.db).Collection(name, opts...)
 }
 
 // Repository returns a parent ReadRepo if there is one.
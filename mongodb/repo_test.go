@@ -0,0 +1,1492 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo"
+	"github.com/jeek120/repo/mocks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"os"
+	"reflect"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+)
+
+// serverErr is the error pinging the test server, checked once.
+var (
+	serverOnce sync.Once
+	serverErr  error
+)
+
+func testURI() string {
+	addr := os.Getenv("MONGODB_ADDR")
+	if addr == "" {
+		addr = "localhost:27017"
+	}
+	return "mongodb://" + addr
+}
+
+// newTestRepo returns a repo on a new database with a factory for
+// mocks.Model, created with the options. The test is skipped if there is no
+// MongoDB server at MONGODB_ADDR, localhost:27017 by default.
+func newTestRepo(t testing.TB, opts ...Option) *Repo {
+	db := fmt.Sprintf("test-%d", time.Now().UnixNano())
+	opts = append([]Option{WithServerSelectionTimeout(time.Second)}, opts...)
+	r, err := NewRepo(testURI(), db, opts...)
+	if err != nil {
+		t.Skip("no MongoDB server:", err)
+	}
+	serverOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		serverErr = r.getClient().Ping(ctx, nil)
+	})
+	if serverErr != nil {
+		r.Close()
+		t.Skip("no MongoDB server:", serverErr)
+	}
+
+	r.SetEntityFactory(func() eventbus.Data {
+		return &mocks.Model{}
+	})
+	t.Cleanup(func() {
+		r.getClient().Database(db).Drop(context.Background())
+		r.Close()
+	})
+
+	return r
+}
+
+func TestRepo(t *testing.T) {
+	r := newTestRepo(t)
+	ns := string(mocks.ModelType)
+
+	if _, err := r.FindById(ns, "1"); !isNotFound(err) {
+		t.Error("there should be a not found error:", err)
+	}
+
+	m := &mocks.Model{ID: "1", Content: "content", CreatedAt: time.Now().Round(time.Millisecond).UTC()}
+	if err := r.Save(m); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	entity, err := r.FindById(ns, "1")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if got := entity.(*mocks.Model); *got != *m {
+		t.Errorf("the entity should be correct: %+v", got)
+	}
+
+	if entities, err := r.FindAll(ns); err != nil || len(entities) != 1 {
+		t.Error("there should be one entity:", entities, err)
+	}
+	if n, err := r.Count(ns); err != nil || n != 1 {
+		t.Error("there should be one entity:", n, err)
+	}
+
+	if err := r.Remove(m); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := r.Remove(m); !isNotFound(err) {
+		t.Error("there should be a not found error:", err)
+	}
+}
+
+func isNotFound(err error) bool {
+	rrErr, ok := err.(repo.RepoError)
+	return ok && rrErr.Err == repo.ErrEntityNotFound
+}
+
+func newTestIter(t *testing.T, docs []interface{}, err error) *iter {
+	cursor, cerr := mongo.NewCursorFromDocuments(docs, err, nil)
+	if cerr != nil {
+		t.Fatal("could not create cursor:", cerr)
+	}
+	r := &Repo{}
+	return &iter{
+		cursor: cursor,
+		factoryFn: func() eventbus.Data {
+			return &mocks.Model{}
+		},
+		decode: r.decode,
+	}
+}
+
+func TestIterDecodeError(t *testing.T) {
+	i := newTestIter(t, []interface{}{
+		bson.M{"_id": "1", "content": "a"},
+		bson.M{"_id": "2", "content": 2},
+		bson.M{"_id": "3", "content": "c"},
+	}, nil)
+
+	var ids []eventbus.DataId
+	for i.Next(context.Background()) {
+		ids = append(ids, i.Value().(eventbus.Data).Id())
+	}
+	if len(ids) != 1 || ids[0] != "1" {
+		t.Error("the iteration should stop before the malformed document:", ids)
+	}
+	if i.Value() != nil {
+		t.Error("there should be no value after the error:", i.Value())
+	}
+	if err := i.Close(context.Background()); err == nil {
+		t.Error("there should be a decode error")
+	}
+}
+
+func TestIterCursorError(t *testing.T) {
+	cursorErr := errors.New("connection reset")
+	i := newTestIter(t, nil, cursorErr)
+
+	if i.Next(context.Background()) {
+		t.Error("there should be no value")
+	}
+	if err := i.Close(context.Background()); err != cursorErr {
+		t.Error("the cursor error should be returned by Close:", err)
+	}
+}
+
+func TestIterClose(t *testing.T) {
+	i := newTestIter(t, []interface{}{
+		bson.M{"_id": "1"},
+		bson.M{"_id": "2"},
+	}, nil)
+
+	if !i.Next(context.Background()) {
+		t.Fatal("there should be a value")
+	}
+	if err := i.Close(context.Background()); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if i.Next(context.Background()) {
+		t.Error("there should be no value after Close:", i.Value())
+	}
+	if i.Value() != nil {
+		t.Error("there should be no value after Close:", i.Value())
+	}
+}
+
+func TestIterResume(t *testing.T) {
+	cursorNotFoundErr := mongo.CommandError{Code: cursorNotFound, Message: "cursor id 1 not found"}
+
+	i := newTestIter(t, []interface{}{
+		bson.M{"_id": "1"},
+		bson.M{"_id": "2"},
+	}, nil)
+	var resumedAfter eventbus.DataId
+	i.resume = func(ctx context.Context, after eventbus.DataId) (*mongo.Cursor, error) {
+		resumedAfter = after
+		return mongo.NewCursorFromDocuments([]interface{}{
+			bson.M{"_id": "3"},
+			bson.M{"_id": "4"},
+		}, nil, nil)
+	}
+
+	ctx := context.Background()
+	var ids []eventbus.DataId
+	for len(ids) < 2 && i.Next(ctx) {
+		ids = append(ids, i.Value().(eventbus.Data).Id())
+	}
+	// Simulate the cursor timing out on the server.
+	i.cursor, _ = mongo.NewCursorFromDocuments(nil, cursorNotFoundErr, nil)
+	for i.Next(ctx) {
+		ids = append(ids, i.Value().(eventbus.Data).Id())
+	}
+	if err := i.Close(ctx); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	if resumedAfter != "2" {
+		t.Error("the query should be resumed after the last ID:", resumedAfter)
+	}
+	if fmt.Sprint(ids) != "[1 2 3 4]" {
+		t.Error("the stream should resume:", ids)
+	}
+}
+
+func TestIterResumeError(t *testing.T) {
+	cursorNotFoundErr := mongo.CommandError{Code: cursorNotFound, Message: "cursor id 1 not found"}
+	resumeErr := errors.New("connection reset")
+
+	i := newTestIter(t, nil, cursorNotFoundErr)
+	i.resume = func(ctx context.Context, after eventbus.DataId) (*mongo.Cursor, error) {
+		return mongo.NewCursorFromDocuments(nil, resumeErr, nil)
+	}
+
+	if i.Next(context.Background()) {
+		t.Error("there should be no value")
+	}
+	if err := i.Close(context.Background()); err != resumeErr {
+		t.Error("the error of the resumed cursor should be returned by Close:", err)
+	}
+}
+
+type Order struct {
+	ID       eventbus.DataId `bson:"_id"`
+	Customer string          `bson:"customer"`
+	Total    int             `bson:"total"`
+}
+
+func (o *Order) Id() eventbus.DataId         { return o.ID }
+func (o *Order) DataType() eventbus.DataType { return "Order" }
+
+func TestRepoHasFactory(t *testing.T) {
+	r := &Repo{}
+	if r.HasFactory("Order") {
+		t.Error("there should be no factory")
+	}
+
+	r.RegisterFactory("Order", func() eventbus.Data {
+		return &Order{}
+	})
+	if !r.HasFactory("Order") {
+		t.Error("there should be a registered factory")
+	}
+	if r.HasFactory(string(mocks.ModelType)) {
+		t.Error("there should be no factory for another namespace")
+	}
+
+	r.SetEntityFactory(func() eventbus.Data {
+		return &mocks.Model{}
+	})
+	if !r.HasFactory(string(mocks.ModelType)) {
+		t.Error("the default factory should be used")
+	}
+}
+
+func TestRepoRegisterFactory(t *testing.T) {
+	r := newTestRepo(t)
+	r.RegisterFactory("Order", func() eventbus.Data {
+		return &Order{}
+	})
+
+	if err := r.Save(&mocks.Model{ID: "1", Content: "model"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := r.Save(&Order{ID: "1", Customer: "customer", Total: 10}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	entity, err := r.FindById(string(mocks.ModelType), "1")
+	if m, ok := entity.(*mocks.Model); err != nil || !ok || m.Content != "model" {
+		t.Error("the model should be decoded with its factory:", entity, err)
+	}
+	entity, err = r.FindById("Order", "1")
+	if o, ok := entity.(*Order); err != nil || !ok || o.Total != 10 {
+		t.Error("the order should be decoded with its factory:", entity, err)
+	}
+}
+
+func TestRepoAutoReconnect(t *testing.T) {
+	r := newTestRepo(t)
+	r.SetAutoReconnect(true)
+	ns := string(mocks.ModelType)
+
+	if err := r.Save(&mocks.Model{ID: "1"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	// Simulate the client being closed under the repo.
+	r.getClient().Disconnect(context.Background())
+	if _, err := r.FindById(ns, "1"); !isDisconnected(err) {
+		t.Fatal("there should be a disconnected error:", err)
+	}
+
+	// The failure was detected and the repo reconnected.
+	if _, err := r.FindById(ns, "1"); err != nil {
+		t.Error("there should be no error after reconnecting:", err)
+	}
+}
+
+func TestRepoReconnect(t *testing.T) {
+	r := newTestRepo(t)
+	ns := string(mocks.ModelType)
+
+	r.getClient().Disconnect(context.Background())
+	if _, err := r.FindById(ns, "1"); !isDisconnected(err) {
+		t.Fatal("there should be a disconnected error:", err)
+	}
+	// No auto reconnect.
+	if _, err := r.FindById(ns, "1"); !isDisconnected(err) {
+		t.Fatal("there should be a disconnected error:", err)
+	}
+
+	if err := r.Reconnect(); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if _, err := r.FindById(ns, "1"); !isNotFound(err) {
+		t.Error("there should be a not found error:", err)
+	}
+}
+
+func TestIsDisconnected(t *testing.T) {
+	if !isDisconnected(repo.RepoError{Err: mongo.ErrClientDisconnected}) {
+		t.Error("the error should be a disconnected error")
+	}
+	if !isDisconnected(repo.RepoError{Err: repo.ErrCouldNotSaveEntity, BaseErr: mongo.ErrClientDisconnected}) {
+		t.Error("the base error should be a disconnected error")
+	}
+	if isDisconnected(repo.RepoError{Err: repo.ErrEntityNotFound}) {
+		t.Error("the error should not be a disconnected error")
+	}
+	if isDisconnected(nil) {
+		t.Error("nil should not be a disconnected error")
+	}
+}
+
+func TestRepoReconnectWithoutOptions(t *testing.T) {
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:1"))
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	r, err := NewRepoWithClient(client, "test")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer r.Close()
+
+	if err := r.Reconnect(); err == nil || err.(repo.RepoError).Err != ErrNoClientOptions {
+		t.Error("there should be a no client options error:", err)
+	}
+}
+
+type taggedIdModel struct {
+	ID      eventbus.DataId `bson:"id"`
+	Content string          `bson:"content"`
+	Count   int             `bson:"count"`
+}
+
+func (m *taggedIdModel) Id() eventbus.DataId         { return m.ID }
+func (m *taggedIdModel) DataType() eventbus.DataType { return "TaggedIdModel" }
+
+func TestIsZeroEntity(t *testing.T) {
+	cases := map[string]struct {
+		data eventbus.Data
+		want bool
+	}{
+		"_id only":          {&mocks.Model{ID: "1"}, true},
+		"_id and content":   {&mocks.Model{ID: "1", Content: "a"}, false},
+		"tagged id only":    {&taggedIdModel{ID: "1"}, true},
+		"tagged id content": {&taggedIdModel{ID: "1", Content: "a"}, false},
+		"tagged id count":   {&taggedIdModel{ID: "1", Count: 1}, false},
+		"content is id":     {&taggedIdModel{ID: "1", Content: "1"}, false},
+		"nil":               {(*mocks.Model)(nil), true},
+	}
+	for name, tc := range cases {
+		if got := isZeroEntity(tc.data); got != tc.want {
+			t.Errorf("%s: got %v, want %v", name, got, tc.want)
+		}
+	}
+}
+
+func TestRepoRejectZeroValue(t *testing.T) {
+	// The save fails before any write, no server is needed.
+	r, err := NewRepo("mongodb://localhost:1", "test")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer r.Close()
+	r.SetRejectZeroValue(true)
+
+	for _, data := range []eventbus.Data{
+		&mocks.Model{ID: "1"},
+		&taggedIdModel{ID: "1"},
+	} {
+		err := r.Save(data)
+		if rrErr, ok := err.(repo.RepoError); !ok || rrErr.BaseErr != ErrEmptyEntity {
+			t.Errorf("%T: there should be an empty entity error: %v", data, err)
+		}
+	}
+}
+
+func TestRepoStrictTypes(t *testing.T) {
+	// The save fails before any write, no server is needed.
+	r, err := NewRepo("mongodb://localhost:1", "test")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer r.Close()
+	r.SetStrictTypes(true)
+	r.RegisterType("User")
+
+	for _, data := range []eventbus.Data{
+		&mocks.Model{ID: "1"},
+		&Account{ID: "1"},
+	} {
+		err := r.Save(data)
+		if rrErr, ok := err.(repo.RepoError); !ok || rrErr.Err != repo.ErrCouldNotSaveEntity || !errors.Is(rrErr.BaseErr, ErrUnregisteredType) {
+			t.Errorf("%T: there should be an unregistered type error: %v", data, err)
+		}
+	}
+
+	if err := r.prepareSave(&User{ID: "1"}); err != nil {
+		t.Error("a registered type should be allowed:", err)
+	}
+	r.SetStrictTypes(false)
+	if err := r.prepareSave(&mocks.Model{ID: "1"}); err != nil {
+		t.Error("all types should be allowed without strict mode:", err)
+	}
+}
+
+func TestRepoDecodeAllCursorError(t *testing.T) {
+	cursorErr := errors.New("connection reset")
+	cursor, err := mongo.NewCursorFromDocuments(nil, cursorErr, nil)
+	if err != nil {
+		t.Fatal("could not create cursor:", err)
+	}
+
+	r := &Repo{}
+	err = r.decodeAll(context.Background(), cursor, func() eventbus.Data {
+		return &mocks.Model{}
+	}, func(entity eventbus.Data) error {
+		return nil
+	})
+	if rrErr, ok := err.(repo.RepoError); !ok || rrErr.Err != cursorErr {
+		t.Error("the cursor error should be returned:", err)
+	}
+}
+
+func TestRepoFindAllMap(t *testing.T) {
+	r := newTestRepo(t)
+	ns := string(mocks.ModelType)
+
+	for _, id := range []eventbus.DataId{"1", "2", "3"} {
+		if err := r.Save(&mocks.Model{ID: id, Content: "content " + string(id)}); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+
+	result, err := r.FindAllMap(ns)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(result) != 3 {
+		t.Error("there should be three entities:", result)
+	}
+	for id, entity := range result {
+		if entity.Id() != id || entity.(*mocks.Model).Content != "content "+string(id) {
+			t.Errorf("the entity should be keyed by its ID: %s %+v", id, entity)
+		}
+	}
+}
+
+func TestRepoFindByIds(t *testing.T) {
+	r := newTestRepo(t)
+	ns := string(mocks.ModelType)
+
+	for _, id := range []eventbus.DataId{"1", "2", "3"} {
+		if err := r.Save(&mocks.Model{ID: id}); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+
+	entities, err := r.FindByIds(ns, []eventbus.DataId{"1", "3", "4"})
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	ids := map[eventbus.DataId]bool{}
+	for _, e := range entities {
+		ids[e.Id()] = true
+	}
+	if len(entities) != 2 || !ids["1"] || !ids["3"] {
+		t.Error("only the found entities should be returned:", entities)
+	}
+
+	if entities, err := r.FindByIds(ns, nil); err != nil || len(entities) != 0 {
+		t.Error("there should be no entities:", entities, err)
+	}
+}
+
+func TestRepoFindCustomOne(t *testing.T) {
+	r := newTestRepo(t)
+	ns := string(mocks.ModelType)
+
+	if err := r.Save(&mocks.Model{ID: "1", Content: "content"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	entity, err := r.FindCustomOne(ns, func(ctx context.Context, c *mongo.Collection) *mongo.SingleResult {
+		return c.FindOne(ctx, bson.M{"content": "content"})
+	})
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if m := entity.(*mocks.Model); m.ID != "1" {
+		t.Errorf("the entity should be correct: %+v", m)
+	}
+
+	if _, err := r.FindCustomOne(ns, func(ctx context.Context, c *mongo.Collection) *mongo.SingleResult {
+		return c.FindOne(ctx, bson.M{"content": "other"})
+	}); !isNotFound(err) {
+		t.Error("there should be a not found error:", err)
+	}
+}
+
+func TestRepoFindCustomOneError(t *testing.T) {
+	r, err := NewRepo("mongodb://localhost:1", "test")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer r.Close()
+	r.SetEntityFactory(func() eventbus.Data {
+		return &mocks.Model{}
+	})
+	ns := string(mocks.ModelType)
+
+	if _, err := r.FindCustomOne(ns, func(ctx context.Context, c *mongo.Collection) *mongo.SingleResult {
+		return mongo.NewSingleResultFromDocument(bson.D{}, mongo.ErrNoDocuments, nil)
+	}); !isNotFound(err) {
+		t.Error("there should be a not found error:", err)
+	}
+
+	timeoutErr := mongo.CommandError{Code: 50, Name: "MaxTimeMSExpired"}
+	if _, err := r.FindCustomOne(ns, func(ctx context.Context, c *mongo.Collection) *mongo.SingleResult {
+		return mongo.NewSingleResultFromDocument(bson.D{}, timeoutErr, nil)
+	}); err == nil || err.(repo.RepoError).Err != repo.ErrQueryTimeout {
+		t.Error("there should be a query timeout error:", err)
+	}
+
+	if _, err := r.FindCustomOne(ns, func(ctx context.Context, c *mongo.Collection) *mongo.SingleResult {
+		return nil
+	}); err == nil || err.(repo.RepoError).Err != ErrInvalidQuery {
+		t.Error("there should be an invalid query error:", err)
+	}
+}
+
+func TestRepoSaveHooks(t *testing.T) {
+	r := newTestRepo(t)
+	ns := string(mocks.ModelType)
+
+	var order []string
+	r.AddSaveHook(func(data eventbus.Data) error {
+		order = append(order, "first")
+		data.(*mocks.Model).Content = "hooked"
+		return nil
+	})
+	r.AddSaveHook(func(data eventbus.Data) error {
+		order = append(order, "second")
+		data.(*mocks.Model).Content += " twice"
+		return nil
+	})
+
+	if err := r.Save(&mocks.Model{ID: "1", Content: "content"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(order) != 2 || order[0] != "first" || order[1] != "second" {
+		t.Error("the hooks should run in order:", order)
+	}
+	entity, err := r.FindById(ns, "1")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if m := entity.(*mocks.Model); m.Content != "hooked twice" {
+		t.Error("the changes of the hooks should be saved:", m.Content)
+	}
+}
+
+func TestRepoSaveHookError(t *testing.T) {
+	r, err := NewRepo("mongodb://localhost:1", "test")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer r.Close()
+
+	hookErr := errors.New("hook error")
+	called := false
+	r.AddSaveHook(func(eventbus.Data) error {
+		return hookErr
+	})
+	r.AddSaveHook(func(eventbus.Data) error {
+		called = true
+		return nil
+	})
+
+	// The hook fails before the database is reached.
+	err = r.Save(&mocks.Model{ID: "1"})
+	if rrErr, ok := err.(repo.RepoError); !ok || rrErr.Err != repo.ErrCouldNotSaveEntity || rrErr.BaseErr != hookErr {
+		t.Error("there should be a hook error:", err)
+	}
+	if called {
+		t.Error("the hooks after the failed one should not run")
+	}
+}
+
+func TestRepoCursorBatchSize(t *testing.T) {
+	// The batch sizes of the find and getMore commands sent to the server.
+	var mu sync.Mutex
+	var finds, getMores []int32
+	monitor := &event.CommandMonitor{
+		Started: func(_ context.Context, e *event.CommandStartedEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			switch e.CommandName {
+			case "find":
+				if v, err := e.Command.LookupErr("batchSize"); err == nil {
+					finds = append(finds, v.Int32())
+				}
+			case "getMore":
+				if v, err := e.Command.LookupErr("batchSize"); err == nil {
+					getMores = append(getMores, v.Int32())
+				}
+			}
+		},
+	}
+	r := newTestRepo(t, func(opts *options.ClientOptions) {
+		opts.SetMonitor(monitor)
+	})
+	ns := string(mocks.ModelType)
+
+	for i := 0; i < 5; i++ {
+		if err := r.Save(&mocks.Model{ID: eventbus.DataId(fmt.Sprint(i))}); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+
+	r.SetCursorBatchSize(2)
+	if opts := r.FindOptions(); opts.BatchSize == nil || *opts.BatchSize != 2 {
+		t.Error("the batch size should be set in the find options:", opts.BatchSize)
+	}
+	entities, err := r.FindAll(ns)
+	if err != nil || len(entities) != 5 {
+		t.Fatal("there should be five entities:", entities, err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(finds) != 1 || finds[0] != 2 {
+		t.Error("the batch size should reach the driver:", finds)
+	}
+	if len(getMores) != 2 {
+		t.Error("the rest of the entities should be read in batches:", getMores)
+	}
+}
+
+func TestRepoFindAllLenient(t *testing.T) {
+	r := newTestRepo(t)
+	ns := string(mocks.ModelType)
+
+	// The content of the second document can not be decoded to a string.
+	if _, err := r.collection(ns).InsertMany(context.Background(), []interface{}{
+		bson.M{"_id": "1", "content": "a"},
+		bson.M{"_id": "2", "content": 5},
+		bson.M{"_id": "3", "content": "c"},
+	}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	if _, err := r.FindAll(ns); err == nil {
+		t.Error("there should be a decode error")
+	}
+
+	entities, errs := r.FindAllLenient(ns)
+	if len(entities) != 2 {
+		t.Error("the valid entities should be returned:", entities)
+	}
+	for _, e := range entities {
+		if e.Id() == "2" {
+			t.Error("the malformed entity should not be returned")
+		}
+	}
+	if len(errs) != 1 {
+		t.Error("there should be one decode error:", errs)
+	}
+}
+
+func TestNewClientOptions(t *testing.T) {
+	opts := newClientOptions("mongodb://localhost:27017",
+		WithMaxPoolSize(50),
+		WithMinPoolSize(5),
+		WithConnectTimeout(3*time.Second),
+		WithServerSelectionTimeout(4*time.Second),
+	)
+
+	if opts.MaxPoolSize == nil || *opts.MaxPoolSize != 50 {
+		t.Error("the max pool size should be set:", opts.MaxPoolSize)
+	}
+	if opts.MinPoolSize == nil || *opts.MinPoolSize != 5 {
+		t.Error("the min pool size should be set:", opts.MinPoolSize)
+	}
+	if opts.ConnectTimeout == nil || *opts.ConnectTimeout != 3*time.Second {
+		t.Error("the connect timeout should be set:", opts.ConnectTimeout)
+	}
+	if opts.ServerSelectionTimeout == nil || *opts.ServerSelectionTimeout != 4*time.Second {
+		t.Error("the server selection timeout should be set:", opts.ServerSelectionTimeout)
+	}
+
+	// Without options the driver defaults are kept.
+	opts = newClientOptions("mongodb://localhost:27017")
+	if opts.MaxPoolSize != nil || opts.MinPoolSize != nil || opts.ConnectTimeout != nil {
+		t.Error("the driver defaults should be kept")
+	}
+}
+
+func TestRepoRemoveIfVersion(t *testing.T) {
+	r := newTestRepo(t)
+	r.SetAutoVersion(true)
+	ns := string(mocks.ModelType)
+
+	m := &mocks.Model{ID: "1"}
+	if err := r.RemoveIfVersion(m, 1); !isNotFound(err) {
+		t.Error("there should be a not found error:", err)
+	}
+
+	// Saved twice, at version 2.
+	for i := 0; i < 2; i++ {
+		if err := r.Save(m); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+
+	if err := r.RemoveIfVersion(m, 1); err == nil || err.(repo.RepoError).Err != repo.ErrIncorrectEntityVersion {
+		t.Error("there should be an incorrect version error:", err)
+	}
+	if _, err := r.FindById(ns, "1"); err != nil {
+		t.Error("the entity should not be removed:", err)
+	}
+
+	if err := r.RemoveIfVersion(m, 2); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := r.FindById(ns, "1"); !isNotFound(err) {
+		t.Error("the entity should be removed:", err)
+	}
+}
+
+func TestRepoModelNotSet(t *testing.T) {
+	r, err := NewRepo("mongodb://localhost:1", "test")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer r.Close()
+	ns := string(mocks.ModelType)
+	if r.HasFactory(ns) {
+		t.Error("there should be no factory")
+	}
+
+	// All methods decoding entities fail before the database is reached.
+	cursorFn := func(context.Context, *mongo.Collection) (*mongo.Cursor, error) {
+		return nil, nil
+	}
+	testCases := map[string]func() error{
+		"Find": func() error {
+			_, err := r.Find(&mocks.Model{ID: "1"})
+			return err
+		},
+		"FindById": func() error {
+			_, err := r.FindById(ns, "1")
+			return err
+		},
+		"FindByIds": func() error {
+			_, err := r.FindByIds(ns, []eventbus.DataId{"1"})
+			return err
+		},
+		"FindAll": func() error {
+			_, err := r.FindAll(ns)
+			return err
+		},
+		"FindAllIter": func() error {
+			_, err := r.FindAllIter(ns)
+			return err
+		},
+		"FindAllMap": func() error {
+			_, err := r.FindAllMap(ns)
+			return err
+		},
+		"FindAllLenient": func() error {
+			_, errs := r.FindAllLenient(ns)
+			if len(errs) != 1 {
+				return fmt.Errorf("there should be one error: %v", errs)
+			}
+			return errs[0]
+		},
+		"FindAllChan": func() error {
+			_, _, err := r.FindAllChan(context.Background(), ns)
+			return err
+		},
+		"FindAllSnapshot": func() error {
+			_, err := r.FindAllSnapshot(ns)
+			return err
+		},
+		"FindAllGrouped": func() error {
+			_, err := r.FindAllGrouped(ns, "content")
+			return err
+		},
+		"Query": func() error {
+			_, err := r.Query(ns, QueryOptions{})
+			return err
+		},
+		"FindByIdProjected": func() error {
+			_, err := r.FindByIdProjected(ns, "1", "content")
+			return err
+		},
+		"FindOneWithCollation": func() error {
+			_, err := r.FindOneWithCollation(ns, bson.M{}, &options.Collation{Locale: "en"})
+			return err
+		},
+		"FindOneAndRemove": func() error {
+			_, err := r.FindOneAndRemove(ns, nil)
+			return err
+		},
+		"FindCustom": func() error {
+			_, err := r.FindCustom(ns, cursorFn)
+			return err
+		},
+		"FindCustomIter": func() error {
+			_, err := r.FindCustomIter(ns, cursorFn)
+			return err
+		},
+		"FindCustomOne": func() error {
+			_, err := r.FindCustomOne(ns, func(context.Context, *mongo.Collection) *mongo.SingleResult {
+				return nil
+			})
+			return err
+		},
+	}
+	for name, f := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if err := f(); err == nil || err.(repo.RepoError).Err != ErrModelNotSet {
+				t.Error("there should be a model not set error:", err)
+			}
+		})
+	}
+}
+
+func TestRepoReplace(t *testing.T) {
+	r := newTestRepo(t)
+	c := r.collection(string(mocks.ModelType))
+	ctx := context.Background()
+
+	if _, err := c.InsertOne(ctx, bson.M{"_id": "1", "content": "old", "x": 1}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := r.Replace(&mocks.Model{ID: "1", Content: "new"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	var doc bson.M
+	if err := c.FindOne(ctx, bson.M{"_id": "1"}).Decode(&doc); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if _, ok := doc["x"]; ok {
+		t.Error("the leftover field should be removed:", doc)
+	}
+	if doc["content"] != "new" {
+		t.Error("the document should be replaced:", doc)
+	}
+
+	// Replacing a missing entity inserts it.
+	if err := r.Replace(&mocks.Model{ID: "2"}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := r.FindById(string(mocks.ModelType), "2"); err != nil {
+		t.Error("the entity should be inserted:", err)
+	}
+}
+
+func TestRepoSlowQueryThreshold(t *testing.T) {
+	r, err := NewRepo("mongodb://localhost:1", "test")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer r.Close()
+	r.SetEntityFactory(func() eventbus.Data {
+		return &mocks.Model{}
+	})
+
+	type call struct {
+		op, ns string
+		dur    time.Duration
+	}
+	var calls []call
+	r.SetSlowQueryThreshold(0, func(op, ns string, dur time.Duration) {
+		calls = append(calls, call{op, ns, dur})
+	})
+
+	delayed := func(context.Context, *mongo.Collection) (*mongo.Cursor, error) {
+		time.Sleep(10 * time.Millisecond)
+		return mongo.NewCursorFromDocuments(nil, nil, nil)
+	}
+	if _, err := r.FindCustom("Model", delayed); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(calls) != 1 {
+		t.Fatal("the callback should be called once:", calls)
+	}
+	if c := calls[0]; c.op != "FindCustom" || c.ns != "Model" || c.dur < 10*time.Millisecond {
+		t.Errorf("the callback should get the timing of the operation: %+v", c)
+	}
+
+	// Faster operations are not logged.
+	r.SetSlowQueryThreshold(time.Hour, func(op, ns string, dur time.Duration) {
+		calls = append(calls, call{op, ns, dur})
+	})
+	if _, err := r.FindCustom("Model", delayed); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(calls) != 1 {
+		t.Error("the callback should not be called:", calls)
+	}
+}
+
+func TestRepoRename(t *testing.T) {
+	r := newTestRepo(t)
+
+	if err := r.Save(&mocks.Model{ID: "1", Content: "content"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := r.Rename("Model", "Model_v2", false); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if n, err := r.Count("Model"); err != nil || n != 0 {
+		t.Error("the old collection should be gone:", n, err)
+	}
+	entity, err := r.FindById("Model_v2", "1")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if m := entity.(*mocks.Model); m.Content != "content" {
+		t.Errorf("the entity should be correct: %+v", m)
+	}
+
+	// An existing target is only replaced with dropTarget.
+	if err := r.Save(&mocks.Model{ID: "2"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := r.Rename("Model", "Model_v2", false); err == nil {
+		t.Error("there should be an error")
+	} else if _, ok := err.(repo.RepoError); !ok {
+		t.Error("the error should be a repo error:", err)
+	}
+	if err := r.Rename("Model", "Model_v2", true); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := r.FindById("Model_v2", "2"); err != nil {
+		t.Error("the renamed entity should be found:", err)
+	}
+}
+
+func TestRepoAutoVersion(t *testing.T) {
+	r := newTestRepo(t)
+	r.SetAutoVersion(true)
+	c := r.collection(string(mocks.ModelType))
+
+	version := func() interface{} {
+		var doc bson.M
+		if err := c.FindOne(context.Background(), bson.M{"_id": "1"}).Decode(&doc); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+		return doc["_version"]
+	}
+
+	m := &mocks.Model{ID: "1"}
+	for i := 1; i <= 3; i++ {
+		if err := r.Save(m); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+		if v := version(); v != int32(i) {
+			t.Error("the version should be incremented:", i, v)
+		}
+	}
+
+	r.SetAutoVersion(false)
+	if err := r.Save(m); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if v := version(); v != int32(3) {
+		t.Error("the version should not be changed:", v)
+	}
+}
+
+func TestFindError(t *testing.T) {
+	otherErr := errors.New("other")
+	testCases := map[string]struct {
+		err      error
+		expected error
+		baseErr  bool
+	}{
+		"not found": {
+			mongo.ErrNoDocuments, repo.ErrEntityNotFound, true,
+		},
+		"context timeout": {
+			context.DeadlineExceeded, repo.ErrQueryTimeout, true,
+		},
+		"server timeout": {
+			mongo.CommandError{Code: 50, Name: "MaxTimeMSExpired"}, repo.ErrQueryTimeout, true,
+		},
+		"network": {
+			mongo.CommandError{Labels: []string{"NetworkError"}}, repo.ErrConnectionLost, true,
+		},
+		"other": {
+			otherErr, otherErr, false,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err, ok := findError(tc.err).(repo.RepoError)
+			if !ok || err.Err != tc.expected {
+				t.Error("the error should be classified:", err)
+			}
+			if tc.baseErr && !reflect.DeepEqual(err.BaseErr, tc.err) {
+				t.Error("the driver error should be the base error:", err.BaseErr)
+			}
+		})
+	}
+}
+
+func TestRepoContextCancel(t *testing.T) {
+	r, err := NewRepo("mongodb://localhost:1", "test")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer r.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = r.ClearContext(ctx, "Model")
+	if rrErr, ok := err.(repo.RepoError); !ok || rrErr.Err != ErrCouldNotClearDB || !errors.Is(rrErr.BaseErr, context.Canceled) {
+		t.Error("there should be a cancellation error:", err)
+	}
+
+	err = r.CollectionContext(ctx, "Model", func(ctx context.Context, c *mongo.Collection) error {
+		_, err := c.CountDocuments(ctx, bson.M{})
+		return err
+	})
+	if rrErr, ok := err.(repo.RepoError); !ok || !errors.Is(rrErr.Err, context.Canceled) {
+		t.Error("there should be a cancellation error:", err)
+	}
+}
+
+func TestRepoFindOneAndRemove(t *testing.T) {
+	r := newTestRepo(t)
+	ns := string(mocks.ModelType)
+
+	if _, err := r.FindOneAndRemove(ns, nil); !isNotFound(err) {
+		t.Error("there should be a not found error:", err)
+	}
+
+	const n = 20
+	for i := 0; i < n; i++ {
+		if err := r.Save(&mocks.Model{ID: eventbus.DataId(fmt.Sprint(i)), Content: "queued"}); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+
+	// Workers race to claim the entities until the queue is empty.
+	var (
+		mu      sync.Mutex
+		claimed = map[eventbus.DataId]int{}
+		wg      sync.WaitGroup
+	)
+	for w := 0; w < 5; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				entity, err := r.FindOneAndRemove(ns, bson.M{"content": "queued"})
+				if isNotFound(err) {
+					return
+				} else if err != nil {
+					t.Error("there should be no error:", err)
+					return
+				}
+				mu.Lock()
+				claimed[entity.Id()]++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(claimed) != n {
+		t.Error("all entities should be claimed:", len(claimed))
+	}
+	for id, c := range claimed {
+		if c != 1 {
+			t.Error("the entity should be claimed once:", id, c)
+		}
+	}
+	if n, err := r.Count(ns); err != nil || n != 0 {
+		t.Error("all entities should be removed:", n, err)
+	}
+}
+
+func TestRepoMaxResults(t *testing.T) {
+	r := newTestRepo(t)
+	r.SetMaxResults(100)
+	ns := string(mocks.ModelType)
+
+	datas := []eventbus.Data{}
+	for i := 0; i < 100; i++ {
+		datas = append(datas, &mocks.Model{ID: eventbus.DataId(fmt.Sprint(i))})
+	}
+	if err := r.SaveAll(datas); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if entities, err := r.FindAll(ns); err != nil || len(entities) != 100 {
+		t.Error("all entities should be found:", len(entities), err)
+	}
+
+	if err := r.Save(&mocks.Model{ID: "100"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if _, err := r.FindAll(ns); err == nil || err.(repo.RepoError).Err != ErrResultSetTooLarge {
+		t.Error("there should be a result set too large error:", err)
+	}
+
+	r.SetMaxResults(0)
+	if entities, err := r.FindAll(ns); err != nil || len(entities) != 101 {
+		t.Error("all entities should be found without a max:", len(entities), err)
+	}
+}
+
+func TestRepoFindOrCreate(t *testing.T) {
+	r := newTestRepo(t)
+
+	m := &mocks.Model{ID: "1"}
+	var (
+		mu      sync.Mutex
+		created int
+		wg      sync.WaitGroup
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			entity, ok, err := r.FindOrCreate(m, func() eventbus.Data {
+				return &mocks.Model{ID: "1", Content: fmt.Sprint(i)}
+			})
+			if err != nil {
+				t.Error("there should be no error:", err)
+				return
+			}
+			if entity.Id() != "1" {
+				t.Error("the entity should be returned:", entity)
+			}
+			if ok {
+				mu.Lock()
+				created++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if created != 1 {
+		t.Error("the entity should be created once:", created)
+	}
+	if n, err := r.Count(string(mocks.ModelType)); err != nil || n != 1 {
+		t.Error("there should be one entity:", n, err)
+	}
+
+	// An existing entity is returned without calling create.
+	entity, ok, err := r.FindOrCreate(m, func() eventbus.Data {
+		t.Error("create should not be called")
+		return nil
+	})
+	if err != nil || ok || entity.Id() != "1" {
+		t.Error("the existing entity should be found:", entity, ok, err)
+	}
+}
+
+func TestRepoFindAllIter(t *testing.T) {
+	r := newTestRepo(t)
+	ns := string(mocks.ModelType)
+	ctx := context.Background()
+
+	for _, id := range []eventbus.DataId{"3", "1", "2"} {
+		if err := r.Save(&mocks.Model{ID: id}); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+
+	i, err := r.FindAllIter(ns)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	ids := []eventbus.DataId{}
+	for i.Next(ctx) {
+		ids = append(ids, i.Value().(eventbus.Data).Id())
+	}
+	if err := i.Close(ctx); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(ids, []eventbus.DataId{"1", "2", "3"}) {
+		t.Error("the entities should be iterated in ID order:", ids)
+	}
+
+	// Closing stops the iteration.
+	i, err = r.FindAllIter(ns)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if !i.Next(ctx) {
+		t.Fatal("there should be an entity")
+	}
+	if err := i.Close(ctx); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if i.Next(ctx) {
+		t.Error("there should be no entities after Close")
+	}
+}
+
+func TestRepoSaveWithoutIdField(t *testing.T) {
+	r := newTestRepo(t)
+	r.RegisterFactory("TaggedIdModel", func() eventbus.Data {
+		return &taggedIdModel{}
+	})
+
+	for _, content := range []string{"a", "b"} {
+		if err := r.Save(&taggedIdModel{ID: "1", Content: content}); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+
+	docs, err := r.FindRaw("TaggedIdModel", nil)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(docs) != 1 || docs[0]["_id"] != "1" || docs[0]["content"] != "b" {
+		t.Error("there should be one document with the ID of the entity:", docs)
+	}
+	if entity, err := r.FindById("TaggedIdModel", "1"); err != nil || entity.(*taggedIdModel).Content != "b" {
+		t.Error("the entity should be found by its ID:", entity, err)
+	}
+}
+
+func TestRepoServerVersion(t *testing.T) {
+	r := newTestRepo(t)
+
+	version, err := r.ServerVersion()
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if !regexp.MustCompile(`^\d+\.\d+\.\d+`).MatchString(version) {
+		t.Error("the version should be a semantic version:", version)
+	}
+}
+
+func TestRepoRemoveIfExists(t *testing.T) {
+	r := newTestRepo(t)
+
+	m := &mocks.Model{ID: "1"}
+	if removed, err := r.RemoveIfExists(m); err != nil || removed {
+		t.Error("there should be nothing removed:", removed, err)
+	}
+	if err := r.Save(m); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if removed, err := r.RemoveIfExists(m); err != nil || !removed {
+		t.Error("the entity should be removed:", removed, err)
+	}
+}
+
+func TestMergeUnknown(t *testing.T) {
+	doc := bson.M{
+		"content": "new",
+		"nested":  bson.M{"a": 1},
+		"value":   2,
+	}
+	stored := bson.M{
+		"content": "old",
+		"extra":   "kept",
+		"nested":  bson.M{"a": 0, "b": 2},
+		"value":   bson.M{"a": 0},
+	}
+	mergeUnknown(doc, stored)
+
+	expected := bson.M{
+		"content": "new",
+		"extra":   "kept",
+		"nested":  bson.M{"a": 1, "b": 2},
+		"value":   2,
+	}
+	if !reflect.DeepEqual(doc, expected) {
+		t.Error("the unknown fields should be merged:", doc)
+	}
+}
+
+func TestRepoPreserveUnknownFields(t *testing.T) {
+	r := newTestRepo(t)
+	r.SetPreserveUnknownFields(true)
+	c := r.collection(string(mocks.ModelType))
+	ctx := context.Background()
+
+	if _, err := c.InsertOne(ctx, bson.M{"_id": "1", "content": "old", "extra": "kept"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := r.Save(&mocks.Model{ID: "1", Content: "new"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	var doc bson.M
+	if err := c.FindOne(ctx, bson.M{"_id": "1"}).Decode(&doc); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if doc["extra"] != "kept" || doc["content"] != "new" {
+		t.Error("the unknown field should be preserved:", doc)
+	}
+}
+
+func TestRepoSaveWithResult(t *testing.T) {
+	r := newTestRepo(t)
+
+	res, err := r.SaveWithResult(&mocks.Model{ID: "1", Content: "old"})
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if res.UpsertedCount != 1 || res.MatchedCount != 0 {
+		t.Error("the first save should upsert:", res)
+	}
+
+	res, err = r.SaveWithResult(&mocks.Model{ID: "1", Content: "new"})
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if res.UpsertedCount != 0 || res.MatchedCount != 1 || res.ModifiedCount != 1 {
+		t.Error("the second save should modify:", res)
+	}
+}
+
+func TestRepoFindCustomInto(t *testing.T) {
+	r := newTestOrders(t)
+
+	var orders []*Order
+	if err := r.FindCustomInto("Order", func(ctx context.Context, c *mongo.Collection) (*mongo.Cursor, error) {
+		return c.Find(ctx, bson.M{"customer": "a"}, options.Find().SetSort(bson.M{"total": 1}))
+	}, &orders); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(orders) != 2 || *orders[0] != (Order{ID: "3", Customer: "a", Total: 20}) || *orders[1] != (Order{ID: "1", Customer: "a", Total: 30}) {
+		t.Error("the orders should be decoded:", orders)
+	}
+
+	if err := r.FindCustomInto("Order", func(ctx context.Context, c *mongo.Collection) (*mongo.Cursor, error) {
+		return nil, nil
+	}, &orders); err == nil || err.(repo.RepoError).Err != ErrInvalidQuery {
+		t.Error("there should be an invalid query error:", err)
+	}
+}
+
+func TestRepoFindCustomIntoInvalid(t *testing.T) {
+	// The output is checked before the query, no server is needed.
+	r, err := NewRepo("mongodb://localhost:1", "test")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer r.Close()
+
+	var orders []*Order
+	if err := r.FindCustomInto("Order", func(ctx context.Context, c *mongo.Collection) (*mongo.Cursor, error) {
+		t.Error("the query should not run")
+		return nil, nil
+	}, orders); err == nil || err.(repo.RepoError).Err != ErrInvalidResult {
+		t.Error("there should be an invalid result error:", err)
+	}
+}
+
+func TestRepoFindAllIterCloseCancelled(t *testing.T) {
+	// The cursors killed on the server.
+	var mu sync.Mutex
+	killed := 0
+	monitor := &event.CommandMonitor{
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			if e.CommandName == "killCursors" {
+				killed++
+			}
+		},
+	}
+	r := newTestRepo(t, func(opts *options.ClientOptions) {
+		opts.SetMonitor(monitor)
+	})
+	r.SetCursorBatchSize(2)
+	ns := string(mocks.ModelType)
+
+	for i := 0; i < 5; i++ {
+		if err := r.Save(&mocks.Model{ID: eventbus.DataId(fmt.Sprint(i))}); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+
+	i, err := r.FindAllIter(ns)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if !i.Next(ctx) {
+		t.Fatal("there should be a value")
+	}
+
+	// The stream is cancelled with the cursor still open on the server.
+	cancel()
+	if err := i.Close(ctx); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if killed != 1 {
+		t.Error("the cursor should be closed on the server:", killed)
+	}
+}
+
+func TestRepoCopyCollection(t *testing.T) {
+	r := newTestOrders(t)
+
+	if n, err := r.CopyCollection("Order", "OrderCopy", false); err != nil || n != 4 {
+		t.Fatal("all orders should be copied:", n, err)
+	}
+	if n, err := r.Count("OrderCopy"); err != nil || n != 4 {
+		t.Error("the copy should have all orders:", n, err)
+	}
+
+	// The target is replaced without merge.
+	extra := &Order{ID: "5", Customer: "c", Total: 50}
+	if _, err := r.collection("OrderCopy").InsertOne(context.Background(), extra); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if _, err := r.CopyCollection("Order", "OrderCopy", false); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if n, err := r.Count("OrderCopy"); err != nil || n != 4 {
+		t.Error("the copy should be replaced:", n, err)
+	}
+
+	// The documents are merged into the target with merge.
+	if _, err := r.collection("OrderCopy").InsertOne(context.Background(), extra); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if n, err := r.CopyCollection("Order", "OrderCopy", true); err != nil || n != 5 {
+		t.Fatal("the documents of the target should be counted:", n, err)
+	}
+	if n, err := r.Count("OrderCopy"); err != nil || n != 5 {
+		t.Error("the orders should be merged into the copy:", n, err)
+	}
+}
+
+func TestRepoInsert(t *testing.T) {
+	r := newTestRepo(t)
+	ns := string(mocks.ModelType)
+
+	if err := r.Insert(&mocks.Model{ID: "1", Content: "first"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	err := r.Insert(&mocks.Model{ID: "1", Content: "second"})
+	if rrErr, ok := err.(repo.RepoError); !ok || rrErr.Err != repo.ErrConflict {
+		t.Error("there should be a conflict error:", err)
+	}
+	if entity, err := r.FindById(ns, "1"); err != nil || entity.(*mocks.Model).Content != "first" {
+		t.Error("the entity should not be changed:", entity, err)
+	}
+}
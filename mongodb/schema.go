@@ -0,0 +1,69 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"github.com/jeek120/repo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// namespaceNotFound is the server error code of a missing collection.
+const namespaceNotFound = 26
+
+// SetCollectionValidator sets a $jsonSchema validator on the collection of the
+// namespace, creating the collection if needed. Writes of documents that do not
+// match the schema are rejected by the server.
+func (r *Repo) SetCollectionValidator(ns string, schema bson.M) error {
+	validator := bson.M{"$jsonSchema": schema}
+	db := r.getClient().Database(r.db)
+	ctx := context.Background()
+
+	err := db.RunCommand(ctx, bson.D{
+		{Key: "collMod", Value: ns},
+		{Key: "validator", Value: validator},
+	}).Err()
+	var se mongo.ServerError
+	if errors.As(err, &se) && se.HasErrorCode(namespaceNotFound) {
+		err = db.CreateCollection(ctx, ns, options.CreateCollection().SetValidator(validator))
+	}
+	if err != nil {
+		return repo.RepoError{
+			Err: err,
+		}
+	}
+
+	return nil
+}
+
+// GetCollectionValidator returns the $jsonSchema validator of the collection of
+// the namespace, or nil if it has none. ErrEntityNotFound is returned if the
+// collection does not exist.
+func (r *Repo) GetCollectionValidator(ns string) (bson.M, error) {
+	db := r.getClient().Database(r.db)
+	specs, err := db.ListCollectionSpecifications(context.Background(), bson.M{"name": ns})
+	if err != nil {
+		return nil, repo.RepoError{
+			Err: err,
+		}
+	}
+	if len(specs) == 0 {
+		return nil, repo.RepoError{
+			Err: repo.ErrEntityNotFound,
+		}
+	}
+
+	var opts struct {
+		Validator struct {
+			Schema bson.M `bson:"$jsonSchema"`
+		} `bson:"validator"`
+	}
+	if err := bson.Unmarshal(specs[0].Options, &opts); err != nil {
+		return nil, repo.RepoError{
+			Err: err,
+		}
+	}
+
+	return opts.Validator.Schema, nil
+}
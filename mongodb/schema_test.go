@@ -0,0 +1,52 @@
+package mongodb
+
+import (
+	"github.com/jeek120/repo"
+	"github.com/jeek120/repo/mocks"
+	"go.mongodb.org/mongo-driver/bson"
+	"testing"
+)
+
+func TestRepoCollectionValidator(t *testing.T) {
+	r := newTestRepo(t)
+	ns := string(mocks.ModelType)
+
+	if _, err := r.GetCollectionValidator(ns); !isNotFound(err) {
+		t.Error("there should be a not found error:", err)
+	}
+
+	// The collection is created with the validator.
+	schema := bson.M{
+		"bsonType": "object",
+		"required": bson.A{"content"},
+		"properties": bson.M{
+			"content": bson.M{"bsonType": "string", "minLength": 1},
+		},
+	}
+	if err := r.SetCollectionValidator(ns, schema); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	got, err := r.GetCollectionValidator(ns)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if req, ok := got["required"].(bson.A); !ok || len(req) != 1 || req[0] != "content" {
+		t.Error("the validator should be read back:", got)
+	}
+
+	if err := r.Save(&mocks.Model{ID: "1", Content: "content"}); err != nil {
+		t.Error("a conforming document should be saved:", err)
+	}
+	err = r.Save(&mocks.Model{ID: "2"})
+	if _, ok := err.(repo.RepoError); !ok {
+		t.Error("a non-conforming document should be rejected:", err)
+	}
+
+	// The validator of an existing collection is replaced.
+	if err := r.SetCollectionValidator(ns, bson.M{"bsonType": "object"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := r.Save(&mocks.Model{ID: "2"}); err != nil {
+		t.Error("the document should be saved with the new validator:", err)
+	}
+}
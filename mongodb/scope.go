@@ -0,0 +1,125 @@
+package mongodb
+
+import (
+	"context"
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"time"
+)
+
+// Scope returns a view of the repo where all operations only see the documents
+// with the field set to the value, for example the documents of a tenant. The
+// scope is part of every query, so other documents are never loaded. Saves
+// match on both the ID and the field, a document with the same ID outside of
+// the scope is not overwritten and the save fails with ErrConflict instead.
+// Documents outside of the scope are not found by reads and removes.
+func (r *Repo) Scope(field string, value interface{}) repo.ReadWriteRepo {
+	return &scoped{
+		r:     r,
+		scope: bson.M{field: value},
+	}
+}
+
+type scoped struct {
+	r     *Repo
+	scope bson.M
+}
+
+// filter returns the filter merged with the scope.
+func (s *scoped) filter(filter bson.M) bson.M {
+	for k, v := range s.scope {
+		filter[k] = v
+	}
+	return filter
+}
+
+// Parent implements the Parent method of the eventhorizon.ReadRepo interface.
+func (s *scoped) Parent() repo.ReadRepo {
+	return s.r
+}
+
+// Find implements the Find method of the eventhorizon.ReadRepo interface.
+func (s *scoped) Find(data eventbus.Data) (eventbus.Data, error) {
+	return s.FindById(string(data.DataType()), data.Id())
+}
+
+// FindById implements the FindById method of the eventhorizon.ReadRepo interface.
+func (s *scoped) FindById(ns string, id eventbus.DataId) (eventbus.Data, error) {
+	defer s.r.trackSlow("FindById", ns, time.Now())
+
+	factoryFn, err := s.r.factory(ns)
+	if err != nil {
+		return nil, err
+	}
+
+	c := s.r.collection(ns)
+
+	return s.r.findOne(&s.r.metrics.finds, c.FindOne(context.Background(), s.filter(bson.M{"_id": string(id)})), factoryFn)
+}
+
+// FindByIds implements the FindByIds method of the eventhorizon.ReadRepo interface.
+func (s *scoped) FindByIds(ns string, ids []eventbus.DataId) ([]eventbus.Data, error) {
+	in := make([]string, len(ids))
+	for i, id := range ids {
+		in[i] = string(id)
+	}
+
+	return s.find("FindByIds", ns, s.filter(bson.M{"_id": bson.M{"$in": in}}))
+}
+
+// FindAll implements the FindAll method of the eventhorizon.ReadRepo interface.
+func (s *scoped) FindAll(ns string) ([]eventbus.Data, error) {
+	return s.find("FindAll", ns, s.filter(bson.M{}))
+}
+
+func (s *scoped) find(op, ns string, filter bson.M) ([]eventbus.Data, error) {
+	defer s.r.trackSlow(op, ns, time.Now())
+
+	factoryFn, err := s.r.factory(ns)
+	if err != nil {
+		return nil, err
+	}
+
+	c := s.r.collection(ns)
+	ctx := context.Background()
+	find := func() (*mongo.Cursor, error) {
+		return c.Find(ctx, filter, s.r.FindOptions())
+	}
+
+	result := []eventbus.Data{}
+	if err := s.r.findEach(ctx, find, factoryFn, func(entity eventbus.Data) error {
+		result = append(result, entity)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// FindAllIter implements the FindAllIter method of the eventhorizon.ReadRepo interface.
+func (s *scoped) FindAllIter(ns string) (repo.Iter, error) {
+	return s.r.findAllIter(ns, s.scope)
+}
+
+// Count implements the Count method of the eventhorizon.ReadRepo interface.
+func (s *scoped) Count(ns string) (int64, error) {
+	return s.r.CountFiltered(ns, s.filter(bson.M{}))
+}
+
+// Save implements the Save method of the eventhorizon.WriteRepo interface.
+func (s *scoped) Save(data eventbus.Data) error {
+	defer s.r.trackSlow("Save", string(data.DataType()), time.Now())
+
+	_, err := s.r.save(context.Background(), data, s.scope)
+	return err
+}
+
+// Remove implements the Remove method of the eventhorizon.WriteRepo interface.
+func (s *scoped) Remove(data eventbus.Data) error {
+	defer s.r.trackSlow("Remove", string(data.DataType()), time.Now())
+
+	return s.r.remove(context.Background(), data, s.scope)
+}
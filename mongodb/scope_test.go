@@ -0,0 +1,81 @@
+package mongodb
+
+import (
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo"
+	"sync"
+	"testing"
+)
+
+type tenantModel struct {
+	ID      eventbus.DataId `bson:"_id"`
+	Tenant  string          `bson:"_tenant"`
+	Content string          `bson:"content"`
+}
+
+func (m *tenantModel) Id() eventbus.DataId         { return m.ID }
+func (m *tenantModel) DataType() eventbus.DataType { return "TenantModel" }
+
+func TestRepoScope(t *testing.T) {
+	r := newTestRepo(t)
+	r.RegisterFactory("TenantModel", func() eventbus.Data {
+		return &tenantModel{}
+	})
+	a := r.Scope("_tenant", "a")
+	b := r.Scope("_tenant", "b")
+
+	if err := a.Save(&tenantModel{ID: "1", Tenant: "a", Content: "a"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := b.Save(&tenantModel{ID: "2", Tenant: "b", Content: "b"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	if _, err := b.FindById("TenantModel", "1"); !isNotFound(err) {
+		t.Error("there should be a not found error:", err)
+	}
+	if entities, err := b.FindByIds("TenantModel", []eventbus.DataId{"1", "2"}); err != nil || len(entities) != 1 {
+		t.Error("only the entity of the scope should be found:", entities, err)
+	}
+	if entities, err := b.FindAll("TenantModel"); err != nil || len(entities) != 1 {
+		t.Error("only the entity of the scope should be listed:", entities, err)
+	}
+	if n, err := b.Count("TenantModel"); err != nil || n != 1 {
+		t.Error("only the entity of the scope should be counted:", n, err)
+	}
+	if err := b.Remove(&tenantModel{ID: "1"}); !isNotFound(err) {
+		t.Error("there should be a not found error:", err)
+	}
+
+	// Concurrent saves of the same ID by two scopes: one wins, the other
+	// conflicts, and the document is never overwritten across scopes.
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, s := range []repo.ReadWriteRepo{a, b} {
+		wg.Add(1)
+		go func(i int, s repo.ReadWriteRepo) {
+			defer wg.Done()
+			tenant := []string{"a", "b"}[i]
+			errs[i] = s.Save(&tenantModel{ID: "3", Tenant: tenant, Content: tenant})
+		}(i, s)
+	}
+	wg.Wait()
+	var conflicts int
+	for _, err := range errs {
+		if rrErr, ok := err.(repo.RepoError); ok && rrErr.Err == repo.ErrConflict {
+			conflicts++
+		} else if err != nil {
+			t.Error("there should be no other error:", err)
+		}
+	}
+	if conflicts != 1 {
+		t.Error("exactly one save should conflict:", errs)
+	}
+	entity, err := r.FindById("TenantModel", "3")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if m := entity.(*tenantModel); m.Tenant != m.Content {
+		t.Errorf("the entity should not be overwritten across scopes: %+v", m)
+	}
+}
@@ -0,0 +1,165 @@
+package mongodb
+
+import (
+	"context"
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"reflect"
+)
+
+// FindAllChan streams all entities in the namespace on the returned data
+// channel. A terminal error, including the cancellation of ctx, is sent on
+// the error channel. Both channels are closed when the stream ends.
+func (r *Repo) FindAllChan(ctx context.Context, ns string) (<-chan eventbus.Data, <-chan error, error) {
+	factoryFn, err := r.factory(ns)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c := r.collection(ns)
+	cursor, err := c.Find(ctx, bson.M{}, r.FindOptions())
+	if err != nil {
+		return nil, nil, findError(err)
+	}
+	i := &iter{
+		cursor:    cursor,
+		factoryFn: factoryFn,
+		decode:    r.decode,
+	}
+
+	dataCh := make(chan eventbus.Data)
+	errCh := make(chan error, 1)
+	go func() {
+		defer close(errCh)
+		defer close(dataCh)
+
+		for i.Next(ctx) {
+			select {
+			case dataCh <- i.Value().(eventbus.Data):
+			case <-ctx.Done():
+				i.Close(context.Background())
+				errCh <- repo.RepoError{
+					Err: ctx.Err(),
+				}
+				return
+			}
+		}
+
+		if err := i.Close(context.Background()); err != nil {
+			errCh <- findError(err)
+		} else if err := ctx.Err(); err != nil {
+			errCh <- repo.RepoError{
+				Err: err,
+			}
+		}
+	}()
+
+	return dataCh, errCh, nil
+}
+
+// ForEach calls fn with every entity in the namespace, streamed like
+// FindAllIter. It stops at the first error of fn and returns it. The cursor is
+// always closed.
+func (r *Repo) ForEach(ns string, fn func(eventbus.Data) error) error {
+	i, err := r.FindAllIter(ns)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	for i.Next(ctx) {
+		if err := fn(i.Value().(eventbus.Data)); err != nil {
+			i.Close(ctx)
+			return err
+		}
+	}
+
+	if err := i.Close(ctx); err != nil {
+		return findError(err)
+	}
+
+	return nil
+}
+
+// ForEachPooled is like ForEach but decodes every document into the same
+// entity, reset to its zero value in between, to save the allocation of an
+// entity per document. The entity must not be retained after fn returns.
+func (r *Repo) ForEachPooled(ns string, fn func(eventbus.Data) error) error {
+	factoryFn, err := r.factory(ns)
+	if err != nil {
+		return err
+	}
+
+	c := r.collection(ns)
+	ctx := context.Background()
+	cursor, err := c.Find(ctx, bson.M{}, r.FindOptions())
+	if err != nil {
+		return findError(err)
+	}
+	defer cursor.Close(ctx)
+
+	entity := factoryFn()
+	v := reflect.ValueOf(entity)
+	for cursor.Next(ctx) {
+		if v.Kind() == reflect.Ptr {
+			v.Elem().Set(reflect.Zero(v.Elem().Type()))
+		}
+		if err := r.decode(cursor, entity); err != nil {
+			return repo.RepoError{
+				Err: err,
+			}
+		}
+		if err := fn(entity); err != nil {
+			return err
+		}
+	}
+
+	if err := cursor.Err(); err != nil {
+		return findError(err)
+	}
+
+	return nil
+}
+
+// CheckpointIter is an iterator that can be resumed, returned by
+// FindCustomIterResume. The iterator of FindCustomIter implements it too.
+type CheckpointIter interface {
+	repo.Iter
+
+	// Checkpoint returns an opaque token to resume the iteration after the
+	// last entity returned by Next with FindCustomIterResume, or nil before
+	// the first entity.
+	Checkpoint() interface{}
+}
+
+// Checkpoint implements the Checkpoint method of the CheckpointIter interface.
+// The token is the ID of the last entity.
+func (i *iter) Checkpoint() interface{} {
+	if i.last == "" {
+		return nil
+	}
+	return string(i.last)
+}
+
+// FindCustomIterResume is like FindCustomIter but restarts an iteration from a
+// checkpoint, for example after a restart of a long export. The callback gets
+// a filter selecting the entities after the checkpoint, empty for a nil
+// checkpoint, which it must combine with its own filter. The query must be
+// sorted by ID for the checkpoint to be meaningful.
+func (r *Repo) FindCustomIterResume(tb string, checkpoint interface{}, f func(ctx context.Context, c *mongo.Collection, after bson.M) (*mongo.Cursor, error)) (CheckpointIter, error) {
+	after := bson.M{}
+	if checkpoint != nil {
+		after = bson.M{"_id": bson.M{"$gt": checkpoint}}
+	}
+
+	i, err := r.FindCustomIter(tb, func(ctx context.Context, c *mongo.Collection) (*mongo.Cursor, error) {
+		return f(ctx, c, after)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return i.(CheckpointIter), nil
+}
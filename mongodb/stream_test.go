@@ -0,0 +1,278 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo"
+	"github.com/jeek120/repo/mocks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRepoFindAllChan(t *testing.T) {
+	r := newTestRepo(t)
+	ns := string(mocks.ModelType)
+
+	for i := 0; i < 5; i++ {
+		if err := r.Save(&mocks.Model{ID: eventbus.DataId(fmt.Sprint(i))}); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+
+	dataCh, errCh, err := r.FindAllChan(context.Background(), ns)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	ids := map[eventbus.DataId]bool{}
+	for entity := range dataCh {
+		ids[entity.Id()] = true
+	}
+	if len(ids) != 5 {
+		t.Error("all entities should be streamed:", ids)
+	}
+	if err := <-errCh; err != nil {
+		t.Error("there should be no error:", err)
+	}
+}
+
+func TestRepoFindAllChanCancel(t *testing.T) {
+	r := newTestRepo(t)
+	r.SetCursorBatchSize(2)
+	ns := string(mocks.ModelType)
+
+	for i := 0; i < 10; i++ {
+		if err := r.Save(&mocks.Model{ID: eventbus.DataId(fmt.Sprint(i))}); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dataCh, errCh, err := r.FindAllChan(ctx, ns)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if _, ok := <-dataCh; !ok {
+		t.Fatal("an entity should be streamed")
+	}
+	cancel()
+
+	err = <-errCh
+	if rrErr, ok := err.(repo.RepoError); !ok || !errors.Is(rrErr.Err, context.Canceled) {
+		t.Error("there should be a cancellation error:", err)
+	}
+	if _, ok := <-dataCh; ok {
+		t.Error("the data channel should be closed")
+	}
+}
+
+func TestRepoForEach(t *testing.T) {
+	// The commands sent to the server, to tell if the cursor is closed.
+	var mu sync.Mutex
+	var commands []string
+	monitor := &event.CommandMonitor{
+		Started: func(_ context.Context, e *event.CommandStartedEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			commands = append(commands, e.CommandName)
+		},
+	}
+	r := newTestRepo(t, func(opts *options.ClientOptions) {
+		opts.SetMonitor(monitor)
+	})
+	r.SetCursorBatchSize(2)
+	ns := string(mocks.ModelType)
+
+	for i := 0; i < 5; i++ {
+		if err := r.Save(&mocks.Model{ID: eventbus.DataId(fmt.Sprint(i))}); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+
+	n := 0
+	if err := r.ForEach(ns, func(eventbus.Data) error {
+		n++
+		return nil
+	}); err != nil || n != 5 {
+		t.Error("all entities should be visited:", n, err)
+	}
+
+	// An error of fn stops the iteration and closes the cursor.
+	mu.Lock()
+	commands = nil
+	mu.Unlock()
+	stopErr := errors.New("stop")
+	n = 0
+	if err := r.ForEach(ns, func(eventbus.Data) error {
+		n++
+		return stopErr
+	}); err != stopErr {
+		t.Error("the error of fn should be returned:", err)
+	}
+	if n != 1 {
+		t.Error("the iteration should stop at the error:", n)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(commands) == 0 || commands[len(commands)-1] != "killCursors" {
+		t.Error("the cursor should be closed:", commands)
+	}
+}
+
+func TestRepoForEachPooled(t *testing.T) {
+	r := newTestRepo(t)
+	ns := string(mocks.ModelType)
+
+	if err := r.Save(&mocks.Model{ID: "1", Content: "content"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := r.Save(&mocks.Model{ID: "2"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	// The same entity is reused and reset between documents.
+	var entities []eventbus.Data
+	contents := map[eventbus.DataId]string{}
+	if err := r.ForEachPooled(ns, func(entity eventbus.Data) error {
+		entities = append(entities, entity)
+		contents[entity.Id()] = entity.(*mocks.Model).Content
+		return nil
+	}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(entities) != 2 || entities[0] != entities[1] {
+		t.Error("the entity should be reused:", entities)
+	}
+	if contents["1"] != "content" || contents["2"] != "" {
+		t.Error("the entity should be reset between documents:", contents)
+	}
+}
+
+func newBenchRepo(b *testing.B) *Repo {
+	r := newTestRepo(b)
+	datas := []eventbus.Data{}
+	for i := 0; i < 1000; i++ {
+		datas = append(datas, &mocks.Model{ID: eventbus.DataId(fmt.Sprint(i)), Content: "content"})
+	}
+	if err := r.SaveAll(datas); err != nil {
+		b.Fatal("there should be no error:", err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	return r
+}
+
+func BenchmarkRepoFindAll(b *testing.B) {
+	r := newBenchRepo(b)
+	for i := 0; i < b.N; i++ {
+		entities, err := r.FindAll(string(mocks.ModelType))
+		if err != nil {
+			b.Fatal("there should be no error:", err)
+		}
+		for range entities {
+		}
+	}
+}
+
+func BenchmarkRepoForEachPooled(b *testing.B) {
+	r := newBenchRepo(b)
+	for i := 0; i < b.N; i++ {
+		if err := r.ForEachPooled(string(mocks.ModelType), func(eventbus.Data) error {
+			return nil
+		}); err != nil {
+			b.Fatal("there should be no error:", err)
+		}
+	}
+}
+
+func TestIterCheckpoint(t *testing.T) {
+	i := newTestIter(t, []interface{}{
+		bson.M{"_id": "1"},
+		bson.M{"_id": "2"},
+	}, nil)
+
+	if c := i.Checkpoint(); c != nil {
+		t.Error("there should be no checkpoint before the first entity:", c)
+	}
+	ctx := context.Background()
+	for _, want := range []string{"1", "2"} {
+		if !i.Next(ctx) {
+			t.Fatal("there should be a value")
+		}
+		if c := i.Checkpoint(); c != want {
+			t.Error("the checkpoint should be the last ID:", c)
+		}
+	}
+}
+
+func TestRepoFindCustomIterResume(t *testing.T) {
+	r := newTestOrders(t)
+	find := func(ctx context.Context, c *mongo.Collection, after bson.M) (*mongo.Cursor, error) {
+		return c.Find(ctx, after, options.Find().SetSort(bson.M{"_id": 1}))
+	}
+	ctx := context.Background()
+
+	// Stream half of the orders and stop.
+	i, err := r.FindCustomIterResume("Order", nil, find)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	var ids []eventbus.DataId
+	for len(ids) < 2 && i.Next(ctx) {
+		ids = append(ids, i.Value().(eventbus.Data).Id())
+	}
+	checkpoint := i.Checkpoint()
+	if err := i.Close(ctx); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	// Resume after the checkpoint.
+	i, err = r.FindCustomIterResume("Order", checkpoint, find)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	for i.Next(ctx) {
+		ids = append(ids, i.Value().(eventbus.Data).Id())
+	}
+	if err := i.Close(ctx); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if fmt.Sprint(ids) != "[1 2 3 4]" {
+		t.Error("all orders should be streamed once:", ids)
+	}
+}
+
+func TestRepoStreamErrors(t *testing.T) {
+	// No server answers, the queries fail with a server selection timeout.
+	r, err := NewRepo("mongodb://localhost:1", "test", WithServerSelectionTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer r.Close()
+	r.SetEntityFactory(func() eventbus.Data {
+		return &mocks.Model{}
+	})
+	ns := string(mocks.ModelType)
+
+	isTimeout := func(err error) bool {
+		rrErr, ok := err.(repo.RepoError)
+		return ok && rrErr.Err == repo.ErrQueryTimeout
+	}
+	if _, _, err := r.FindAllChan(context.Background(), ns); !isTimeout(err) {
+		t.Error("there should be a query timeout error:", err)
+	}
+	if err := r.ForEach(ns, func(eventbus.Data) error { return nil }); !isTimeout(err) {
+		t.Error("there should be a query timeout error:", err)
+	}
+	if err := r.ForEachPooled(ns, func(eventbus.Data) error { return nil }); !isTimeout(err) {
+		t.Error("there should be a query timeout error:", err)
+	}
+}
@@ -0,0 +1,39 @@
+package mongodb
+
+import (
+	"context"
+	"github.com/jeek120/eventbus"
+	"go.mongodb.org/mongo-driver/bson"
+	"reflect"
+	"time"
+)
+
+// FindByIdTyped returns the entity with the ID decoded directly into a T,
+// without the entity factory. T is typically a pointer to a struct, like
+// *User, but can also be a struct implementing eventbus.Data by value. Both are
+// decoded with the storage codec, if one is set. The zero T is returned with
+// the error if the entity is not found.
+func FindByIdTyped[T eventbus.Data](r *Repo, ns string, id eventbus.DataId) (T, error) {
+	defer r.trackSlow("FindByIdTyped", ns, time.Now())
+
+	// The document is decoded into a new struct for a pointer T, and into
+	// the T itself otherwise.
+	var entity T
+	var target eventbus.Data
+	if t := reflect.TypeOf(&entity).Elem(); t.Kind() == reflect.Ptr {
+		entity = reflect.New(t.Elem()).Interface().(T)
+		target = entity
+	} else {
+		target = any(&entity).(eventbus.Data)
+	}
+
+	res := r.collection(ns).FindOne(context.Background(), bson.M{"_id": string(id)})
+	if _, err := r.findOne(&r.metrics.finds, res, func() eventbus.Data {
+		return target
+	}); err != nil {
+		var zero T
+		return zero, err
+	}
+
+	return entity, nil
+}
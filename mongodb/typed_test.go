@@ -0,0 +1,90 @@
+package mongodb
+
+import (
+	"github.com/jeek120/eventbus"
+	"go.mongodb.org/mongo-driver/bson"
+	"strings"
+	"testing"
+)
+
+type User struct {
+	ID   eventbus.DataId `bson:"_id"`
+	Name string          `bson:"name"`
+}
+
+func (u *User) Id() eventbus.DataId         { return u.ID }
+func (u *User) DataType() eventbus.DataType { return "User" }
+
+// Account is an entity implementing eventbus.Data by value.
+type Account struct {
+	ID   eventbus.DataId `bson:"_id"`
+	Name string          `bson:"name"`
+}
+
+func (a Account) Id() eventbus.DataId         { return a.ID }
+func (a Account) DataType() eventbus.DataType { return "Account" }
+
+// prefixCodec stores the name field with a prefix, to tell if it was used.
+type prefixCodec struct {
+	BSONCodec
+}
+
+func (c prefixCodec) Encode(data eventbus.Data) (bson.M, error) {
+	doc, err := c.BSONCodec.Encode(data)
+	if err != nil {
+		return nil, err
+	}
+	doc["name"] = "codec:" + doc["name"].(string)
+	return doc, nil
+}
+
+func (c prefixCodec) Decode(doc bson.M, data eventbus.Data) error {
+	if name, ok := doc["name"].(string); ok {
+		doc["name"] = strings.TrimPrefix(name, "codec:")
+	}
+	return c.BSONCodec.Decode(doc, data)
+}
+
+func TestFindByIdTyped(t *testing.T) {
+	r := newTestRepo(t)
+
+	if err := r.Save(&User{ID: "1", Name: "user"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	user, err := FindByIdTyped[*User](r, "User", "1")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if user.Name != "user" {
+		t.Errorf("the user should be correct: %+v", user)
+	}
+
+	user, err = FindByIdTyped[*User](r, "User", "2")
+	if !isNotFound(err) {
+		t.Error("there should be a not found error:", err)
+	}
+	if user != nil {
+		t.Error("the user should be nil:", user)
+	}
+}
+
+func TestFindByIdTypedCodec(t *testing.T) {
+	r := newTestRepo(t)
+	r.SetStorageCodec(prefixCodec{})
+
+	if err := r.Save(&User{ID: "1", Name: "user"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := r.Save(Account{ID: "1", Name: "account"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	user, err := FindByIdTyped[*User](r, "User", "1")
+	if err != nil || user.Name != "user" {
+		t.Errorf("the pointer entity should be decoded with the codec: %+v %v", user, err)
+	}
+	account, err := FindByIdTyped[Account](r, "Account", "1")
+	if err != nil || account.Name != "account" {
+		t.Errorf("the value entity should be decoded with the codec: %+v %v", account, err)
+	}
+}
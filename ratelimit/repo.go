@@ -0,0 +1,156 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo"
+	"golang.org/x/time/rate"
+)
+
+// ErrRateLimited is when an operation is rejected by the rate limiter.
+var ErrRateLimited = errors.New("rate limited")
+
+// Repo is a middleware that limits the rate of operations on the wrapped repo.
+// Every operation takes a token from the limiter. By default operations wait
+// for a token, until the context set with WithContext is done; with fail fast
+// they fail with ErrRateLimited instead.
+type Repo struct {
+	repo.ReadWriteRepo
+	limiter  *rate.Limiter
+	failFast bool
+	ctx      context.Context
+}
+
+// NewRepo creates a new Repo.
+func NewRepo(repo repo.ReadWriteRepo, limiter *rate.Limiter) *Repo {
+	return &Repo{
+		ReadWriteRepo: repo,
+		limiter:       limiter,
+		ctx:           context.Background(),
+	}
+}
+
+// SetFailFast makes operations fail with ErrRateLimited when no token is
+// available, instead of waiting for one.
+func (r *Repo) SetFailFast(enabled bool) {
+	r.failFast = enabled
+}
+
+// WithContext returns a shallow copy of the repo that stops waiting for a
+// token when ctx is done. The limiter is shared with the copy.
+func (r *Repo) WithContext(ctx context.Context) *Repo {
+	r2 := *r
+	r2.ctx = ctx
+	return &r2
+}
+
+// Parent implements the Parent method of the eventhorizon.ReadRepo interface.
+func (r *Repo) Parent() repo.ReadRepo {
+	return r.ReadWriteRepo
+}
+
+// Find implements the Find method of the eventhorizon.ReadRepo interface.
+func (r *Repo) Find(data eventbus.Data) (eventbus.Data, error) {
+	if err := r.wait(); err != nil {
+		return nil, err
+	}
+
+	return r.ReadWriteRepo.Find(data)
+}
+
+// FindById implements the FindById method of the eventhorizon.ReadRepo interface.
+func (r *Repo) FindById(ns string, id eventbus.DataId) (eventbus.Data, error) {
+	if err := r.wait(); err != nil {
+		return nil, err
+	}
+
+	return r.ReadWriteRepo.FindById(ns, id)
+}
+
+// FindByIds implements the FindByIds method of the eventhorizon.ReadRepo interface.
+func (r *Repo) FindByIds(ns string, ids []eventbus.DataId) ([]eventbus.Data, error) {
+	if err := r.wait(); err != nil {
+		return nil, err
+	}
+
+	return r.ReadWriteRepo.FindByIds(ns, ids)
+}
+
+// FindAll implements the FindAll method of the eventhorizon.ReadRepo interface.
+func (r *Repo) FindAll(ns string) ([]eventbus.Data, error) {
+	if err := r.wait(); err != nil {
+		return nil, err
+	}
+
+	return r.ReadWriteRepo.FindAll(ns)
+}
+
+// FindAllIter implements the FindAllIter method of the eventhorizon.ReadRepo interface.
+func (r *Repo) FindAllIter(ns string) (repo.Iter, error) {
+	if err := r.wait(); err != nil {
+		return nil, err
+	}
+
+	return r.ReadWriteRepo.FindAllIter(ns)
+}
+
+// Count implements the Count method of the eventhorizon.ReadRepo interface.
+func (r *Repo) Count(ns string) (int64, error) {
+	if err := r.wait(); err != nil {
+		return 0, err
+	}
+
+	return r.ReadWriteRepo.Count(ns)
+}
+
+// Save implements the Save method of the eventhorizon.WriteRepo interface.
+func (r *Repo) Save(data eventbus.Data) error {
+	if err := r.wait(); err != nil {
+		return err
+	}
+
+	return r.ReadWriteRepo.Save(data)
+}
+
+// Remove implements the Remove method of the eventhorizon.WriteRepo interface.
+func (r *Repo) Remove(data eventbus.Data) error {
+	if err := r.wait(); err != nil {
+		return err
+	}
+
+	return r.ReadWriteRepo.Remove(data)
+}
+
+// wait takes a token from the limiter.
+func (r *Repo) wait() error {
+	if r.failFast {
+		if !r.limiter.Allow() {
+			return repo.RepoError{
+				Err: ErrRateLimited,
+			}
+		}
+		return nil
+	}
+
+	if err := r.limiter.Wait(r.ctx); err != nil {
+		return repo.RepoError{
+			Err:     ErrRateLimited,
+			BaseErr: err,
+		}
+	}
+	return nil
+}
+
+// Repository returns a parent ReadRepo if there is one.
+func Repository(repo repo.ReadRepo) *Repo {
+	if repo == nil {
+		return nil
+	}
+
+	if r, ok := repo.(*Repo); ok {
+		return r
+	}
+
+	return Repository(repo.Parent())
+}
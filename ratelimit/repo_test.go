@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/jeek120/repo"
+	"github.com/jeek120/repo/mocks"
+	"golang.org/x/time/rate"
+	"testing"
+	"time"
+)
+
+func isRateLimited(err error) bool {
+	rrErr, ok := err.(repo.RepoError)
+	return ok && rrErr.Err == ErrRateLimited
+}
+
+func TestRepoFailFast(t *testing.T) {
+	inner := mocks.NewRepo()
+	r := NewRepo(inner, rate.NewLimiter(rate.Every(time.Hour), 2))
+	r.SetFailFast(true)
+	ns := string(mocks.ModelType)
+
+	if err := r.Save(&mocks.Model{ID: "1"}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := r.FindById(ns, "1"); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := r.FindAll(ns); !isRateLimited(err) {
+		t.Error("there should be a rate limited error:", err)
+	}
+	if err := r.Remove(&mocks.Model{ID: "1"}); !isRateLimited(err) {
+		t.Error("there should be a rate limited error:", err)
+	}
+	if inner.Calls("FindAll") != 0 || inner.Calls("Remove") != 0 {
+		t.Error("the rejected calls should not reach the inner repo")
+	}
+
+	if r.Parent() != inner {
+		t.Error("the parent should be the inner repo")
+	}
+}
+
+func TestRepoWait(t *testing.T) {
+	inner := mocks.NewRepo()
+	r := NewRepo(inner, rate.NewLimiter(rate.Every(50*time.Millisecond), 1))
+	ns := string(mocks.ModelType)
+
+	// The calls are throttled to the rate.
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := r.Count(ns); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+	if d := time.Since(start); d < 90*time.Millisecond {
+		t.Error("the calls should be throttled:", d)
+	}
+
+	// Waiting stops when the context is done.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := r.WithContext(ctx).Count(ns); !isRateLimited(err) || err.(repo.RepoError).BaseErr == nil {
+		t.Error("there should be a rate limited error with the context error:", err)
+	}
+	if n := inner.Calls("Count"); n != 3 {
+		t.Error("the cancelled call should not reach the inner repo:", n)
+	}
+}
@@ -0,0 +1,301 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo"
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrCouldNotDialDB is when the database could not be dialed.
+var ErrCouldNotDialDB = errors.New("could not dial database")
+
+// ErrNoDBClient is when no database client is set.
+var ErrNoDBClient = errors.New("no database client")
+
+// ErrCouldNotClearDB is when the database could not be cleared.
+var ErrCouldNotClearDB = errors.New("could not clear database")
+
+// ErrModelNotSet is when an model factory is not set on the Repo.
+var ErrModelNotSet = errors.New("model not set")
+
+// Repo implements a Redis repository for entities. Entities are stored as
+// JSON under "{ns}:id:<id>" keys, and the IDs of each namespace are kept in a
+// set under the "{ns}:ids" key. The namespace is the hash tag of the keys, so
+// that all keys of a namespace are in the same slot of a Redis Cluster. A
+// namespace must not contain braces.
+type Repo struct {
+	client    redis.UniversalClient
+	factoryFn func() eventbus.Data
+}
+
+// NewRepo creates a new Repo.
+func NewRepo(addr string) (*Repo, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr: addr,
+	})
+	if err := client.Ping(context.TODO()).Err(); err != nil {
+		return nil, ErrCouldNotDialDB
+	}
+
+	return NewRepoWithClient(client)
+}
+
+// NewRepoWithClient creates a new Repo with a client.
+func NewRepoWithClient(client redis.UniversalClient) (*Repo, error) {
+	if client == nil {
+		return nil, ErrNoDBClient
+	}
+
+	r := &Repo{
+		client: client,
+	}
+
+	return r, nil
+}
+
+// key returns the key of an entity.
+func key(ns string, id eventbus.DataId) string {
+	return "{" + ns + "}:id:" + string(id)
+}
+
+// idsKey returns the key of the set of the IDs of a namespace.
+func idsKey(ns string) string {
+	return "{" + ns + "}:ids"
+}
+
+// Parent implements the Parent method of the eventhorizon.ReadRepo interface.
+func (r *Repo) Parent() repo.ReadRepo {
+	return nil
+}
+
+// Find implements the Find method of the eventhorizon.ReadRepo interface.
+func (r *Repo) Find(data eventbus.Data) (eventbus.Data, error) {
+	return r.FindById(string(data.DataType()), data.Id())
+}
+
+// FindById implements the FindById method of the eventhorizon.ReadRepo interface.
+func (r *Repo) FindById(ns string, id eventbus.DataId) (eventbus.Data, error) {
+	if r.factoryFn == nil {
+		return nil, repo.RepoError{
+			Err: ErrModelNotSet,
+		}
+	}
+
+	b, err := r.client.Get(context.Background(), key(ns, id)).Bytes()
+	if err == redis.Nil {
+		return nil, repo.RepoError{
+			Err:     repo.ErrEntityNotFound,
+			BaseErr: err,
+		}
+	} else if err != nil {
+		return nil, repo.RepoError{
+			Err: err,
+		}
+	}
+
+	entity := r.factoryFn()
+	if err := json.Unmarshal(b, entity); err != nil {
+		return nil, repo.RepoError{
+			Err: err,
+		}
+	}
+
+	return entity, nil
+}
+
+// FindByIds implements the FindByIds method of the eventhorizon.ReadRepo interface.
+func (r *Repo) FindByIds(ns string, ids []eventbus.DataId) ([]eventbus.Data, error) {
+	if r.factoryFn == nil {
+		return nil, repo.RepoError{
+			Err: ErrModelNotSet,
+		}
+	}
+
+	return r.mget(ns, ids)
+}
+
+// FindAll implements the FindAll method of the eventhorizon.ReadRepo interface.
+func (r *Repo) FindAll(ns string) ([]eventbus.Data, error) {
+	if r.factoryFn == nil {
+		return nil, repo.RepoError{
+			Err: ErrModelNotSet,
+		}
+	}
+
+	members, err := r.client.SMembers(context.Background(), idsKey(ns)).Result()
+	if err != nil {
+		return nil, repo.RepoError{
+			Err: err,
+		}
+	}
+
+	ids := make([]eventbus.DataId, len(members))
+	for i, id := range members {
+		ids[i] = eventbus.DataId(id)
+	}
+
+	return r.mget(ns, ids)
+}
+
+// FindAllIter implements the FindAllIter method of the eventhorizon.ReadRepo
+// interface. The entities are loaded with FindAll.
+func (r *Repo) FindAllIter(ns string) (repo.Iter, error) {
+	entities, err := r.FindAll(ns)
+	if err != nil {
+		return nil, err
+	}
+
+	return repo.NewSliceIter(entities), nil
+}
+
+// Count implements the Count method of the eventhorizon.ReadRepo interface.
+func (r *Repo) Count(ns string) (int64, error) {
+	n, err := r.client.SCard(context.Background(), idsKey(ns)).Result()
+	if err != nil {
+		return 0, repo.RepoError{
+			Err: err,
+		}
+	}
+
+	return n, nil
+}
+
+// mget returns the entities stored for the IDs, skipping missing ones.
+func (r *Repo) mget(ns string, ids []eventbus.DataId) ([]eventbus.Data, error) {
+	result := []eventbus.Data{}
+	if len(ids) == 0 {
+		return result, nil
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = key(ns, id)
+	}
+	values, err := r.client.MGet(context.Background(), keys...).Result()
+	if err != nil {
+		return nil, repo.RepoError{
+			Err: err,
+		}
+	}
+
+	for _, v := range values {
+		// Skip missing entities.
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		entity := r.factoryFn()
+		if err := json.Unmarshal([]byte(s), entity); err != nil {
+			return nil, repo.RepoError{
+				Err: err,
+			}
+		}
+		result = append(result, entity)
+	}
+
+	return result, nil
+}
+
+// Save implements the Save method of the eventhorizon.WriteRepo interface.
+func (r *Repo) Save(data eventbus.Data) error {
+	if data.Id() == "" {
+		return repo.RepoError{
+			Err:     repo.ErrCouldNotSaveEntity,
+			BaseErr: repo.ErrMissingEntityID,
+		}
+	}
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		return repo.RepoError{
+			Err:     repo.ErrCouldNotSaveEntity,
+			BaseErr: err,
+		}
+	}
+
+	ns := string(data.DataType())
+	if _, err := r.client.TxPipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		pipe.Set(context.Background(), key(ns, data.Id()), b, 0)
+		pipe.SAdd(context.Background(), idsKey(ns), string(data.Id()))
+		return nil
+	}); err != nil {
+		return repo.RepoError{
+			Err:     repo.ErrCouldNotSaveEntity,
+			BaseErr: err,
+		}
+	}
+	return nil
+}
+
+// Remove implements the Remove method of the eventhorizon.WriteRepo interface.
+func (r *Repo) Remove(data eventbus.Data) error {
+	ns := string(data.DataType())
+
+	var del *redis.IntCmd
+	if _, err := r.client.TxPipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		del = pipe.Del(context.Background(), key(ns, data.Id()))
+		pipe.SRem(context.Background(), idsKey(ns), string(data.Id()))
+		return nil
+	}); err != nil {
+		return repo.RepoError{
+			Err: err,
+		}
+	}
+	if del.Val() == 0 {
+		return repo.RepoError{
+			Err: repo.ErrEntityNotFound,
+		}
+	}
+
+	return nil
+}
+
+// SetEntityFactory sets a factory function that creates concrete entity types.
+func (r *Repo) SetEntityFactory(f func() eventbus.Data) {
+	r.factoryFn = f
+}
+
+// Clear removes all entities in the namespace.
+func (r *Repo) Clear(ns string) error {
+	ctx := context.Background()
+	ids, err := r.client.SMembers(ctx, idsKey(ns)).Result()
+	if err != nil {
+		return repo.RepoError{
+			Err:     ErrCouldNotClearDB,
+			BaseErr: err,
+		}
+	}
+
+	keys := []string{idsKey(ns)}
+	for _, id := range ids {
+		keys = append(keys, key(ns, eventbus.DataId(id)))
+	}
+	if err := r.client.Del(ctx, keys...).Err(); err != nil {
+		return repo.RepoError{
+			Err:     ErrCouldNotClearDB,
+			BaseErr: err,
+		}
+	}
+	return nil
+}
+
+// Close closes the client.
+func (r *Repo) Close() {
+	r.client.Close()
+}
+
+// Repository returns a parent ReadRepo if there is one.
+func Repository(repo repo.ReadRepo) *Repo {
+	if repo == nil {
+		return nil
+	}
+
+	if r, ok := repo.(*Repo); ok {
+		return r
+	}
+
+	return Repository(repo.Parent())
+}
@@ -0,0 +1,191 @@
+package redis
+
+import (
+	"github.com/alicebob/miniredis/v2"
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo"
+	"github.com/jeek120/repo/mocks"
+	"sort"
+	"testing"
+)
+
+// newTestRepo returns a repo on a new miniredis server with a factory for
+// mocks.Model.
+func newTestRepo(t *testing.T) (*Repo, *miniredis.Miniredis) {
+	s := miniredis.RunT(t)
+	r, err := NewRepo(s.Addr())
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	t.Cleanup(r.Close)
+
+	r.SetEntityFactory(func() eventbus.Data {
+		return &mocks.Model{}
+	})
+
+	return r, s
+}
+
+func isNotFound(err error) bool {
+	rrErr, ok := err.(repo.RepoError)
+	return ok && rrErr.Err == repo.ErrEntityNotFound
+}
+
+func sortedIds(entities []eventbus.Data) []eventbus.DataId {
+	ids := []eventbus.DataId{}
+	for _, e := range entities {
+		ids = append(ids, e.Id())
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func TestRepo(t *testing.T) {
+	r, s := newTestRepo(t)
+	ns := string(mocks.ModelType)
+
+	if _, err := r.FindById(ns, "1"); !isNotFound(err) {
+		t.Error("there should be a not found error:", err)
+	}
+
+	m1 := &mocks.Model{ID: "1", Content: "a"}
+	m2 := &mocks.Model{ID: "2", Content: "b"}
+	for _, m := range []*mocks.Model{m1, m2} {
+		if err := r.Save(m); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+	if !s.Exists("{Model}:id:1") || !s.Exists("{Model}:ids") {
+		t.Error("the entity should be stored under its key and in the set of IDs:", s.Keys())
+	}
+
+	entity, err := r.FindById(ns, "1")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if m := entity.(*mocks.Model); *m != *m1 {
+		t.Errorf("the entity should be correct: %+v", m)
+	}
+	if entity, err := r.Find(m2); err != nil || entity.(*mocks.Model).Content != "b" {
+		t.Error("the entity should be found:", entity, err)
+	}
+
+	entities, err := r.FindAll(ns)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if ids := sortedIds(entities); len(ids) != 2 || ids[0] != "1" || ids[1] != "2" {
+		t.Error("all entities should be found:", ids)
+	}
+	if n, err := r.Count(ns); err != nil || n != 2 {
+		t.Error("there should be two entities:", n, err)
+	}
+
+	if err := r.Remove(m1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := r.Remove(m1); !isNotFound(err) {
+		t.Error("there should be a not found error:", err)
+	}
+	if _, err := r.FindById(ns, "1"); !isNotFound(err) {
+		t.Error("there should be a not found error:", err)
+	}
+	if n, err := r.Count(ns); err != nil || n != 1 {
+		t.Error("there should be one entity:", n, err)
+	}
+
+	if err := r.Clear(ns); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if entities, err := r.FindAll(ns); err != nil || len(entities) != 0 {
+		t.Error("there should be no entities:", entities, err)
+	}
+}
+
+func TestRepoFindByIds(t *testing.T) {
+	r, _ := newTestRepo(t)
+	ns := string(mocks.ModelType)
+
+	for _, id := range []eventbus.DataId{"1", "2", "3"} {
+		if err := r.Save(&mocks.Model{ID: id}); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+
+	entities, err := r.FindByIds(ns, []eventbus.DataId{"1", "3", "4"})
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if ids := sortedIds(entities); len(ids) != 2 || ids[0] != "1" || ids[1] != "3" {
+		t.Error("only the found entities should be returned:", ids)
+	}
+}
+
+func TestRepoErrors(t *testing.T) {
+	r, s := newTestRepo(t)
+	ns := string(mocks.ModelType)
+
+	if err := r.Save(&mocks.Model{}); err == nil || err.(repo.RepoError).BaseErr != repo.ErrMissingEntityID {
+		t.Error("there should be a missing ID error:", err)
+	}
+
+	r.SetEntityFactory(nil)
+	if _, err := r.FindById(ns, "1"); err == nil || err.(repo.RepoError).Err != ErrModelNotSet {
+		t.Error("there should be a model not set error:", err)
+	}
+
+	addr := s.Addr()
+	s.Close()
+	if _, err := NewRepo(addr); err != ErrCouldNotDialDB {
+		t.Error("there should be a dial error:", err)
+	}
+}
+
+// nsModel is an entity with a configurable namespace.
+type nsModel struct {
+	ID eventbus.DataId   `json:"id"`
+	NS eventbus.DataType `json:"ns"`
+}
+
+func (m *nsModel) Id() eventbus.DataId         { return m.ID }
+func (m *nsModel) DataType() eventbus.DataType { return m.NS }
+
+func TestRepoNamespaceWithColon(t *testing.T) {
+	r, _ := newTestRepo(t)
+	r.SetEntityFactory(func() eventbus.Data {
+		return &nsModel{}
+	})
+
+	// With "ns:id" keys and "ns" sets, the entity "b" of "a" and the IDs of
+	// "a:b" would share a key.
+	for _, m := range []*nsModel{{ID: "b", NS: "a"}, {ID: "c", NS: "a:b"}, {ID: "ids", NS: "a"}} {
+		if err := r.Save(m); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+
+	if n, err := r.Count("a"); err != nil || n != 2 {
+		t.Error("there should be two entities:", n, err)
+	}
+	if entities, err := r.FindAll("a:b"); err != nil || len(entities) != 1 || entities[0].Id() != "c" {
+		t.Error("only the entity of the namespace should be found:", entities, err)
+	}
+	if entity, err := r.FindById("a", "b"); err != nil || entity.(*nsModel).NS != "a" {
+		t.Error("the entity should be found:", entity, err)
+	}
+
+	if err := r.Clear("a:b"); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if ids := sortedIds(mustFindAll(t, r, "a")); len(ids) != 2 || ids[0] != "b" || ids[1] != "ids" {
+		t.Error("the other namespace should not be cleared:", ids)
+	}
+}
+
+func mustFindAll(t *testing.T, r *Repo, ns string) []eventbus.Data {
+	entities, err := r.FindAll(ns)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	return entities
+}
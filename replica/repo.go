@@ -0,0 +1,164 @@
+package replica
+
+import (
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultSkipDuration is how long a failed replica is skipped by default.
+const DefaultSkipDuration = 30 * time.Second
+
+// Repo is a middleware that sends writes to a primary repo and balances reads
+// round-robin over read replicas. A replica that fails is skipped for a while;
+// when no replica is available reads go to the primary.
+type Repo struct {
+	repo.ReadWriteRepo
+	replicas []repo.ReadRepo
+	next     uint32
+	skip     time.Duration
+
+	mu      sync.Mutex
+	skipped map[int]time.Time
+}
+
+// NewRepo creates a new Repo.
+func NewRepo(primary repo.ReadWriteRepo, replicas []repo.ReadRepo) *Repo {
+	return &Repo{
+		ReadWriteRepo: primary,
+		replicas:      replicas,
+		skip:          DefaultSkipDuration,
+		skipped:       map[int]time.Time{},
+	}
+}
+
+// SetSkipDuration sets how long a failed replica is skipped.
+func (r *Repo) SetSkipDuration(d time.Duration) {
+	r.skip = d
+}
+
+// Parent implements the Parent method of the eventhorizon.ReadRepo interface.
+func (r *Repo) Parent() repo.ReadRepo {
+	return r.ReadWriteRepo
+}
+
+// Find implements the Find method of the eventhorizon.ReadRepo interface.
+func (r *Repo) Find(data eventbus.Data) (eventbus.Data, error) {
+	var entity eventbus.Data
+	err := r.read(func(rr repo.ReadRepo) (err error) {
+		entity, err = rr.Find(data)
+		return
+	})
+	return entity, err
+}
+
+// FindById implements the FindById method of the eventhorizon.ReadRepo interface.
+func (r *Repo) FindById(ns string, id eventbus.DataId) (eventbus.Data, error) {
+	var entity eventbus.Data
+	err := r.read(func(rr repo.ReadRepo) (err error) {
+		entity, err = rr.FindById(ns, id)
+		return
+	})
+	return entity, err
+}
+
+// FindByIds implements the FindByIds method of the eventhorizon.ReadRepo interface.
+func (r *Repo) FindByIds(ns string, ids []eventbus.DataId) ([]eventbus.Data, error) {
+	var entities []eventbus.Data
+	err := r.read(func(rr repo.ReadRepo) (err error) {
+		entities, err = rr.FindByIds(ns, ids)
+		return
+	})
+	return entities, err
+}
+
+// FindAll implements the FindAll method of the eventhorizon.ReadRepo interface.
+func (r *Repo) FindAll(ns string) ([]eventbus.Data, error) {
+	var entities []eventbus.Data
+	err := r.read(func(rr repo.ReadRepo) (err error) {
+		entities, err = rr.FindAll(ns)
+		return
+	})
+	return entities, err
+}
+
+// FindAllIter implements the FindAllIter method of the eventhorizon.ReadRepo interface.
+func (r *Repo) FindAllIter(ns string) (repo.Iter, error) {
+	var i repo.Iter
+	err := r.read(func(rr repo.ReadRepo) (err error) {
+		i, err = rr.FindAllIter(ns)
+		return
+	})
+	return i, err
+}
+
+// Count implements the Count method of the eventhorizon.ReadRepo interface.
+func (r *Repo) Count(ns string) (int64, error) {
+	var n int64
+	err := r.read(func(rr repo.ReadRepo) (err error) {
+		n, err = rr.Count(ns)
+		return
+	})
+	return n, err
+}
+
+// read runs f on the next available replica, trying the others if it fails
+// with an infrastructure error and finally the primary. Other errors, like a
+// missing entity or a bad query, are the answer of a healthy replica.
+func (r *Repo) read(f func(repo.ReadRepo) error) error {
+	n := uint32(len(r.replicas))
+	// The modulo is taken on the counter as a uint32, converting it to an int
+	// first makes it negative after a wrap around on 32 bit platforms.
+	start := atomic.AddUint32(&r.next, 1)
+	for i := uint32(0); i < n; i++ {
+		idx := int((start + i) % n)
+		if !r.available(idx) {
+			continue
+		}
+
+		err := f(r.replicas[idx])
+		if !repo.IsInfrastructureError(err) {
+			return err
+		}
+		r.markFailed(idx)
+	}
+
+	return f(r.ReadWriteRepo)
+}
+
+func (r *Repo) available(idx int) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	until, ok := r.skipped[idx]
+	if !ok {
+		return true
+	}
+	if time.Now().After(until) {
+		delete(r.skipped, idx)
+		return true
+	}
+	return false
+}
+
+func (r *Repo) markFailed(idx int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.skipped[idx] = time.Now().Add(r.skip)
+}
+
+// Repository returns a parent ReadRepo if there is one.
+func Repository(repo repo.ReadRepo) *Repo {
+	if repo == nil {
+		return nil
+	}
+
+	if r, ok := repo.(*Repo); ok {
+		return r
+	}
+
+	return Repository(repo.Parent())
+}
@@ -0,0 +1,123 @@
+package replica
+
+import (
+	"errors"
+	"github.com/jeek120/repo"
+	"github.com/jeek120/repo/mocks"
+	"math"
+	"testing"
+	"time"
+)
+
+func newTestRepo(n int) (*Repo, *mocks.Repo, []*mocks.Repo) {
+	primary := mocks.NewRepo()
+	var replicas []*mocks.Repo
+	var readRepos []repo.ReadRepo
+	for i := 0; i < n; i++ {
+		replica := mocks.NewRepo()
+		replicas = append(replicas, replica)
+		readRepos = append(readRepos, replica)
+	}
+	return NewRepo(primary, readRepos), primary, replicas
+}
+
+func TestRepoDistribution(t *testing.T) {
+	r, primary, replicas := newTestRepo(3)
+
+	if err := r.Save(&mocks.Model{ID: "1"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if primary.Calls("Save") != 1 {
+		t.Error("the write should go to the primary")
+	}
+
+	for i := 0; i < 6; i++ {
+		// The entity is only in the primary, a replica answers not found.
+		if _, err := r.FindById("Model", "1"); err == nil {
+			t.Error("the replica should be read")
+		}
+	}
+	for i, replica := range replicas {
+		if n := replica.Calls("FindById"); n != 2 {
+			t.Errorf("replica %d should have two reads: %d", i, n)
+		}
+	}
+	if primary.Calls("FindById") != 0 {
+		t.Error("the primary should not be read")
+	}
+}
+
+func TestRepoFailover(t *testing.T) {
+	r, primary, replicas := newTestRepo(2)
+
+	replicas[0].SetError(repo.RepoError{Err: repo.ErrConnectionLost})
+	for i := 0; i < 4; i++ {
+		if _, err := r.FindAll("Model"); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+	if n := replicas[0].Calls("FindAll"); n != 1 {
+		t.Error("the failed replica should be skipped:", n)
+	}
+	if n := replicas[1].Calls("FindAll"); n != 4 {
+		t.Error("the reads should go to the other replica:", n)
+	}
+
+	replicas[1].SetError(repo.RepoError{Err: repo.ErrConnectionLost})
+	if _, err := r.FindAll("Model"); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if primary.Calls("FindAll") != 1 {
+		t.Error("the read should fall back to the primary")
+	}
+
+	// The skipped replicas are tried again after the skip duration.
+	r.SetSkipDuration(0)
+	r.skipped = map[int]time.Time{}
+	replicas[0].SetError(nil)
+	replicas[1].SetError(nil)
+	primary.ResetCalls()
+	for i := 0; i < 2; i++ {
+		if _, err := r.FindAll("Model"); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+	if primary.Calls("FindAll") != 0 {
+		t.Error("the replicas should be read again")
+	}
+}
+
+func TestRepoCounterWrapAround(t *testing.T) {
+	// 2^32 is a multiple of 4, so the round-robin is even across the wrap.
+	r, _, replicas := newTestRepo(4)
+	r.next = math.MaxUint32 - 3
+
+	for i := 0; i < 8; i++ {
+		if _, err := r.Count("Model"); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+	for i, replica := range replicas {
+		if n := replica.Calls("Count"); n != 2 {
+			t.Errorf("replica %d should have two reads: %d", i, n)
+		}
+	}
+}
+
+func TestRepoOperationError(t *testing.T) {
+	r, primary, replicas := newTestRepo(1)
+
+	// An error of the operation, like a model that is not set, is the answer
+	// of a healthy replica.
+	opErr := repo.RepoError{Err: errors.New("model not set")}
+	replicas[0].SetError(opErr)
+	if _, err := r.FindAll("Model"); err != opErr {
+		t.Error("the error of the replica should be returned:", err)
+	}
+	if primary.Calls("FindAll") != 0 {
+		t.Error("the primary should not be read")
+	}
+	if !r.available(0) {
+		t.Error("the replica should not be skipped")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"github.com/jeek120/eventbus"
+	"net"
 )
 
 // RepoError is an error in the read repository, with the namespace.
@@ -32,6 +33,56 @@ var ErrCouldNotSaveEntity = errors.New("could not save entity")
 // ErrMissingEntityID is when a entity has no ID.
 var ErrMissingEntityID = errors.New("missing entity ID")
 
+// ErrQueryTimeout is when a query timed out.
+var ErrQueryTimeout = errors.New("query timeout")
+
+// ErrConnectionLost is when the connection to the storage was lost.
+var ErrConnectionLost = errors.New("connection lost")
+
+// ErrConflict is when an entity could not be created because it exists.
+var ErrConflict = errors.New("entity already exists")
+
+// IsInfrastructureError returns whether the error is caused by the storage
+// rather than by the operation, like a timeout or a lost connection. Both the
+// error and the base error of a RepoError are inspected, including the errors
+// they wrap, so that errors of any repo and driver are recognized.
+func IsInfrastructureError(err error) bool {
+	var rrErr RepoError
+	if errors.As(err, &rrErr) {
+		return isInfrastructureError(rrErr.Err) || isInfrastructureError(rrErr.BaseErr)
+	}
+	return isInfrastructureError(err)
+}
+
+// labeledError is implemented by driver errors with error labels, like the
+// errors of the MongoDB driver.
+type labeledError interface {
+	HasErrorLabel(label string) bool
+}
+
+func isInfrastructureError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, ErrQueryTimeout) ||
+		errors.Is(err, ErrConnectionLost) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	var le labeledError
+	if errors.As(err, &le) {
+		return le.HasErrorLabel("NetworkError") || le.HasErrorLabel("NetworkTimeoutError")
+	}
+
+	return false
+}
+
 // ReadRepo is a read repository for entities.
 type ReadRepo interface {
 	// Parent returns the parent read repository, if there is one.
@@ -42,8 +93,17 @@ type ReadRepo interface {
 	Find(data eventbus.Data) (eventbus.Data, error)
 	FindById(ns string, id eventbus.DataId) (eventbus.Data, error)
 
+	// FindByIds returns the entities found for the IDs, skipping missing ones.
+	FindByIds(ns string, ids []eventbus.DataId) ([]eventbus.Data, error)
+
 	// FindAll returns all entities in the repository.
 	FindAll(ns string) ([]eventbus.Data, error)
+
+	// FindAllIter returns an iterator over all entities in the namespace.
+	FindAllIter(ns string) (Iter, error)
+
+	// Count returns the number of entities in the namespace.
+	Count(ns string) (int64, error)
 }
 
 // WriteRepo is a write repository for entities.
@@ -76,3 +136,64 @@ type Iter interface {
 	Value() interface{}
 	Close(ctx context.Context) error
 }
+
+// SliceIter is an Iter over a slice of entities, for repos that can't stream.
+type SliceIter struct {
+	datas []eventbus.Data
+	pos   int
+}
+
+// NewSliceIter returns an Iter over the entities.
+func NewSliceIter(datas []eventbus.Data) *SliceIter {
+	return &SliceIter{
+		datas: datas,
+	}
+}
+
+// Next implements the Next method of the Iter interface.
+func (i *SliceIter) Next(ctx context.Context) bool {
+	if i.pos >= len(i.datas) {
+		return false
+	}
+	i.pos++
+	return true
+}
+
+// Value implements the Value method of the Iter interface.
+func (i *SliceIter) Value() interface{} {
+	if i.pos == 0 || i.pos > len(i.datas) {
+		return nil
+	}
+	return i.datas[i.pos-1]
+}
+
+// Close implements the Close method of the Iter interface.
+func (i *SliceIter) Close(ctx context.Context) error {
+	i.pos = len(i.datas) + 1
+	return nil
+}
+
+// Unique returns the entities without duplicate IDs, keeping the first
+// occurrence of each ID.
+func Unique(datas []eventbus.Data) []eventbus.Data {
+	seen := make(map[eventbus.DataId]bool, len(datas))
+	result := make([]eventbus.Data, 0, len(datas))
+	for _, data := range datas {
+		if seen[data.Id()] {
+			continue
+		}
+		seen[data.Id()] = true
+		result = append(result, data)
+	}
+	return result
+}
+
+// FindAllUnique returns all entities in the namespace of the repo without
+// duplicate IDs, which repos fanning out to many stores may return.
+func FindAllUnique(r ReadRepo, ns string) ([]eventbus.Data, error) {
+	datas, err := r.FindAll(ns)
+	if err != nil {
+		return nil, err
+	}
+	return Unique(datas), nil
+}
@@ -0,0 +1,135 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jeek120/eventbus"
+	"net"
+	"testing"
+)
+
+type labeled struct {
+	label string
+}
+
+func (e labeled) Error() string {
+	return "labeled error"
+}
+
+func (e labeled) HasErrorLabel(label string) bool {
+	return e.label == label
+}
+
+func TestIsInfrastructureError(t *testing.T) {
+	netErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+	cases := map[string]struct {
+		err  error
+		want bool
+	}{
+		"nil":       {nil, false},
+		"not found": {RepoError{Err: ErrEntityNotFound}, false},
+		"could not save": {RepoError{
+			Err:     ErrCouldNotSaveEntity,
+			BaseErr: errors.New("validation failed"),
+		}, false},
+		"timeout":         {RepoError{Err: ErrQueryTimeout}, true},
+		"connection lost": {RepoError{Err: ErrConnectionLost}, true},
+		"base net error": {RepoError{
+			Err:     ErrCouldNotSaveEntity,
+			BaseErr: netErr,
+		}, true},
+		"err net error": {RepoError{Err: netErr}, true},
+		"base deadline": {RepoError{
+			Err:     ErrCouldNotSaveEntity,
+			BaseErr: fmt.Errorf("server selection: %w", context.DeadlineExceeded),
+		}, true},
+		"network label":     {RepoError{Err: labeled{"NetworkError"}}, true},
+		"other label":       {RepoError{Err: labeled{"TransientTransactionError"}}, false},
+		"wrapped repo err":  {fmt.Errorf("save: %w", RepoError{Err: ErrConnectionLost}), true},
+		"plain net error":   {netErr, true},
+		"plain other error": {errors.New("error"), false},
+	}
+	for name, tc := range cases {
+		if got := IsInfrastructureError(tc.err); got != tc.want {
+			t.Errorf("%s: got %v, want %v", name, got, tc.want)
+		}
+	}
+}
+
+type model struct {
+	id eventbus.DataId
+}
+
+func (m *model) Id() eventbus.DataId         { return m.id }
+func (m *model) DataType() eventbus.DataType { return "Model" }
+
+func TestSliceIter(t *testing.T) {
+	ctx := context.Background()
+	i := NewSliceIter([]eventbus.Data{&model{"1"}, &model{"2"}})
+	if i.Value() != nil {
+		t.Error("there should be no value before Next")
+	}
+
+	ids := []eventbus.DataId{}
+	for i.Next(ctx) {
+		ids = append(ids, i.Value().(eventbus.Data).Id())
+	}
+	if len(ids) != 2 || ids[0] != "1" || ids[1] != "2" {
+		t.Error("all entities should be iterated in order:", ids)
+	}
+	if err := i.Close(ctx); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	// Closing stops the iteration.
+	i = NewSliceIter([]eventbus.Data{&model{"1"}, &model{"2"}})
+	if !i.Next(ctx) {
+		t.Fatal("there should be an entity")
+	}
+	if err := i.Close(ctx); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if i.Next(ctx) || i.Value() != nil {
+		t.Error("there should be no entities after Close")
+	}
+}
+
+func TestUnique(t *testing.T) {
+	first, second, dup := &model{"1"}, &model{"2"}, &model{"1"}
+	datas := Unique([]eventbus.Data{first, second, dup, second})
+	if len(datas) != 2 || datas[0] != first || datas[1] != second {
+		t.Error("the first occurrence of each ID should be kept:", datas)
+	}
+	if datas := Unique(nil); len(datas) != 0 {
+		t.Error("there should be no entities:", datas)
+	}
+}
+
+// fanOutRepo returns the same entities from many stores.
+type fanOutRepo struct {
+	ReadRepo
+	datas []eventbus.Data
+	err   error
+}
+
+func (r *fanOutRepo) FindAll(ns string) ([]eventbus.Data, error) {
+	return r.datas, r.err
+}
+
+func TestFindAllUnique(t *testing.T) {
+	r := &fanOutRepo{datas: []eventbus.Data{&model{"1"}, &model{"2"}, &model{"1"}}}
+	datas, err := FindAllUnique(r, "Model")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(datas) != 2 || datas[0].Id() != "1" || datas[1].Id() != "2" {
+		t.Error("the entities should be deduplicated:", datas)
+	}
+
+	r.err = errors.New("error")
+	if _, err := FindAllUnique(r, "Model"); err != r.err {
+		t.Error("the error should be returned:", err)
+	}
+}
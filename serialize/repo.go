@@ -0,0 +1,96 @@
+package serialize
+
+import (
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo"
+	"sync"
+)
+
+// Repo is a middleware that serializes concurrent writes to the same entity in
+// process, while writes to different entities proceed in parallel. Reads are
+// not serialized.
+type Repo struct {
+	repo.ReadWriteRepo
+
+	mu    sync.Mutex
+	locks map[key]*lock
+}
+
+type key struct {
+	ns eventbus.DataType
+	id eventbus.DataId
+}
+
+// lock is the lock of an entity, removed from the map when no write holds or
+// waits for it.
+type lock struct {
+	sync.Mutex
+	refs int
+}
+
+// NewRepo creates a new Repo.
+func NewRepo(repo repo.ReadWriteRepo) *Repo {
+	return &Repo{
+		ReadWriteRepo: repo,
+		locks:         map[key]*lock{},
+	}
+}
+
+// Parent implements the Parent method of the eventhorizon.ReadRepo interface.
+func (r *Repo) Parent() repo.ReadRepo {
+	return r.ReadWriteRepo
+}
+
+// Save implements the Save method of the eventhorizon.WriteRepo interface.
+func (r *Repo) Save(data eventbus.Data) error {
+	defer r.lock(data)()
+
+	return r.ReadWriteRepo.Save(data)
+}
+
+// Remove implements the Remove method of the eventhorizon.WriteRepo interface.
+func (r *Repo) Remove(data eventbus.Data) error {
+	defer r.lock(data)()
+
+	return r.ReadWriteRepo.Remove(data)
+}
+
+// lock locks the entity and returns the func to unlock it.
+func (r *Repo) lock(data eventbus.Data) func() {
+	k := key{data.DataType(), data.Id()}
+
+	r.mu.Lock()
+	l, ok := r.locks[k]
+	if !ok {
+		l = &lock{}
+		r.locks[k] = l
+	}
+	l.refs++
+	r.mu.Unlock()
+
+	l.Lock()
+
+	return func() {
+		l.Unlock()
+
+		r.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(r.locks, k)
+		}
+		r.mu.Unlock()
+	}
+}
+
+// Repository returns a parent ReadRepo if there is one.
+func Repository(repo repo.ReadRepo) *Repo {
+	if repo == nil {
+		return nil
+	}
+
+	if r, ok := repo.(*Repo); ok {
+		return r
+	}
+
+	return Repository(repo.Parent())
+}
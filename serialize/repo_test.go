@@ -0,0 +1,97 @@
+package serialize
+
+import (
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo/mocks"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// counterRepo counts the saves with an unsynchronized read-modify-write, which
+// loses updates and is reported by the race detector if saves are concurrent.
+type counterRepo struct {
+	*mocks.Repo
+	n int
+}
+
+func (r *counterRepo) Save(data eventbus.Data) error {
+	n := r.n
+	runtime.Gosched()
+	r.n = n + 1
+	return nil
+}
+
+func TestRepoSameId(t *testing.T) {
+	inner := &counterRepo{Repo: mocks.NewRepo()}
+	r := NewRepo(inner)
+
+	const n = 1000
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := r.Save(&mocks.Model{ID: "1"}); err != nil {
+				t.Error("there should be no error:", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if inner.n != n {
+		t.Error("there should be no lost updates:", inner.n)
+	}
+	if l := len(r.locks); l != 0 {
+		t.Error("the unused locks should be removed:", l)
+	}
+	if r.Parent() != inner {
+		t.Error("the parent should be the inner repo")
+	}
+}
+
+// blockingRepo blocks saves of the entity with ID 1 until release is closed.
+type blockingRepo struct {
+	*mocks.Repo
+	release chan struct{}
+}
+
+func (r *blockingRepo) Save(data eventbus.Data) error {
+	if data.Id() == "1" {
+		<-r.release
+	}
+	return r.Repo.Save(data)
+}
+
+func TestRepoDifferentIds(t *testing.T) {
+	inner := &blockingRepo{Repo: mocks.NewRepo(), release: make(chan struct{})}
+	r := NewRepo(inner)
+
+	done := make(chan error)
+	go func() {
+		done <- r.Save(&mocks.Model{ID: "1"})
+	}()
+
+	// A write to another entity is not blocked by the pending one.
+	saved := make(chan error)
+	go func() {
+		saved <- r.Save(&mocks.Model{ID: "2"})
+	}()
+	select {
+	case err := <-saved:
+		if err != nil {
+			t.Error("there should be no error:", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("the write to another entity should not be blocked")
+	}
+
+	close(inner.release)
+	if err := <-done; err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if l := len(r.locks); l != 0 {
+		t.Error("the unused locks should be removed:", l)
+	}
+}
@@ -0,0 +1,193 @@
+package sharded
+
+import (
+	"context"
+	"errors"
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo"
+	"github.com/jeek120/repo/mongodb"
+	"hash/fnv"
+)
+
+// ErrNoShards is when a Repo is created without shards.
+var ErrNoShards = errors.New("no shards")
+
+// Repo is a repository that spreads entities over several MongoDB repos by a
+// hash of their ID. Operations on a single entity go to its shard, listing and
+// counting fan out to all shards and merge the results.
+type Repo struct {
+	shards []*mongodb.Repo
+	hash   func(eventbus.DataId) int
+}
+
+// NewRepo creates a new Repo. If hash is nil a FNV hash of the ID is used.
+func NewRepo(shards []*mongodb.Repo, hash func(eventbus.DataId) int) (*Repo, error) {
+	if len(shards) == 0 {
+		return nil, ErrNoShards
+	}
+	if hash == nil {
+		hash = fnvHash
+	}
+
+	return &Repo{
+		shards: shards,
+		hash:   hash,
+	}, nil
+}
+
+func fnvHash(id eventbus.DataId) int {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return int(h.Sum32())
+}
+
+// Shard returns the shard an ID is stored in.
+func (r *Repo) Shard(id eventbus.DataId) *mongodb.Repo {
+	i := r.hash(id) % len(r.shards)
+	if i < 0 {
+		i += len(r.shards)
+	}
+	return r.shards[i]
+}
+
+// Parent implements the Parent method of the eventhorizon.ReadRepo interface.
+func (r *Repo) Parent() repo.ReadRepo {
+	return nil
+}
+
+// Find implements the Find method of the eventhorizon.ReadRepo interface.
+func (r *Repo) Find(data eventbus.Data) (eventbus.Data, error) {
+	return r.Shard(data.Id()).Find(data)
+}
+
+// FindById implements the FindById method of the eventhorizon.ReadRepo interface.
+func (r *Repo) FindById(ns string, id eventbus.DataId) (eventbus.Data, error) {
+	return r.Shard(id).FindById(ns, id)
+}
+
+// FindByIds implements the FindByIds method of the eventhorizon.ReadRepo interface.
+func (r *Repo) FindByIds(ns string, ids []eventbus.DataId) ([]eventbus.Data, error) {
+	byShard := map[*mongodb.Repo][]eventbus.DataId{}
+	for _, id := range ids {
+		s := r.Shard(id)
+		byShard[s] = append(byShard[s], id)
+	}
+
+	result := []eventbus.Data{}
+	for s, ids := range byShard {
+		entities, err := s.FindByIds(ns, ids)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, entities...)
+	}
+
+	return result, nil
+}
+
+// FindAll implements the FindAll method of the eventhorizon.ReadRepo interface.
+func (r *Repo) FindAll(ns string) ([]eventbus.Data, error) {
+	result := []eventbus.Data{}
+	for _, s := range r.shards {
+		entities, err := s.FindAll(ns)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, entities...)
+	}
+
+	return result, nil
+}
+
+// FindAllIter implements the FindAllIter method of the eventhorizon.ReadRepo
+// interface. The shards are iterated one after the other.
+func (r *Repo) FindAllIter(ns string) (repo.Iter, error) {
+	return &iter{
+		shards: r.shards,
+		ns:     ns,
+	}, nil
+}
+
+// iter opens the iterator of each shard when the previous one is exhausted.
+type iter struct {
+	shards []*mongodb.Repo
+	ns     string
+	cur    repo.Iter
+	err    error
+}
+
+func (i *iter) Next(ctx context.Context) bool {
+	for i.err == nil {
+		if i.cur != nil {
+			if i.cur.Next(ctx) {
+				return true
+			}
+			i.err = i.cur.Close(ctx)
+			i.cur = nil
+			continue
+		}
+		if len(i.shards) == 0 {
+			return false
+		}
+		i.cur, i.err = i.shards[0].FindAllIter(i.ns)
+		i.shards = i.shards[1:]
+	}
+	return false
+}
+
+func (i *iter) Value() interface{} {
+	if i.cur == nil {
+		return nil
+	}
+	return i.cur.Value()
+}
+
+func (i *iter) Close(ctx context.Context) error {
+	i.shards = nil
+	if i.cur != nil {
+		err := i.cur.Close(ctx)
+		i.cur = nil
+		if i.err == nil {
+			i.err = err
+		}
+	}
+	return i.err
+}
+
+// Count implements the Count method of the eventhorizon.ReadRepo interface,
+// summing the counts of all shards.
+func (r *Repo) Count(ns string) (int64, error) {
+	var n int64
+	for _, s := range r.shards {
+		c, err := s.Count(ns)
+		if err != nil {
+			return 0, err
+		}
+		n += c
+	}
+
+	return n, nil
+}
+
+// Save implements the Save method of the eventhorizon.WriteRepo interface.
+func (r *Repo) Save(data eventbus.Data) error {
+	return r.Shard(data.Id()).Save(data)
+}
+
+// Remove implements the Remove method of the eventhorizon.WriteRepo interface.
+func (r *Repo) Remove(data eventbus.Data) error {
+	return r.Shard(data.Id()).Remove(data)
+}
+
+// Repository returns a parent ReadRepo if there is one.
+func Repository(repo repo.ReadRepo) *Repo {
+	if repo == nil {
+		return nil
+	}
+
+	if r, ok := repo.(*Repo); ok {
+		return r
+	}
+
+	return Repository(repo.Parent())
+}
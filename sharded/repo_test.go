@@ -0,0 +1,177 @@
+package sharded
+
+import (
+	"context"
+	"fmt"
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo/mocks"
+	"github.com/jeek120/repo/mongodb"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"os"
+	"sort"
+	"testing"
+	"time"
+)
+
+// newTestShards returns n repos on new databases with a factory for
+// mocks.Model. The test is skipped if there is no MongoDB server at
+// MONGODB_ADDR, localhost:27017 by default.
+func newTestShards(t *testing.T, n int) []*mongodb.Repo {
+	addr := os.Getenv("MONGODB_ADDR")
+	if addr == "" {
+		addr = "localhost:27017"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().
+		ApplyURI("mongodb://"+addr).
+		SetServerSelectionTimeout(time.Second))
+	if err == nil {
+		err = client.Ping(ctx, nil)
+	}
+	if err != nil {
+		t.Skip("no MongoDB server:", err)
+	}
+	t.Cleanup(func() {
+		client.Disconnect(context.Background())
+	})
+
+	shards := []*mongodb.Repo{}
+	for i := 0; i < n; i++ {
+		db := fmt.Sprintf("test-%d-%d", time.Now().UnixNano(), i)
+		r, err := mongodb.NewRepo("mongodb://"+addr, db)
+		if err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+		r.SetEntityFactory(func() eventbus.Data {
+			return &mocks.Model{}
+		})
+		t.Cleanup(func() {
+			client.Database(db).Drop(context.Background())
+			r.Close()
+		})
+		shards = append(shards, r)
+	}
+
+	return shards
+}
+
+func sortedIds(entities []eventbus.Data) []eventbus.DataId {
+	ids := []eventbus.DataId{}
+	for _, e := range entities {
+		ids = append(ids, e.Id())
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func TestRepoShard(t *testing.T) {
+	shards := []*mongodb.Repo{}
+	for i := 0; i < 3; i++ {
+		// The repos connect lazily, no server is needed.
+		s, err := mongodb.NewRepo("mongodb://localhost:1", "test")
+		if err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+		defer s.Close()
+		shards = append(shards, s)
+	}
+
+	hash := func(id eventbus.DataId) int {
+		var n int
+		fmt.Sscan(string(id), &n)
+		return n
+	}
+	r, err := NewRepo(shards, hash)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	for id, i := range map[eventbus.DataId]int{"0": 0, "1": 1, "2": 2, "3": 0, "-1": 2} {
+		if s := r.Shard(id); s != shards[i] {
+			t.Error("the ID should be routed to its shard:", id)
+		}
+	}
+
+	// The default hash is deterministic.
+	if r, err = NewRepo(shards, nil); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	for _, id := range []eventbus.DataId{"a", "b", "c"} {
+		if r.Shard(id) != r.Shard(id) {
+			t.Error("the ID should always be routed to the same shard:", id)
+		}
+	}
+
+	if r.Parent() != nil {
+		t.Error("there should be no parent")
+	}
+
+	if _, err := NewRepo(nil, nil); err != ErrNoShards {
+		t.Error("there should be a no shards error:", err)
+	}
+}
+
+func TestRepo(t *testing.T) {
+	shards := newTestShards(t, 3)
+	r, err := NewRepo(shards, nil)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	ns := string(mocks.ModelType)
+
+	ids := []eventbus.DataId{"1", "2", "3", "4", "5", "6"}
+	for _, id := range ids {
+		if err := r.Save(&mocks.Model{ID: id}); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+
+	for _, id := range ids {
+		if _, err := r.Shard(id).FindById(ns, id); err != nil {
+			t.Error("the entity should be saved in its shard:", id, err)
+		}
+		if _, err := r.FindById(ns, id); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+
+	// Listing and counting fan out to all shards.
+	entities, err := r.FindAll(ns)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if found := sortedIds(entities); len(found) != len(ids) {
+		t.Error("the entities of all shards should be found:", found)
+	}
+	if n, err := r.Count(ns); err != nil || n != int64(len(ids)) {
+		t.Error("the entities of all shards should be counted:", n, err)
+	}
+	entities, err = r.FindByIds(ns, []eventbus.DataId{"1", "4", "7"})
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if found := sortedIds(entities); len(found) != 2 || found[0] != "1" || found[1] != "4" {
+		t.Error("the found entities should be returned:", found)
+	}
+
+	i, err := r.FindAllIter(ns)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	n := 0
+	for i.Next(context.Background()) {
+		n++
+	}
+	if err := i.Close(context.Background()); err != nil || n != len(ids) {
+		t.Error("the entities of all shards should be iterated:", n, err)
+	}
+
+	if err := r.Remove(&mocks.Model{ID: "1"}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if n, err := r.Count(ns); err != nil || n != int64(len(ids)-1) {
+		t.Error("the entity should be removed:", n, err)
+	}
+}
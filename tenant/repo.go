@@ -0,0 +1,210 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo"
+)
+
+// ErrNoTenant is when there is no tenant ID in the context.
+var ErrNoTenant = errors.New("no tenant")
+
+// ErrNotTenantEntity is when an entity does not implement Entity.
+var ErrNotTenantEntity = errors.New("entity has no tenant")
+
+// ErrTenantMismatch is when an entity belongs to another tenant.
+var ErrTenantMismatch = errors.New("entity belongs to another tenant")
+
+// Entity is an entity that belongs to a tenant. The tenant ID must be stored in
+// the Field of the entity, for MongoDB a field tagged `bson:"_tenant"`.
+type Entity interface {
+	eventbus.Data
+
+	// TenantID returns the ID of the tenant of the entity.
+	TenantID() string
+	// SetTenantID sets the ID of the tenant of the entity.
+	SetTenantID(string)
+}
+
+type contextKey int
+
+const tenantKey contextKey = iota
+
+// NewContext returns a context with the tenant ID.
+func NewContext(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantKey, tenantID)
+}
+
+// FromContext returns the tenant ID of the context.
+func FromContext(ctx context.Context) (string, bool) {
+	tenantID, ok := ctx.Value(tenantKey).(string)
+	return tenantID, ok && tenantID != ""
+}
+
+// Field is the field storing the tenant ID of entities.
+const Field = "_tenant"
+
+// Store is a repo that can scope its operations to the documents with a field
+// value in the queries themselves, like the MongoDB repo.
+type Store interface {
+	repo.ReadWriteRepo
+
+	// Scope returns a view of the repo only seeing the documents with the
+	// field set to the value. Saves must fail with ErrConflict instead of
+	// overwriting a document outside of the scope.
+	Scope(field string, value interface{}) repo.ReadWriteRepo
+}
+
+// Repo is a middleware that isolates the entities of tenants. The tenant ID is
+// read from the context set with WithContext; writes stamp it on the entity and
+// all operations are scoped to the tenant by the store, in the Field of the
+// entities. Entities of other tenants are reported as not found, and saving an
+// entity with the ID of an entity of another tenant fails.
+type Repo struct {
+	repo.ReadWriteRepo
+	store Store
+	ctx   context.Context
+}
+
+// NewRepo creates a new Repo.
+func NewRepo(store Store) *Repo {
+	return &Repo{
+		ReadWriteRepo: store,
+		store:         store,
+		ctx:           context.Background(),
+	}
+}
+
+// WithContext returns a shallow copy of the repo scoped to the tenant in ctx.
+func (r *Repo) WithContext(ctx context.Context) *Repo {
+	r2 := *r
+	r2.ctx = ctx
+	return &r2
+}
+
+// Parent implements the Parent method of the eventhorizon.ReadRepo interface.
+func (r *Repo) Parent() repo.ReadRepo {
+	return r.ReadWriteRepo
+}
+
+// Find implements the Find method of the eventhorizon.ReadRepo interface.
+func (r *Repo) Find(data eventbus.Data) (eventbus.Data, error) {
+	s, _, err := r.scoped()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Find(data)
+}
+
+// FindById implements the FindById method of the eventhorizon.ReadRepo interface.
+func (r *Repo) FindById(ns string, id eventbus.DataId) (eventbus.Data, error) {
+	s, _, err := r.scoped()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.FindById(ns, id)
+}
+
+// FindByIds implements the FindByIds method of the eventhorizon.ReadRepo interface.
+func (r *Repo) FindByIds(ns string, ids []eventbus.DataId) ([]eventbus.Data, error) {
+	s, _, err := r.scoped()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.FindByIds(ns, ids)
+}
+
+// FindAll implements the FindAll method of the eventhorizon.ReadRepo interface.
+func (r *Repo) FindAll(ns string) ([]eventbus.Data, error) {
+	s, _, err := r.scoped()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.FindAll(ns)
+}
+
+// FindAllIter implements the FindAllIter method of the eventhorizon.ReadRepo interface.
+func (r *Repo) FindAllIter(ns string) (repo.Iter, error) {
+	s, _, err := r.scoped()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.FindAllIter(ns)
+}
+
+// Count implements the Count method of the eventhorizon.ReadRepo interface.
+func (r *Repo) Count(ns string) (int64, error) {
+	s, _, err := r.scoped()
+	if err != nil {
+		return 0, err
+	}
+
+	return s.Count(ns)
+}
+
+// Save implements the Save method of the eventhorizon.WriteRepo interface.
+func (r *Repo) Save(data eventbus.Data) error {
+	s, tenantID, err := r.scoped()
+	if err != nil {
+		return err
+	}
+
+	entity, ok := data.(Entity)
+	if !ok {
+		return repo.RepoError{
+			Err:     repo.ErrCouldNotSaveEntity,
+			BaseErr: ErrNotTenantEntity,
+		}
+	}
+
+	entity.SetTenantID(tenantID)
+	err = s.Save(data)
+	if rrErr, ok := err.(repo.RepoError); ok && rrErr.Err == repo.ErrConflict {
+		// The ID is taken by an entity of another tenant.
+		return repo.RepoError{
+			Err:     repo.ErrCouldNotSaveEntity,
+			BaseErr: ErrTenantMismatch,
+		}
+	}
+	return err
+}
+
+// Remove implements the Remove method of the eventhorizon.WriteRepo interface.
+func (r *Repo) Remove(data eventbus.Data) error {
+	s, _, err := r.scoped()
+	if err != nil {
+		return err
+	}
+
+	return s.Remove(data)
+}
+
+// scoped returns the store scoped to the tenant of the context.
+func (r *Repo) scoped() (repo.ReadWriteRepo, string, error) {
+	tenantID, ok := FromContext(r.ctx)
+	if !ok {
+		return nil, "", repo.RepoError{
+			Err: ErrNoTenant,
+		}
+	}
+	return r.store.Scope(Field, tenantID), tenantID, nil
+}
+
+// Repository returns a parent ReadRepo if there is one.
+func Repository(repo repo.ReadRepo) *Repo {
+	if repo == nil {
+		return nil
+	}
+
+	if r, ok := repo.(*Repo); ok {
+		return r
+	}
+
+	return Repository(repo.Parent())
+}
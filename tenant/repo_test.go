@@ -0,0 +1,167 @@
+package tenant
+
+import (
+	"context"
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo"
+	"github.com/jeek120/repo/mocks"
+	"sync"
+	"testing"
+)
+
+type model struct {
+	ID      eventbus.DataId `bson:"_id"`
+	Tenant  string          `bson:"_tenant"`
+	Content string          `bson:"content"`
+}
+
+func (m *model) Id() eventbus.DataId         { return m.ID }
+func (m *model) DataType() eventbus.DataType { return "Model" }
+func (m *model) TenantID() string            { return m.Tenant }
+func (m *model) SetTenantID(id string)       { m.Tenant = id }
+
+// store is a Store keeping the entities in memory, scoping by the tenant of
+// the entities.
+type store struct {
+	*mocks.Repo
+	mu sync.Mutex
+}
+
+func (s *store) Scope(field string, value interface{}) repo.ReadWriteRepo {
+	return &scopedStore{s, value.(string)}
+}
+
+type scopedStore struct {
+	*store
+	tenantID string
+}
+
+func (s *scopedStore) FindById(ns string, id eventbus.DataId) (eventbus.Data, error) {
+	data, err := s.Repo.FindById(ns, id)
+	if err != nil {
+		return nil, err
+	}
+	if data.(Entity).TenantID() != s.tenantID {
+		return nil, repo.RepoError{Err: repo.ErrEntityNotFound}
+	}
+	return data, nil
+}
+
+func (s *scopedStore) Find(data eventbus.Data) (eventbus.Data, error) {
+	return s.FindById(string(data.DataType()), data.Id())
+}
+
+func (s *scopedStore) FindByIds(ns string, ids []eventbus.DataId) ([]eventbus.Data, error) {
+	datas, err := s.Repo.FindByIds(ns, ids)
+	return s.filter(datas), err
+}
+
+func (s *scopedStore) FindAll(ns string) ([]eventbus.Data, error) {
+	datas, err := s.Repo.FindAll(ns)
+	return s.filter(datas), err
+}
+
+func (s *scopedStore) FindAllIter(ns string) (repo.Iter, error) {
+	datas, err := s.FindAll(ns)
+	return repo.NewSliceIter(datas), err
+}
+
+func (s *scopedStore) Count(ns string) (int64, error) {
+	datas, err := s.FindAll(ns)
+	return int64(len(datas)), err
+}
+
+func (s *scopedStore) filter(datas []eventbus.Data) []eventbus.Data {
+	var result []eventbus.Data
+	for _, data := range datas {
+		if data.(Entity).TenantID() == s.tenantID {
+			result = append(result, data)
+		}
+	}
+	return result
+}
+
+func (s *scopedStore) Save(data eventbus.Data) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, err := s.Repo.FindById(string(data.DataType()), data.Id()); err == nil &&
+		existing.(Entity).TenantID() != s.tenantID {
+		return repo.RepoError{Err: repo.ErrConflict}
+	}
+	return s.Repo.Save(data)
+}
+
+func (s *scopedStore) Remove(data eventbus.Data) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.FindById(string(data.DataType()), data.Id()); err != nil {
+		return err
+	}
+	return s.Repo.Remove(data)
+}
+
+func TestRepoIsolation(t *testing.T) {
+	r := NewRepo(&store{Repo: mocks.NewRepo()})
+	a := r.WithContext(NewContext(context.Background(), "a"))
+	b := r.WithContext(NewContext(context.Background(), "b"))
+
+	if err := a.Save(&model{ID: "1", Content: "a"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if err := b.Save(&model{ID: "2", Content: "b"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	// Cross-tenant reads are blocked.
+	if _, err := b.FindById("Model", "1"); !isNotFound(err) {
+		t.Error("there should be a not found error:", err)
+	}
+	if _, err := b.Find(&model{ID: "1"}); !isNotFound(err) {
+		t.Error("there should be a not found error:", err)
+	}
+	if entities, err := b.FindByIds("Model", []eventbus.DataId{"1", "2"}); err != nil || len(entities) != 1 || entities[0].Id() != "2" {
+		t.Error("only the entity of the tenant should be found:", entities, err)
+	}
+	if entities, err := a.FindAll("Model"); err != nil || len(entities) != 1 || entities[0].Id() != "1" {
+		t.Error("only the entity of the tenant should be listed:", entities, err)
+	}
+	if n, err := a.Count("Model"); err != nil || n != 1 {
+		t.Error("only the entity of the tenant should be counted:", n, err)
+	}
+	i, err := a.FindAllIter("Model")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	var ids []eventbus.DataId
+	for i.Next(context.Background()) {
+		ids = append(ids, i.Value().(eventbus.Data).Id())
+	}
+	if len(ids) != 1 || ids[0] != "1" {
+		t.Error("only the entity of the tenant should be iterated:", ids)
+	}
+
+	// Cross-tenant writes are blocked.
+	err = b.Save(&model{ID: "1", Content: "b"})
+	if rrErr, ok := err.(repo.RepoError); !ok || rrErr.BaseErr != ErrTenantMismatch {
+		t.Error("there should be a tenant mismatch error:", err)
+	}
+	if err := b.Remove(&model{ID: "1"}); !isNotFound(err) {
+		t.Error("there should be a not found error:", err)
+	}
+	entity, err := a.FindById("Model", "1")
+	if err != nil || entity.(*model).Content != "a" {
+		t.Error("the entity should be unchanged:", entity, err)
+	}
+
+	// No tenant.
+	if _, err := r.FindAll("Model"); err == nil || err.(repo.RepoError).Err != ErrNoTenant {
+		t.Error("there should be a no tenant error:", err)
+	}
+}
+
+func isNotFound(err error) bool {
+	rrErr, ok := err.(repo.RepoError)
+	return ok && rrErr.Err == repo.ErrEntityNotFound
+}
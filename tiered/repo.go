@@ -0,0 +1,179 @@
+package tiered
+
+import (
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo"
+)
+
+// Repo is a middleware that reads through a local and a distributed cache in
+// front of a backing repository. Reads check the local cache, then the
+// distributed cache, then the backing repo, populating the faster tiers on a
+// hit. Writes go to the backing repo and invalidate both caches.
+//
+// Caches that implement Cache, like cache.Repo, are populated and invalidated
+// with it. Other caches must be pure stores, as they are populated with Save
+// and invalidated with Remove.
+type Repo struct {
+	local       repo.ReadWriteRepo
+	distributed repo.ReadWriteRepo
+	repo.ReadWriteRepo
+}
+
+// NewRepo creates a new Repo.
+func NewRepo(local, distributed, backing repo.ReadWriteRepo) *Repo {
+	return &Repo{
+		local:         local,
+		distributed:   distributed,
+		ReadWriteRepo: backing,
+	}
+}
+
+// Cache is implemented by caches that wrap another repo, so that filling or
+// invalidating them must not write to the wrapped repo, like cache.Repo.
+type Cache interface {
+	// Populate caches an entity without writing it to the wrapped repo.
+	Populate(data eventbus.Data)
+	// Evict removes an entity from the cache without removing it from the
+	// wrapped repo.
+	Evict(data eventbus.Data)
+}
+
+// Parent implements the Parent method of the eventhorizon.ReadRepo interface.
+func (r *Repo) Parent() repo.ReadRepo {
+	return r.ReadWriteRepo
+}
+
+// Find implements the Find method of the eventhorizon.ReadRepo interface.
+func (r *Repo) Find(data eventbus.Data) (eventbus.Data, error) {
+	return r.FindById(string(data.DataType()), data.Id())
+}
+
+// FindById implements the FindById method of the eventhorizon.ReadRepo interface.
+func (r *Repo) FindById(ns string, id eventbus.DataId) (eventbus.Data, error) {
+	// Errors from the caches are treated as misses.
+	if entity, err := r.local.FindById(ns, id); err == nil {
+		return entity, nil
+	}
+
+	if entity, err := r.distributed.FindById(ns, id); err == nil {
+		populate(r.local, entity)
+		return entity, nil
+	}
+
+	entity, err := r.ReadWriteRepo.FindById(ns, id)
+	if err != nil {
+		return nil, err
+	}
+	populate(r.distributed, entity)
+	populate(r.local, entity)
+
+	return entity, nil
+}
+
+// FindByIds implements the FindByIds method of the eventhorizon.ReadRepo interface.
+func (r *Repo) FindByIds(ns string, ids []eventbus.DataId) ([]eventbus.Data, error) {
+	found := make(map[eventbus.DataId]eventbus.Data, len(ids))
+	misses := ids
+	for _, c := range []repo.ReadWriteRepo{r.local, r.distributed} {
+		if len(misses) == 0 {
+			break
+		}
+		// Errors from the caches are treated as misses.
+		entities, _ := c.FindByIds(ns, misses)
+		for _, entity := range entities {
+			found[entity.Id()] = entity
+			if c != r.local {
+				populate(r.local, entity)
+			}
+		}
+		misses = missing(misses, found)
+	}
+
+	if len(misses) > 0 {
+		entities, err := r.ReadWriteRepo.FindByIds(ns, misses)
+		if err != nil {
+			return nil, err
+		}
+		for _, entity := range entities {
+			found[entity.Id()] = entity
+			populate(r.distributed, entity)
+			populate(r.local, entity)
+		}
+	}
+
+	result := make([]eventbus.Data, 0, len(found))
+	for _, id := range ids {
+		if entity, ok := found[id]; ok {
+			result = append(result, entity)
+		}
+	}
+
+	return result, nil
+}
+
+// populate stores an entity read from a slower tier in a cache.
+func populate(c repo.ReadWriteRepo, data eventbus.Data) {
+	if cc, ok := c.(Cache); ok {
+		cc.Populate(data)
+		return
+	}
+	c.Save(data)
+}
+
+func missing(ids []eventbus.DataId, found map[eventbus.DataId]eventbus.Data) []eventbus.DataId {
+	var misses []eventbus.DataId
+	for _, id := range ids {
+		if _, ok := found[id]; !ok {
+			misses = append(misses, id)
+		}
+	}
+	return misses
+}
+
+// Save implements the Save method of the eventhorizon.WriteRepo interface.
+func (r *Repo) Save(data eventbus.Data) error {
+	if err := r.ReadWriteRepo.Save(data); err != nil {
+		return err
+	}
+
+	return r.invalidate(data)
+}
+
+// Remove implements the Remove method of the eventhorizon.WriteRepo interface.
+func (r *Repo) Remove(data eventbus.Data) error {
+	if err := r.ReadWriteRepo.Remove(data); err != nil {
+		return err
+	}
+
+	return r.invalidate(data)
+}
+
+func (r *Repo) invalidate(data eventbus.Data) error {
+	for _, c := range []repo.ReadWriteRepo{r.distributed, r.local} {
+		if cc, ok := c.(Cache); ok {
+			cc.Evict(data)
+			continue
+		}
+		if err := c.Remove(data); err != nil {
+			if rrErr, ok := err.(repo.RepoError); ok && rrErr.Err == repo.ErrEntityNotFound {
+				continue
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Repository returns a parent ReadRepo if there is one.
+func Repository(repo repo.ReadRepo) *Repo {
+	if repo == nil {
+		return nil
+	}
+
+	if r, ok := repo.(*Repo); ok {
+		return r
+	}
+
+	return Repository(repo.Parent())
+}
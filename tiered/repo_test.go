@@ -0,0 +1,165 @@
+package tiered
+
+import (
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo"
+	"github.com/jeek120/repo/cache"
+	"github.com/jeek120/repo/mocks"
+	"testing"
+)
+
+func TestRepoPromotion(t *testing.T) {
+	local, distributed, backing := mocks.NewRepo(), mocks.NewRepo(), mocks.NewRepo()
+	r := NewRepo(local, distributed, backing)
+	ns := string(mocks.ModelType)
+
+	m := &mocks.Model{ID: "1", Content: "content"}
+	if err := backing.Save(m); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	// A miss in both caches reads the backing repo and populates both tiers.
+	if entity, err := r.FindById(ns, "1"); err != nil || entity != m {
+		t.Fatal("the entity should be found:", entity, err)
+	}
+	if _, err := local.FindById(ns, "1"); err != nil {
+		t.Error("the entity should be promoted to the local cache:", err)
+	}
+	if _, err := distributed.FindById(ns, "1"); err != nil {
+		t.Error("the entity should be promoted to the distributed cache:", err)
+	}
+
+	// A hit in the local cache does not reach the other tiers.
+	distributed.ResetCalls()
+	backing.ResetCalls()
+	if _, err := r.FindById(ns, "1"); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if distributed.Calls("FindById") != 0 || backing.Calls("FindById") != 0 {
+		t.Error("the local cache should answer")
+	}
+
+	// A hit in the distributed cache is promoted to the local cache only.
+	if err := local.Remove(m); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if _, err := r.FindById(ns, "1"); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if backing.Calls("FindById") != 0 {
+		t.Error("the distributed cache should answer")
+	}
+	if _, err := local.FindById(ns, "1"); err != nil {
+		t.Error("the entity should be promoted to the local cache:", err)
+	}
+
+	if r.Parent() != backing {
+		t.Error("the parent should be the backing repo")
+	}
+}
+
+func TestRepoFindByIds(t *testing.T) {
+	local, distributed, backing := mocks.NewRepo(), mocks.NewRepo(), mocks.NewRepo()
+	r := NewRepo(local, distributed, backing)
+	ns := string(mocks.ModelType)
+
+	for _, id := range []eventbus.DataId{"1", "2", "3"} {
+		if err := backing.Save(&mocks.Model{ID: id}); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+	local.Save(&mocks.Model{ID: "1"})
+	distributed.Save(&mocks.Model{ID: "2"})
+
+	entities, err := r.FindByIds(ns, []eventbus.DataId{"1", "2", "3", "4"})
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if len(entities) != 3 || entities[0].Id() != "1" || entities[1].Id() != "2" || entities[2].Id() != "3" {
+		t.Error("the found entities should be returned in order:", entities)
+	}
+	for _, id := range []eventbus.DataId{"1", "2", "3"} {
+		if _, err := local.FindById(ns, id); err != nil {
+			t.Error("the entity should be promoted to the local cache:", id, err)
+		}
+	}
+}
+
+func TestRepoInvalidation(t *testing.T) {
+	local, distributed, backing := mocks.NewRepo(), mocks.NewRepo(), mocks.NewRepo()
+	r := NewRepo(local, distributed, backing)
+	ns := string(mocks.ModelType)
+
+	m := &mocks.Model{ID: "1", Content: "old"}
+	if err := r.Save(m); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if _, err := r.FindById(ns, "1"); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	if err := r.Save(&mocks.Model{ID: "1", Content: "new"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	for _, c := range []*mocks.Repo{local, distributed} {
+		if _, err := c.FindById(ns, "1"); !isNotFound(err) {
+			t.Error("the caches should be invalidated on save:", err)
+		}
+	}
+	if entity, err := r.FindById(ns, "1"); err != nil || entity.(*mocks.Model).Content != "new" {
+		t.Error("the new entity should be read:", entity, err)
+	}
+
+	if err := r.Remove(m); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if _, err := r.FindById(ns, "1"); !isNotFound(err) {
+		t.Error("the caches should be invalidated on remove:", err)
+	}
+}
+
+func isNotFound(err error) bool {
+	rrErr, ok := err.(repo.RepoError)
+	return ok && rrErr.Err == repo.ErrEntityNotFound
+}
+
+func TestRepoCacheTier(t *testing.T) {
+	// The local tier is an in-process cache wrapping a store of its own.
+	localInner, distributed, backing := mocks.NewRepo(), mocks.NewRepo(), mocks.NewRepo()
+	local := cache.NewRepo(localInner)
+	if err := local.Register(mocks.ModelType, 10); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	r := NewRepo(local, distributed, backing)
+	ns := string(mocks.ModelType)
+
+	m := &mocks.Model{ID: "1"}
+	if err := backing.Save(m); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	// A read miss fills the cache without writing to its inner repo.
+	if _, err := r.FindById(ns, "1"); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if _, err := r.FindByIds(ns, []eventbus.DataId{"1"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if n := localInner.Calls("Save"); n != 0 {
+		t.Error("the inner repo of the cache should not be written:", n)
+	}
+	if local.Len(mocks.ModelType) != 1 {
+		t.Error("the entity should be cached")
+	}
+
+	// A write evicts the entity without removing it from the inner repo.
+	if err := r.Save(m); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if n := localInner.Calls("Remove"); n != 0 {
+		t.Error("the inner repo of the cache should not be written:", n)
+	}
+	if local.Len(mocks.ModelType) != 0 {
+		t.Error("the entity should be evicted")
+	}
+}
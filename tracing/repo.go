@@ -0,0 +1,150 @@
+package tracing
+
+import (
+	"context"
+	"github.com/jeek120/eventbus"
+	"github.com/jeek120/repo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Repo is a middleware that starts an OpenTelemetry span for every operation
+// on the wrapped repository. Spans are named "repo.<op>" and carry the
+// namespace and entity ID as attributes.
+type Repo struct {
+	repo.ReadWriteRepo
+	tracer trace.Tracer
+	ctx    context.Context
+}
+
+// NewRepo creates a new Repo.
+func NewRepo(repo repo.ReadWriteRepo, tracer trace.Tracer) *Repo {
+	return &Repo{
+		ReadWriteRepo: repo,
+		tracer:        tracer,
+		ctx:           context.Background(),
+	}
+}
+
+// WithContext returns a shallow copy of the repo that starts its spans as
+// children of the span in ctx, if any.
+func (r *Repo) WithContext(ctx context.Context) *Repo {
+	r2 := *r
+	r2.ctx = ctx
+	return &r2
+}
+
+// Parent implements the Parent method of the eventhorizon.ReadRepo interface.
+func (r *Repo) Parent() repo.ReadRepo {
+	return r.ReadWriteRepo
+}
+
+// Find implements the Find method of the eventhorizon.ReadRepo interface.
+func (r *Repo) Find(data eventbus.Data) (eventbus.Data, error) {
+	span := r.start("find", string(data.DataType()), data.Id())
+	entity, err := r.ReadWriteRepo.Find(data)
+	end(span, err)
+
+	return entity, err
+}
+
+// FindById implements the FindById method of the eventhorizon.ReadRepo interface.
+func (r *Repo) FindById(ns string, id eventbus.DataId) (eventbus.Data, error) {
+	span := r.start("find_by_id", ns, id)
+	entity, err := r.ReadWriteRepo.FindById(ns, id)
+	end(span, err)
+
+	return entity, err
+}
+
+// FindByIds implements the FindByIds method of the eventhorizon.ReadRepo interface.
+func (r *Repo) FindByIds(ns string, ids []eventbus.DataId) ([]eventbus.Data, error) {
+	span := r.start("find_by_ids", ns, "")
+	entities, err := r.ReadWriteRepo.FindByIds(ns, ids)
+	end(span, err)
+
+	return entities, err
+}
+
+// FindAll implements the FindAll method of the eventhorizon.ReadRepo interface.
+func (r *Repo) FindAll(ns string) ([]eventbus.Data, error) {
+	span := r.start("find_all", ns, "")
+	entities, err := r.ReadWriteRepo.FindAll(ns)
+	end(span, err)
+
+	return entities, err
+}
+
+// FindAllIter implements the FindAllIter method of the eventhorizon.ReadRepo interface.
+func (r *Repo) FindAllIter(ns string) (repo.Iter, error) {
+	span := r.start("find_all_iter", ns, "")
+	i, err := r.ReadWriteRepo.FindAllIter(ns)
+	end(span, err)
+
+	return i, err
+}
+
+// Count implements the Count method of the eventhorizon.ReadRepo interface.
+func (r *Repo) Count(ns string) (int64, error) {
+	span := r.start("count", ns, "")
+	n, err := r.ReadWriteRepo.Count(ns)
+	end(span, err)
+
+	return n, err
+}
+
+// Save implements the Save method of the eventhorizon.WriteRepo interface.
+func (r *Repo) Save(data eventbus.Data) error {
+	span := r.start("save", string(data.DataType()), data.Id())
+	err := r.ReadWriteRepo.Save(data)
+	end(span, err)
+
+	return err
+}
+
+// Remove implements the Remove method of the eventhorizon.WriteRepo interface.
+func (r *Repo) Remove(data eventbus.Data) error {
+	span := r.start("remove", string(data.DataType()), data.Id())
+	err := r.ReadWriteRepo.Remove(data)
+	end(span, err)
+
+	return err
+}
+
+func (r *Repo) start(op, ns string, id eventbus.DataId) trace.Span {
+	attrs := []attribute.KeyValue{
+		attribute.String("db.namespace", ns),
+	}
+	if id != "" {
+		attrs = append(attrs, attribute.String("entity.id", string(id)))
+	}
+
+	_, span := r.tracer.Start(r.ctx, "repo."+op, trace.WithAttributes(attrs...))
+	return span
+}
+
+// end ends the span, recording the error if any. An entity that is not found
+// is an answer, not a failure of the operation, so it is not an error status.
+func end(span trace.Span, err error) {
+	if rrErr, ok := err.(repo.RepoError); ok && rrErr.Err == repo.ErrEntityNotFound {
+		span.SetAttributes(attribute.Bool("entity.found", false))
+	} else if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Repository returns a parent ReadRepo if there is one.
+func Repository(repo repo.ReadRepo) *Repo {
+	if repo == nil {
+		return nil
+	}
+
+	if r, ok := repo.(*Repo); ok {
+		return r
+	}
+
+	return Repository(repo.Parent())
+}
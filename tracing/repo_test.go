@@ -0,0 +1,111 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"github.com/jeek120/repo"
+	"github.com/jeek120/repo/mocks"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"testing"
+)
+
+func newTestRepo() (*Repo, *mocks.Repo, *tracetest.SpanRecorder) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	inner := mocks.NewRepo()
+	return NewRepo(inner, tp.Tracer("test")), inner, sr
+}
+
+func attrs(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	m := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes() {
+		m[kv.Key] = kv.Value
+	}
+	return m
+}
+
+func TestRepo(t *testing.T) {
+	r, _, sr := newTestRepo()
+
+	m := &mocks.Model{ID: "1"}
+	if err := r.Save(m); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if _, err := r.FindById(string(mocks.ModelType), "1"); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := r.FindAll(string(mocks.ModelType)); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	spans := sr.Ended()
+	if len(spans) != 3 {
+		t.Fatal("there should be one span per call:", len(spans))
+	}
+	for i, name := range []string{"repo.save", "repo.find_by_id", "repo.find_all"} {
+		span := spans[i]
+		if span.Name() != name {
+			t.Error("the span name should be correct:", span.Name())
+		}
+		a := attrs(span)
+		if a["db.namespace"].AsString() != string(mocks.ModelType) {
+			t.Error("the namespace should be set:", span.Name(), a)
+		}
+		if _, ok := a["entity.id"]; ok != (name != "repo.find_all") {
+			t.Error("the entity ID should be set for single entities:", span.Name(), a)
+		}
+		if span.Status().Code == codes.Error {
+			t.Error("the span should not have an error status:", span.Name())
+		}
+	}
+}
+
+func TestRepoContext(t *testing.T) {
+	r, _, sr := newTestRepo()
+
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	if _, err := r.WithContext(ctx).Count(string(mocks.ModelType)); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	parent.End()
+
+	spans := sr.Ended()
+	if len(spans) != 2 || spans[0].Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Error("the span should be a child of the span in the context")
+	}
+}
+
+func TestRepoErrors(t *testing.T) {
+	r, inner, sr := newTestRepo()
+
+	// A missing entity is not an error of the operation.
+	if _, err := r.FindById(string(mocks.ModelType), "1"); err == nil {
+		t.Error("there should be a not found error")
+	}
+
+	inner.SetError(repo.RepoError{Err: errors.New("connection refused")})
+	if err := r.Remove(&mocks.Model{ID: "1"}); err == nil {
+		t.Error("there should be an error")
+	}
+
+	spans := sr.Ended()
+	if len(spans) != 2 {
+		t.Fatal("there should be one span per call:", len(spans))
+	}
+	if code := spans[0].Status().Code; code == codes.Error {
+		t.Error("a not found entity should not be an error status")
+	}
+	if a := attrs(spans[0]); a["entity.found"].AsBool() || a["entity.found"].Type() != attribute.BOOL {
+		t.Error("the span should record that the entity was not found:", a)
+	}
+	if code := spans[1].Status().Code; code != codes.Error {
+		t.Error("the error should be recorded as the span status:", code)
+	}
+	if len(spans[1].Events()) != 1 {
+		t.Error("the error should be recorded as an event")
+	}
+}